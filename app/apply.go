@@ -0,0 +1,469 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kuetemeier/imgindex/imgmeta"
+	log "github.com/sirupsen/logrus"
+)
+
+// Types of ApplyColumn
+const (
+	ApplyTypeIPTC = "iptc"
+	ApplyTypeXMP  = "xmp"
+)
+
+// ApplyColumn maps a column of a spreadsheet to a field of the images. Type is 'iptc' or 'xmp', ID the name of
+// the dataset (e.g. 'description' or 'Keywords') or of the property (e.g. 'dc:description'). The cells of
+// columns with a separator are lists, e.g. keywords separated by ';'.
+type ApplyColumn struct {
+	Column    string `mapstructure:"column"`
+	Type      string `mapstructure:"type"`
+	ID        string `mapstructure:"id"`
+	Separator string `mapstructure:"separator"`
+}
+
+// field returns the name of the field in reports, e.g. 'XMP:dc:description'
+func (c ApplyColumn) field() string {
+	return strings.ToUpper(c.Type) + ":" + c.ID
+}
+
+// aApplyFileColumns are the columns that name the file of a row, by its path relative to the source directory
+// or by its name
+var aApplyFileColumns = []string{"file", "path", "filename"}
+
+// tApplyRow is a row of a spreadsheet
+type tApplyRow struct {
+	line  int                    // line in a CSV file, number of the object in a JSON file
+	file  string                 // relative path or name of the image
+	cells map[string]interface{} // string or []string by column
+}
+
+// tApplyChange is a field of an image that differs from the spreadsheet
+type tApplyChange struct {
+	column   ApplyColumn
+	old, new interface{}
+	kept     string // reason why the value is not written, empty if it is
+}
+
+// Apply writes the cells of a spreadsheet (CSV with a header line, or JSON with an array of objects) into the
+// images below cfg.Source. Rows are matched to the images by the 'file' column, columns to fields by columns.
+// Empty cells are skipped, and values of an image whose metadata is newer than the spreadsheet are kept. XMP is
+// written as configured in cfg.XMPTargets (see WriteXMP), IPTC only into JPEG files. The result of every row
+// is reported on cfg.Out, with dryRun as a diff of the values that would be written.
+func Apply(cfg Config, sheet string, columns []ApplyColumn, dryRun bool) error {
+	for _, column := range columns {
+		switch column.Type {
+		case ApplyTypeXMP:
+		case ApplyTypeIPTC:
+			if _, ok := imgmeta.IPTCTag(column.ID); !ok {
+				return fmt.Errorf("unknown IPTC dataset '%s' for column '%s'", column.ID, column.Column)
+			}
+		default:
+			return fmt.Errorf("unknown type '%s' for column '%s'", column.Type, column.Column)
+		}
+	}
+
+	info, err := os.Stat(sheet)
+	if err != nil {
+		return err
+	}
+	rows, err := readSheet(sheet)
+	if err != nil {
+		return err
+	}
+	files, err := newApplyFiles(cfg)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, row := range rows {
+		name := row.file
+		if name == "" {
+			name = fmt.Sprintf("line %d", row.line)
+		}
+		changes, err := applyRow(cfg, files, row, columns, info.ModTime(), dryRun)
+		if err != nil {
+			failed++
+			log.Debug(fmt.Sprintf("Applying line %d of %s: %v", row.line, sheet, err))
+			if _, err := fmt.Fprintf(cfg.Out, "%s: failed: %v\n", name, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := reportApply(cfg, name, changes, dryRun); err != nil {
+			return err
+		}
+	}
+
+	log.Info(fmt.Sprintf("Applied %d rows of %s", len(rows)-failed, sheet))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rows of %s failed", failed, len(rows), sheet)
+	}
+	return nil
+}
+
+// reportApply writes the result of a row, e.g. 'a.jpg: updated XMP:dc:title'
+func reportApply(cfg Config, name string, changes []tApplyChange, dryRun bool) error {
+	updated, kept := []string{}, []string{}
+	for _, change := range changes {
+		if change.kept == "" {
+			updated = append(updated, change.column.field())
+		} else {
+			kept = append(kept, fmt.Sprintf("%s (%s)", change.column.field(), change.kept))
+		}
+	}
+
+	parts := []string{}
+	switch {
+	case len(updated) > 0 && dryRun:
+		parts = append(parts, "would update "+strings.Join(updated, ", "))
+	case len(updated) > 0:
+		parts = append(parts, "updated "+strings.Join(updated, ", "))
+	case len(kept) == 0:
+		parts = append(parts, "unchanged")
+	}
+	if len(kept) > 0 {
+		parts = append(parts, "kept "+strings.Join(kept, ", "))
+	}
+	if _, err := fmt.Fprintf(cfg.Out, "%s: %s\n", name, strings.Join(parts, "; ")); err != nil {
+		return err
+	}
+
+	if !dryRun {
+		return nil
+	}
+	for _, change := range changes {
+		if change.kept != "" {
+			continue
+		}
+		if change.old != nil {
+			if _, err := fmt.Fprintf(cfg.Out, "  - %s: %s\n", change.column.field(), formatApplyValue(change.old)); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(cfg.Out, "  + %s: %s\n", change.column.field(), formatApplyValue(change.new)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatApplyValue(value interface{}) string {
+	if list, ok := value.([]string); ok {
+		return strings.Join(list, "; ")
+	}
+	return fmt.Sprint(value)
+}
+
+// readSheet reads the rows of a CSV or JSON file
+func readSheet(path string) ([]tApplyRow, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readCSVSheet(data)
+	case ".json":
+		return readJSONSheet(data)
+	}
+	return nil, fmt.Errorf("%s is no CSV or JSON file", path)
+}
+
+func readCSVSheet(data []byte) ([]tApplyRow, error) {
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff")))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("spreadsheet has no header line")
+	}
+	header := records[0]
+
+	rows := []tApplyRow{}
+	for i, record := range records[1:] {
+		row := tApplyRow{line: i + 2, cells: map[string]interface{}{}}
+		for j, cell := range record {
+			row.cells[strings.TrimSpace(header[j])] = cell
+		}
+		row.file = rowFile(row.cells)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readJSONSheet(data []byte) ([]tApplyRow, error) {
+	objects := []map[string]interface{}{}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	rows := []tApplyRow{}
+	for i, object := range objects {
+		row := tApplyRow{line: i + 1, cells: map[string]interface{}{}}
+		for column, value := range object {
+			switch v := value.(type) {
+			case nil:
+			case []interface{}:
+				list := []string{}
+				for _, item := range v {
+					list = append(list, fmt.Sprint(item))
+				}
+				row.cells[column] = list
+			default:
+				row.cells[column] = fmt.Sprint(v)
+			}
+		}
+		row.file = rowFile(row.cells)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// rowFile returns the cell of the first file column of a row
+func rowFile(cells map[string]interface{}) string {
+	for _, name := range aApplyFileColumns {
+		for column, cell := range cells {
+			if text, ok := cell.(string); ok && strings.EqualFold(column, name) && strings.TrimSpace(text) != "" {
+				return strings.TrimSpace(text)
+			}
+		}
+	}
+	return ""
+}
+
+// cellValue returns the value of a cell for a column, string or []string if the column has a separator. ok is
+// false if the cell is empty.
+func cellValue(column ApplyColumn, cell interface{}) (value interface{}, ok bool) {
+	items := []string{}
+	switch v := cell.(type) {
+	case string:
+		if column.Separator == "" {
+			v = strings.TrimSpace(v)
+			return v, v != ""
+		}
+		items = strings.Split(v, column.Separator)
+	case []string:
+		if column.Separator == "" {
+			return cellValue(column, strings.Join(v, ", "))
+		}
+		items = v
+	}
+
+	list := []string{}
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, len(list) > 0
+}
+
+// currentValue returns a value of an image in the form of cellValue, nil if the image has none
+func currentValue(column ApplyColumn, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []string:
+		if column.Separator == "" {
+			return strings.Join(v, ", ")
+		}
+		return v
+	case string:
+		if v == "" {
+			return nil
+		}
+		if column.Separator != "" {
+			return []string{v}
+		}
+		return v
+	}
+	return currentValue(column, fmt.Sprint(value))
+}
+
+// tApplyFiles are the files below the source directory by their relative path and by their name
+type tApplyFiles struct {
+	byPath map[string]string
+	byName map[string][]string
+}
+
+func newApplyFiles(cfg Config) (tApplyFiles, error) {
+	files := tApplyFiles{byPath: map[string]string{}, byName: map[string][]string{}}
+	err := walkFiles(cfg, func(path string) error {
+		rel, err := filepath.Rel(cfg.Source, path)
+		if err != nil {
+			return err
+		}
+		files.byPath[filepath.ToSlash(rel)] = path
+		files.byName[filepath.Base(path)] = append(files.byName[filepath.Base(path)], path)
+		return nil
+	})
+	return files, err
+}
+
+// find returns the file named by a row, by its relative path or, if that does not exist, by its name
+func (f tApplyFiles) find(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("row names no file")
+	}
+	if path, ok := f.byPath[filepath.ToSlash(filepath.Clean(name))]; ok {
+		return path, nil
+	}
+	switch paths := f.byName[filepath.Base(name)]; len(paths) {
+	case 0:
+		return "", fmt.Errorf("no such file")
+	case 1:
+		return paths[0], nil
+	default:
+		return "", fmt.Errorf("the name matches %d files", len(paths))
+	}
+}
+
+// metadataTime returns when the metadata of a file was changed, the XMP metadata date if there is one
+func metadataTime(path string, metadataDate interface{}) time.Time {
+	if text, ok := metadataDate.(string); ok {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+			if date, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+				return date
+			}
+		}
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// applyRow compares a row with the image it names and, without dryRun, writes the changed values
+func applyRow(cfg Config, files tApplyFiles, row tApplyRow, columns []ApplyColumn, sheetTime time.Time, dryRun bool) ([]tApplyChange, error) {
+	path, err := files.find(row.file)
+	if err != nil {
+		return nil, err
+	}
+	image, err := imgmeta.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the XMP is read from where WriteXMP writes it
+	xmpFile := path
+	readXMP := func(name string) interface{} {
+		value, _ := image.ReadPropertyValue("XMP", name)
+		return value
+	}
+	if xmpTarget(cfg, image) == XMPSidecar {
+		xmpFile = imgmeta.XMPSidecar(path)
+		sidecar := imgmeta.XMP{}
+		if packet, err := ioutil.ReadFile(xmpFile); err == nil {
+			if sidecar, err = imgmeta.ParseXMP(packet); err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		readXMP = func(name string) interface{} {
+			return sidecar.Properties()[name]
+		}
+	}
+	embeddedDate, _ := image.ReadPropertyValue("XMP", "xmp:MetadataDate")
+	times := map[string]time.Time{
+		ApplyTypeIPTC: metadataTime(path, embeddedDate),
+		ApplyTypeXMP:  metadataTime(xmpFile, readXMP("xmp:MetadataDate")),
+	}
+
+	changes := []tApplyChange{}
+	for _, column := range columns {
+		value, ok := cellValue(column, row.cells[column.Column])
+		if !ok {
+			continue
+		}
+		var old interface{}
+		if column.Type == ApplyTypeIPTC {
+			old, _ = image.ReadPropertyValue("IPTC", column.ID)
+		} else {
+			old = readXMP(column.ID)
+		}
+		old = currentValue(column, old)
+		if reflect.DeepEqual(old, value) {
+			continue
+		}
+
+		change := tApplyChange{column: column, old: old, new: value}
+		switch {
+		case column.Type == ApplyTypeIPTC && image.Format() != "jpeg":
+			change.kept = "IPTC is only written to JPEG files"
+		case old != nil && times[column.Type].After(sheetTime):
+			change.kept = "newer than the spreadsheet"
+		}
+		changes = append(changes, change)
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+	return changes, writeChanges(cfg, image, path, changes)
+}
+
+// writeChanges writes the values of the changes that are not kept. The IPTC and an embedded XMP are written
+// together, and every change sets the XMP metadata date, so the XMP is newer than the spreadsheet afterwards.
+func writeChanges(cfg Config, image imgmeta.Image, path string, changes []tApplyChange) error {
+	iptc, xmp := []tApplyChange{}, []tApplyChange{}
+	for _, change := range changes {
+		switch {
+		case change.kept != "":
+		case change.column.Type == ApplyTypeIPTC:
+			iptc = append(iptc, change)
+		default:
+			xmp = append(xmp, change)
+		}
+	}
+	if len(iptc) == 0 && len(xmp) == 0 {
+		return nil
+	}
+
+	editXMP := func(editor *imgmeta.XMPEditor) error {
+		for _, change := range xmp {
+			if err := editor.Set(change.column.ID, change.new); err != nil {
+				return err
+			}
+		}
+		return editor.Set("xmp:MetadataDate", time.Now().Format(time.RFC3339))
+	}
+	if len(iptc) == 0 {
+		_, err := WriteXMP(cfg, path, editXMP)
+		return err
+	}
+
+	// IPTC changes are only applied to JPEG files
+	embedded := xmpTarget(cfg, image) == XMPEmbedded
+	err := updateJpeg(path, func(writer *imgmeta.JpegWriter) error {
+		values := writer.IPTC()
+		for _, change := range iptc {
+			tag, _ := imgmeta.IPTCTag(change.column.ID)
+			values[tag] = change.new
+		}
+		if err := writer.SetIPTC(values); err != nil {
+			return err
+		}
+		if !embedded {
+			return nil
+		}
+		return editJpegXMP(writer, editXMP)
+	})
+	if err != nil || embedded {
+		return err
+	}
+	_, err = WriteXMP(cfg, path, editXMP)
+	return err
+}
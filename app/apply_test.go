@@ -0,0 +1,131 @@
+package app_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/kuetemeier/imgindex/app"
+	"github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Apply", func() {
+
+	var dir, jpegPath, rawPath string
+	var cfg Config
+	var out *bytes.Buffer
+	columns := []ApplyColumn{
+		{Column: "caption", Type: ApplyTypeIPTC, ID: "description"},
+		{Column: "caption", Type: ApplyTypeXMP, ID: "dc:description"},
+		{Column: "keywords", Type: ApplyTypeXMP, ID: "dc:subject", Separator: ";"},
+	}
+
+	// writeSheet writes a spreadsheet that was saved at modTime
+	writeSheet := func(name string, content string, modTime time.Time) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).Should(Succeed())
+		Expect(os.Chtimes(path, modTime, modTime)).Should(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "imgindex")
+		Expect(err).Should(BeNil())
+		out = &bytes.Buffer{}
+		cfg = Config{Source: filepath.Join(dir, "photos"), Out: out}
+		Expect(os.MkdirAll(filepath.Join(cfg.Source, "raw"), 0755)).Should(Succeed())
+
+		original, err := ioutil.ReadFile("../testdata/the-wall-sample.jpg")
+		Expect(err).Should(BeNil())
+		jpegPath = filepath.Join(cfg.Source, "the-wall.jpg")
+		Expect(ioutil.WriteFile(jpegPath, original, 0644)).Should(Succeed())
+		rawPath = filepath.Join(cfg.Source, "raw", "IMG_0001.CR2")
+		Expect(ioutil.WriteFile(rawPath, minimalCR2(1), 0644)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should report a diff in a dry run without changing the images", func() {
+		sheet := writeSheet("captions.csv", "file,caption,keywords\n"+
+			"the-wall.jpg,Eine Mauer,mauer; berlin\n"+
+			"missing.jpg,Fehlt,\n", time.Now().Add(time.Hour))
+		before, err := ioutil.ReadFile(jpegPath)
+		Expect(err).Should(BeNil())
+
+		Expect(Apply(cfg, sheet, columns, true)).ShouldNot(Succeed())
+		Expect(out.String()).Should(Equal("the-wall.jpg: would update IPTC:description, XMP:dc:description, XMP:dc:subject\n" +
+			"  - IPTC:description: Beschreibung\n" +
+			"  + IPTC:description: Eine Mauer\n" +
+			"  + XMP:dc:description: Eine Mauer\n" +
+			"  - XMP:dc:subject: jk; test; wall\n" +
+			"  + XMP:dc:subject: mauer; berlin\n" +
+			"missing.jpg: failed: no such file\n"))
+		after, err := ioutil.ReadFile(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(after).Should(Equal(before))
+	})
+
+	It("should write the columns into the image and into sidecars", func() {
+		sheet := writeSheet("captions.json", `[
+			{"file": "the-wall.jpg", "caption": "Eine Mauer", "keywords": ["mauer", "berlin"]},
+			{"file": "raw/IMG_0001.CR2", "caption": "Ein Foto", "keywords": null}
+		]`, time.Now().Add(time.Hour))
+
+		Expect(Apply(cfg, sheet, columns, false)).Should(Succeed())
+		Expect(out.String()).Should(Equal("the-wall.jpg: updated IPTC:description, XMP:dc:description, XMP:dc:subject\n" +
+			"raw/IMG_0001.CR2: updated XMP:dc:description; kept IPTC:description (IPTC is only written to JPEG files)\n"))
+
+		image, err := imgmeta.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("IPTC", "description")).Should(Equal("Eine Mauer"))
+		Expect(image.ReadPropertyValue("XMP", "dc:description")).Should(Equal("Eine Mauer"))
+		Expect(image.ReadPropertyValue("XMP", "dc:subject")).Should(Equal([]string{"mauer", "berlin"}))
+		packet, err := ioutil.ReadFile(filepath.Join(cfg.Source, "raw", "IMG_0001.xmp"))
+		Expect(err).Should(BeNil())
+		xmp, err := imgmeta.ParseXMP(packet)
+		Expect(err).Should(BeNil())
+		Expect(xmp.Properties()["dc:description"]).Should(Equal("Ein Foto"))
+
+		out.Reset()
+		Expect(Apply(cfg, sheet, columns, false)).Should(Succeed())
+		Expect(out.String()).Should(Equal("the-wall.jpg: unchanged\n" +
+			"raw/IMG_0001.CR2: kept IPTC:description (IPTC is only written to JPEG files)\n"))
+	})
+
+	It("should set the metadata date of rows that only change the IPTC", func() {
+		sheet := writeSheet("captions.csv", "file,caption\nthe-wall.jpg,Eine Mauer\n", time.Now().Add(time.Hour))
+		start := time.Now().Add(-time.Second)
+		Expect(Apply(cfg, sheet, columns[:1], false)).Should(Succeed())
+		Expect(out.String()).Should(Equal("the-wall.jpg: updated IPTC:description\n"))
+
+		image, err := imgmeta.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("IPTC", "description")).Should(Equal("Eine Mauer"))
+		value, err := image.ReadPropertyValue("XMP", "xmp:MetadataDate")
+		Expect(err).Should(BeNil())
+		date, err := time.Parse(time.RFC3339, value.(string))
+		Expect(err).Should(BeNil())
+		Expect(date.After(start)).Should(BeTrue())
+	})
+
+	It("should keep values that are newer than the spreadsheet", func() {
+		sheet := writeSheet("captions.csv", "filename,caption\nthe-wall.jpg,Eine Mauer\n",
+			time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC))
+		Expect(Apply(cfg, sheet, columns, false)).Should(Succeed())
+		Expect(out.String()).Should(Equal("the-wall.jpg: updated XMP:dc:description; " +
+			"kept IPTC:description (newer than the spreadsheet)\n"))
+		image, err := imgmeta.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("IPTC", "description")).Should(Equal("Beschreibung"))
+
+		Expect(Apply(cfg, sheet, []ApplyColumn{{Column: "caption", Type: "exif", ID: "ImageDescription"}}, false)).ShouldNot(Succeed())
+	})
+
+})
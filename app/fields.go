@@ -0,0 +1,182 @@
+package app
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // register the pixel decoders
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kuetemeier/imgindex/imgmeta"
+)
+
+// Field types
+const (
+	FieldTypeCore = "core"
+	FieldTypeMWG  = "mwg" // reconciled metadata, e.g. 'description' (see imgmeta.Metadata)
+)
+
+// IDs of the 'core' fields
+const (
+	CoreFilename         = "filename"
+	CoreFilenameRelative = "filenameRelative"
+	CoreVersion          = "version"
+	CoreFormat           = "format"
+	CoreMediaType        = "mediaType"
+	CoreContentHash      = "contentHash"
+	CoreDHash            = "dHash"
+	CorePHash            = "pHash"
+	CoreBlurHash         = "blurHash"
+	CoreDominantColor    = "dominantColor"
+	CorePreview          = "preview"
+	CoreDisplayWidth     = "displayWidth"
+	CoreDisplayHeight    = "displayHeight"
+	CoreAspectRatio      = "aspectRatio"
+	CoreOrientationLabel = "orientationLabel"
+	CoreJpegQuality      = "jpegQuality"
+	CoreSummary          = "summary"
+)
+
+// size of the thumbnail placeholders are computed from
+const cPlaceholderSize = 32
+
+// tEntry is a single image while it is indexed
+type tEntry struct {
+	cfg     Config
+	path    string
+	image   imgmeta.Image
+	decoded image.Image        // decoded pixels, only read if a field needs them
+	thumb   *imgmeta.Thumbnail // thumbnail for placeholders
+	meta    *imgmeta.Metadata  // reconciled metadata, only read if a field needs it
+}
+
+func (e *tEntry) value(f Field) (interface{}, error) {
+	switch f.Type {
+	case FieldTypeCore:
+		return e.coreValue(f.ID)
+	case FieldTypeMWG:
+		return e.metadata().Value(f.ID)
+	}
+
+	// Every other type names a meta section of the image, e.g. 'exif', 'xmp' or 'png'.
+	// Numeric IDs are tags, all others are named properties.
+	section := strings.ToUpper(f.Type)
+	if !e.image.HasSection(section) {
+		return nil, fmt.Errorf("image has no '%s' section", section)
+	}
+	if tagID, err := strconv.ParseUint(f.ID, 0, 16); err == nil {
+		return e.image.ReadTagValue(section, uint16(tagID))
+	}
+	return e.image.ReadPropertyValue(section, f.ID)
+}
+
+func (e *tEntry) coreValue(id string) (interface{}, error) {
+	switch id {
+	case CoreFilename:
+		return filepath.Base(e.path), nil
+	case CoreFilenameRelative:
+		rel, err := filepath.Rel(e.cfg.Source, e.path)
+		if err != nil {
+			return nil, err
+		}
+		return filepath.ToSlash(rel), nil
+	case CoreVersion:
+		return e.cfg.Version, nil
+	case CoreFormat:
+		return e.image.Format(), nil
+	case CoreMediaType:
+		return e.image.MediaType(), nil
+	case CoreContentHash:
+		return e.image.ContentHash(e.cfg.HashAlgorithm)
+	case CoreDHash, CorePHash:
+		hash, err := e.perceptualHash(id)
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("%016x", hash), nil
+	case CoreBlurHash:
+		thumb, err := e.thumbnail()
+		if err != nil {
+			return nil, err
+		}
+		return thumb.BlurHash(e.cfg.BlurHashX, e.cfg.BlurHashY)
+	case CoreDominantColor:
+		thumb, err := e.thumbnail()
+		if err != nil {
+			return nil, err
+		}
+		return thumb.DominantColor(), nil
+	case CorePreview:
+		img, err := e.pixels()
+		if err != nil {
+			return nil, err
+		}
+		return imgmeta.NewThumbnail(img, e.cfg.PreviewSize).DataURI()
+	case CoreDisplayWidth:
+		width, _, err := e.image.DisplayDimensions()
+		return width, err
+	case CoreDisplayHeight:
+		_, height, err := e.image.DisplayDimensions()
+		return height, err
+	case CoreAspectRatio:
+		return e.image.AspectRatio()
+	case CoreOrientationLabel:
+		return imgmeta.OrientationLabel(e.image.Orientation()), nil
+	case CoreJpegQuality:
+		return e.image.JpegQuality()
+	case CoreSummary:
+		return e.image.Summary(), nil
+	}
+	return nil, fmt.Errorf("unknown core field '%s'", id)
+}
+
+func (e *tEntry) pixels() (image.Image, error) {
+	if e.decoded != nil {
+		return e.decoded, nil
+	}
+
+	fhnd, err := os.Open(e.path)
+	if err != nil {
+		return nil, err
+	}
+	defer fhnd.Close()
+
+	e.decoded, _, err = image.Decode(fhnd)
+	return e.decoded, err
+}
+
+func (e *tEntry) perceptualHash(id string) (uint64, error) {
+	img, err := e.pixels()
+	if err != nil {
+		return 0, err
+	}
+	if id == CoreDHash {
+		return imgmeta.DHash(img), nil
+	}
+	return imgmeta.PHash(img), nil
+}
+
+func (e *tEntry) metadata() *imgmeta.Metadata {
+	if e.meta == nil {
+		meta := e.image.Metadata()
+		e.meta = &meta
+	}
+	return e.meta
+}
+
+func (e *tEntry) thumbnail() (*imgmeta.Thumbnail, error) {
+	if e.thumb != nil {
+		return e.thumb, nil
+	}
+
+	img, err := e.pixels()
+	if err != nil {
+		return nil, err
+	}
+	thumb := imgmeta.NewThumbnail(img, cPlaceholderSize)
+	e.thumb = &thumb
+	return e.thumb, nil
+}
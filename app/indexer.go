@@ -18,48 +18,110 @@ limitations under the License.
 package app
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/kuetemeier/imgindex/imgmeta"
 )
 
-// Index start the index process
-func Index() {
+// Field is a single configured field of the index
+type Field struct {
+	Name string `mapstructure:"name"`
+	Type string `mapstructure:"type"`
+	ID   string `mapstructure:"id"`
+}
 
-	fhnd, err := os.Open("testdata/the-wall-sample.jpg")
-	if err != nil {
-		return
-	}
+// Config holds the settings of an index run
+type Config struct {
+	Source        string            // directory to crawl for images
+	Destination   string            // JSON file to write, the index is written to Out if empty
+	Fields        []Field           // fields to collect for every image
+	HashAlgorithm string            // algorithm of the 'contentHash' core field
+	BlurHashX     int               // horizontal components of the 'blurHash' core field
+	BlurHashY     int               // vertical components of the 'blurHash' core field
+	PreviewSize   int               // longer side in pixels of the 'preview' core field
+	Version       string            // version of the application, for the 'version' core field
+	XMPTargets    map[string]string // where XMP is written by format, see WriteXMP
+	Out           io.Writer         // output if no destination is set
+}
 
-	image, err := imgmeta.ReadJpeg(fhnd)
+// Index start the index process
+func Index(cfg Config) error {
+	entries := []map[string]interface{}{}
+
+	err := walkFiles(cfg, func(path string) error {
+		entry, err := indexFile(cfg, path)
+		if err == imgmeta.ErrUnknownFormat {
+			log.Debug(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		} else if err != nil {
+			log.Warn(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
 	if err != nil {
-		log.Error(err.Error())
-		return
+		return err
 	}
 
-	basicInfo := GetBasicInfo(image)
-	log.Info(fmt.Sprintf("Title: %v", basicInfo.Title))
-	log.Info(fmt.Sprintf("Image: width: %v, height: %v", basicInfo.Width, basicInfo.Height))
-	log.Info(fmt.Sprintf("Keywords: %v", basicInfo.Keywords))
-
+	log.Info(fmt.Sprintf("Indexed %d images", len(entries)))
+	return writeIndex(cfg, entries)
 }
 
-func processSourceDir() {
-
-	err := filepath.Walk("testdata",
+// walkFiles calls fn for every file in the source directory, hidden directories are skipped
+func walkFiles(cfg Config, fn func(path string) error) error {
+	return filepath.Walk(cfg.Source,
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			log.Println(path, info.Size())
-			return nil
+			if info.IsDir() {
+				if path != cfg.Source && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return fn(path)
 		})
+}
+
+func indexFile(cfg Config, path string) (map[string]interface{}, error) {
+	image, err := imgmeta.Open(path)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
 
+	entry := &tEntry{cfg: cfg, path: path, image: image}
+	values := map[string]interface{}{}
+	for _, field := range cfg.Fields {
+		value, err := entry.value(field)
+		if err != nil {
+			log.Debug(fmt.Sprintf("%s: field '%s': %v", path, field.Name, err))
+			continue
+		}
+		values[field.Name] = value
+	}
+	return values, nil
+}
+
+func writeIndex(cfg Config, entries []map[string]interface{}) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if cfg.Destination == "" {
+		_, err = cfg.Out.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(cfg.Destination, data, 0644)
 }
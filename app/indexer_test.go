@@ -1,15 +1,45 @@
 package app_test
 
 import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/kuetemeier/imgindex/app"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	//	. "github.com/kuetemeier/imgindex/app"
 )
 
 var _ = Describe("Indexer", func() {
 
-	It("Suite Test", func() {
-		Expect(true).Should(BeTrue())
+	It("should write the configured fields as JSON", func() {
+		out := bytes.NewBufferString("")
+		cfg := Config{
+			Source: "../testdata",
+			Fields: []Field{
+				{Name: "file", Type: FieldTypeCore, ID: CoreFilenameRelative},
+				{Name: "hash", Type: FieldTypeCore, ID: CoreContentHash},
+				{Name: "mediaType", Type: FieldTypeCore, ID: CoreMediaType},
+				{Name: "description", Type: FieldTypeMWG, ID: "description"},
+				{Name: "descriptionSource", Type: FieldTypeMWG, ID: "description/source"},
+				{Name: "city", Type: FieldTypeMWG, ID: "city"},
+				{Name: "summary", Type: FieldTypeCore, ID: CoreSummary},
+			},
+			Out: out,
+		}
+
+		Expect(Index(cfg)).Should(Succeed())
+
+		entries := []map[string]interface{}{}
+		Expect(json.Unmarshal(out.Bytes(), &entries)).Should(Succeed())
+		Expect(entries).Should(HaveLen(1))
+		Expect(entries[0]["file"]).Should(Equal("the-wall-sample.jpg"))
+		Expect(entries[0]["mediaType"]).Should(Equal("image"))
+		Expect(entries[0]["description"]).Should(Equal("Daten-Bildbeschreibung"))
+		Expect(entries[0]["descriptionSource"]).Should(Equal("EXIF"))
+		Expect(entries[0]).ShouldNot(HaveKey("city"))
+		Expect(entries[0]["summary"]).Should(HaveKeyWithValue("keywords", []interface{}{"test", "wall"}))
+		Expect(entries[0]["summary"]).Should(HaveKeyWithValue("lens", BeNil()))
+		Expect(entries[0]["hash"]).Should(Equal("0ec7275129f9b219a22d1f4c9992f72737aaa600629efad19f23aa623fc3d519"))
 	})
 
 })
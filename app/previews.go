@@ -0,0 +1,60 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kuetemeier/imgindex/imgmeta"
+	log "github.com/sirupsen/logrus"
+)
+
+// Previews extracts the largest embedded JPEG of every RAW file below cfg.Source into the directory output.
+// The preview of 'a/b.cr2' is written to 'output/a/b.jpg', every extracted file is reported on cfg.Out.
+func Previews(cfg Config, output string) error {
+	return walkFiles(cfg, func(path string) error {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Warn(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		}
+		defer file.Close()
+
+		image, err := imgmeta.Decode(file)
+		if err == imgmeta.ErrUnknownFormat {
+			return nil
+		} else if err != nil {
+			log.Warn(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		}
+		if !image.IsRaw() {
+			return nil
+		}
+
+		// the preview is read from the open file, so the RAW file is decoded only once
+		preview, err := image.Preview(file)
+		if err != nil {
+			log.Warn(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		}
+
+		rel, err := filepath.Rel(cfg.Source, path)
+		if err != nil {
+			return err
+		}
+		outRel := strings.TrimSuffix(rel, filepath.Ext(rel)) + ".jpg"
+		dst := filepath.Join(output, outRel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dst, preview.Data, 0644); err != nil {
+			return err
+		}
+		log.Debug(fmt.Sprintf("Preview of %s: %dx%d", path, preview.Width, preview.Height))
+
+		_, err = fmt.Fprintf(cfg.Out, "%s -> %s\n", filepath.ToSlash(rel), filepath.ToSlash(outRel))
+		return err
+	})
+}
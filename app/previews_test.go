@@ -0,0 +1,71 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/kuetemeier/imgindex/app"
+	"github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// minimalCR2 returns a CR2 whose IFD0 is a JPEG compressed strip with the given orientation
+func minimalCR2(orientation uint16) []byte {
+	buf := &bytes.Buffer{}
+	jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 32, 24)), nil)
+	full := buf.Bytes()
+
+	data := []byte{'I', 'I', 42, 0, 16, 0, 0, 0, 'C', 'R', 2, 0, 0, 0, 0, 0}
+	tags := [][]uint32{
+		{0x103, 3, 1, 6},
+		{0x111, 4, 1, 16 + 2 + 4*12 + 4},
+		{0x112, 3, 1, uint32(orientation)},
+		{0x117, 4, 1, uint32(len(full))},
+	}
+	data = append(data, byte(len(tags)), 0)
+	for _, tag := range tags {
+		entry := make([]byte, 12)
+		binary.LittleEndian.PutUint16(entry, uint16(tag[0]))
+		binary.LittleEndian.PutUint16(entry[2:], uint16(tag[1]))
+		binary.LittleEndian.PutUint32(entry[4:], tag[2])
+		binary.LittleEndian.PutUint32(entry[8:], tag[3])
+		data = append(data, entry...)
+	}
+	data = append(data, 0, 0, 0, 0)
+	return append(data, full...)
+}
+
+var _ = Describe("Previews", func() {
+
+	It("should extract the previews of RAW files only", func() {
+		dir, err := ioutil.TempDir("", "imgindex")
+		Expect(err).Should(BeNil())
+		defer os.RemoveAll(dir)
+
+		src := filepath.Join(dir, "src")
+		Expect(os.MkdirAll(filepath.Join(src, "2021"), 0755)).Should(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(src, "2021", "IMG_0001.CR2"), minimalCR2(8), 0644)).Should(Succeed())
+		data, err := ioutil.ReadFile("../testdata/the-wall-sample.jpg")
+		Expect(err).Should(BeNil())
+		Expect(ioutil.WriteFile(filepath.Join(src, "the-wall.jpg"), data, 0644)).Should(Succeed())
+
+		out := bytes.NewBufferString("")
+		output := filepath.Join(dir, "previews")
+		Expect(Previews(Config{Source: src, Out: out}, output)).Should(Succeed())
+		Expect(out.String()).Should(Equal("2021/IMG_0001.CR2 -> 2021/IMG_0001.jpg\n"))
+
+		preview, err := imgmeta.Open(filepath.Join(output, "2021", "IMG_0001.jpg"))
+		Expect(err).Should(BeNil())
+		Expect(preview.Orientation()).Should(Equal(uint16(8)))
+
+		_, err = os.Stat(filepath.Join(output, "the-wall.jpg"))
+		Expect(os.IsNotExist(err)).Should(BeTrue())
+	})
+
+})
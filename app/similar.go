@@ -0,0 +1,117 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/kuetemeier/imgindex/imgmeta"
+	log "github.com/sirupsen/logrus"
+)
+
+// Cluster is a group of images that look alike
+type Cluster struct {
+	Files       []string `json:"files"`       // relative paths of the images
+	MaxDistance int      `json:"maxDistance"` // largest Hamming distance within the cluster
+}
+
+type tHashedFile struct {
+	path string
+	hash uint64
+}
+
+// Similar writes all clusters of near-duplicate images as JSON to cfg.Out.
+// Two images belong to the same cluster if the Hamming distance of their perceptual hashes
+// (algorithm CoreDHash or CorePHash) is at most threshold.
+func Similar(cfg Config, algorithm string, threshold int) error {
+	if algorithm != CoreDHash && algorithm != CorePHash {
+		return fmt.Errorf("unknown perceptual hash '%s', use '%s' or '%s'", algorithm, CoreDHash, CorePHash)
+	}
+
+	files := []tHashedFile{}
+	err := walkFiles(cfg, func(path string) error {
+		image, err := imgmeta.Open(path)
+		if err == imgmeta.ErrUnknownFormat {
+			return nil
+		} else if err != nil {
+			log.Warn(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		}
+
+		entry := &tEntry{cfg: cfg, path: path, image: image}
+		hash, err := entry.perceptualHash(algorithm)
+		if err != nil {
+			log.Warn(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		}
+		rel, err := filepath.Rel(cfg.Source, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, tHashedFile{path: filepath.ToSlash(rel), hash: hash})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(clusterFiles(files, threshold), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = cfg.Out.Write(append(data, '\n'))
+	return err
+}
+
+// clusterFiles groups files with single linkage: a file joins a cluster if it is close
+// to at least one of its members
+func clusterFiles(files []tHashedFile, threshold int) []Cluster {
+	parent := make([]int, len(files))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range files {
+		for j := i + 1; j < len(files); j++ {
+			if imgmeta.HammingDistance(files[i].hash, files[j].hash) <= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	for i := range files {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	clusters := []Cluster{}
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		cluster := Cluster{}
+		for n, i := range members {
+			cluster.Files = append(cluster.Files, files[i].path)
+			for _, j := range members[n+1:] {
+				if d := imgmeta.HammingDistance(files[i].hash, files[j].hash); d > cluster.MaxDistance {
+					cluster.MaxDistance = d
+				}
+			}
+		}
+		sort.Strings(cluster.Files)
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Files[0] < clusters[j].Files[0]
+	})
+	return clusters
+}
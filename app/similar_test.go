@@ -0,0 +1,66 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/kuetemeier/imgindex/app"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// writeScaledCopy writes a re-compressed copy of a JPEG with half the size
+func writeScaledCopy(src, dst string) {
+	fhnd, err := os.Open(src)
+	Expect(err).Should(BeNil())
+	defer fhnd.Close()
+	img, err := jpeg.Decode(fhnd)
+	Expect(err).Should(BeNil())
+
+	b := img.Bounds()
+	small := image.NewRGBA(image.Rect(0, 0, b.Dx()/2, b.Dy()/2))
+	for y := 0; y < b.Dy()/2; y++ {
+		for x := 0; x < b.Dx()/2; x++ {
+			small.Set(x, y, img.At(b.Min.X+2*x, b.Min.Y+2*y))
+		}
+	}
+
+	out, err := os.Create(dst)
+	Expect(err).Should(BeNil())
+	defer out.Close()
+	Expect(jpeg.Encode(out, small, &jpeg.Options{Quality: 40})).Should(Succeed())
+}
+
+var _ = Describe("Similar", func() {
+
+	It("should cluster re-exported copies of an image", func() {
+		dir, err := ioutil.TempDir("", "imgindex")
+		Expect(err).Should(BeNil())
+		defer os.RemoveAll(dir)
+
+		data, err := ioutil.ReadFile("../testdata/the-wall-sample.jpg")
+		Expect(err).Should(BeNil())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "original.jpg"), data, 0644)).Should(Succeed())
+		writeScaledCopy("../testdata/the-wall-sample.jpg", filepath.Join(dir, "small.jpg"))
+
+		for _, algorithm := range []string{CoreDHash, CorePHash} {
+			out := bytes.NewBufferString("")
+			Expect(Similar(Config{Source: dir, Out: out}, algorithm, 10)).Should(Succeed())
+
+			clusters := []Cluster{}
+			Expect(json.Unmarshal(out.Bytes(), &clusters)).Should(Succeed())
+			Expect(clusters).Should(HaveLen(1))
+			Expect(clusters[0].Files).Should(Equal([]string{"original.jpg", "small.jpg"}))
+		}
+	})
+
+	It("should reject unknown hashes", func() {
+		Expect(Similar(Config{Source: "../testdata"}, "md5", 10)).ShouldNot(Succeed())
+	})
+
+})
@@ -0,0 +1,298 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kuetemeier/imgindex/imgmeta"
+	log "github.com/sirupsen/logrus"
+)
+
+// StripProfile selects the metadata that Strip removes. Deny and Allow name groups (see aStripGroups) or tags
+// like 'EXIF:GPSLatitude', 'IPTC:Byline' and 'XMP:aux:SerialNumber', a trailing '*' matches the rest of a
+// name and a section alone ('EXIF', 'IPTC', 'XMP', 'COM') all of its tags. Allowed tags are kept, even if
+// they are denied.
+type StripProfile struct {
+	Allow []string `mapstructure:"allow"`
+	Deny  []string `mapstructure:"deny"`
+}
+
+// aStripSections are the sections a profile can name, COM are the comment segments of a JPEG
+var aStripSections = []string{"EXIF", "IPTC", "XMP", "COM"}
+
+// aStripGroups are the groups of tags a profile can name
+var aStripGroups = map[string][]string{
+	"gps":        {"EXIF:GPS*", "XMP:exif:GPS*"},
+	"makernotes": {"EXIF:MakerNote"},
+	"serials": {"EXIF:BodySerialNumber", "EXIF:LensSerialNumber", "XMP:aux:SerialNumber", "XMP:aux:LensSerialNumber",
+		"XMP:exifEX:BodySerialNumber", "XMP:exifEX:LensSerialNumber"},
+	"owner": {"EXIF:CameraOwnerName", "XMP:aux:OwnerName", "XMP:exifEX:CameraOwnerName"},
+	"location": {"IPTC:City", "IPTC:SubLocation", "IPTC:ProvinceState", "IPTC:CountryCode", "IPTC:CountryName",
+		"XMP:photoshop:City", "XMP:photoshop:State", "XMP:photoshop:Country", "XMP:Iptc4xmpCore:Location",
+		"XMP:Iptc4xmpCore:CountryCode", "XMP:Iptc4xmpExt:LocationCreated", "XMP:Iptc4xmpExt:LocationShown"},
+	"comments":  {"COM", "EXIF:UserComment", "EXIF:XPComment"},
+	"history":   {"XMP:xmpMM:*", "XMP:photoshop:DocumentAncestors"},
+	"copyright": {"EXIF:Copyright", "IPTC:Copyright", "XMP:dc:rights"},
+	"creator": {"EXIF:Artist", "EXIF:XPAuthor", "IPTC:Byline", "IPTC:BylineTitle", "XMP:dc:creator",
+		"XMP:Iptc4xmpCore:CreatorContactInfo"},
+	"licensing": {"XMP:xmpRights:*", "XMP:cc:*", "XMP:plus:*"},
+}
+
+// tStripRules are the tag selectors of a profile, with the groups resolved
+type tStripRules struct {
+	allow []string
+	deny  []string
+}
+
+// stripSelectors resolves the groups of a list of a profile
+func stripSelectors(entries []string) ([]string, error) {
+	selectors := []string{}
+	for _, entry := range entries {
+		if strings.Contains(entry, ":") {
+			selectors = append(selectors, entry)
+			continue
+		}
+		if group, ok := aStripGroups[strings.ToLower(entry)]; ok {
+			selectors = append(selectors, group...)
+			continue
+		}
+		known := false
+		for _, section := range aStripSections {
+			known = known || strings.EqualFold(section, entry)
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown strip group '%s'", entry)
+		}
+		selectors = append(selectors, entry)
+	}
+	return selectors, nil
+}
+
+func newStripRules(profile StripProfile) (tStripRules, error) {
+	allow, err := stripSelectors(profile.Allow)
+	if err != nil {
+		return tStripRules{}, err
+	}
+	deny, err := stripSelectors(profile.Deny)
+	if err != nil {
+		return tStripRules{}, err
+	}
+	return tStripRules{allow: allow, deny: deny}, nil
+}
+
+// stripMatch reports whether a selector matches a tag like 'EXIF:GPSLatitude'
+func stripMatch(selector string, tag string) bool {
+	section, name := tag, ""
+	if i := strings.Index(tag, ":"); i >= 0 {
+		section, name = tag[:i], tag[i+1:]
+	}
+	parts := strings.SplitN(selector, ":", 2)
+	if !strings.EqualFold(parts[0], section) {
+		return false
+	}
+	if len(parts) == 1 {
+		return true
+	}
+	if strings.HasSuffix(parts[1], "*") {
+		return strings.HasPrefix(strings.ToLower(name), strings.ToLower(strings.TrimSuffix(parts[1], "*")))
+	}
+	return strings.EqualFold(parts[1], name)
+}
+
+// removes reports whether a tag is denied and not allowed
+func (r tStripRules) removes(tag string) bool {
+	matches := func(selectors []string) bool {
+		for _, selector := range selectors {
+			if stripMatch(selector, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return matches(r.deny) && !matches(r.allow)
+}
+
+// Strip removes the metadata selected by the profile from every JPEG below cfg.Source, through a JpegWriter so
+// that the image data is kept as it is. The removed tags of every file are reported on cfg.Out, together with
+// the tags that are lost because the EXIF can not be written again as it was. With dryRun the files are not
+// changed.
+func Strip(cfg Config, profile StripProfile, dryRun bool) error {
+	rules, err := newStripRules(profile)
+	if err != nil {
+		return err
+	}
+	return walkFiles(cfg, func(path string) error {
+		image, err := imgmeta.Open(path)
+		if err == imgmeta.ErrUnknownFormat {
+			return nil
+		} else if err != nil {
+			log.Warn(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		}
+
+		rel, err := filepath.Rel(cfg.Source, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if image.Format() != "jpeg" {
+			_, err = fmt.Fprintf(cfg.Out, "%s: skipped, only JPEG files can be stripped\n", rel)
+			return err
+		}
+
+		removed, dropped, err := stripJpeg(rules, path, dryRun)
+		if err != nil {
+			log.Warn(fmt.Sprintf("Skipping %s: %v", path, err))
+			return nil
+		}
+		if len(removed) == 0 {
+			_, err = fmt.Fprintf(cfg.Out, "%s: nothing to remove\n", rel)
+			return err
+		}
+		remove, drop := "removed", "also dropped"
+		if dryRun {
+			remove, drop = "would remove", "would also drop"
+		}
+		report := remove + " " + strings.Join(removed, ", ")
+		if len(dropped) > 0 {
+			report += fmt.Sprintf("; %s %s (can not be written again)", drop, strings.Join(dropped, ", "))
+		}
+		_, err = fmt.Fprintf(cfg.Out, "%s: %s\n", rel, report)
+		return err
+	})
+}
+
+// stripJpeg removes the tags selected by the rules from a JPEG and returns them, with the tags that are lost on
+// the way. The file is only written without dryRun.
+func stripJpeg(rules tStripRules, path string, dryRun bool) ([]string, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	writer, err := imgmeta.NewJpegWriter(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	removed, dropped := []string{}, []string{}
+	for _, strip := range []tStripFunc{stripComments, stripExif, stripIPTC, stripXMP} {
+		tags, lost, err := strip(writer, rules)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed, dropped = append(removed, tags...), append(dropped, lost...)
+	}
+
+	if dryRun || len(removed) == 0 {
+		return removed, dropped, nil
+	}
+	writer.PreserveMode = true
+	return removed, dropped, writer.WriteFile(path)
+}
+
+// tStripFunc removes the tags of a section that the rules select and returns them, with the tags of the section
+// that are lost because it can not be written again as it was
+type tStripFunc func(writer *imgmeta.JpegWriter, rules tStripRules) (removed []string, dropped []string, err error)
+
+func stripComments(writer *imgmeta.JpegWriter, rules tStripRules) ([]string, []string, error) {
+	if writer.Find(imgmeta.MarkerCOM, nil) < 0 || !rules.removes("COM") {
+		return nil, nil, nil
+	}
+	_, err := writer.Delete(imgmeta.MarkerCOM, nil)
+	return []string{"COM"}, nil, err
+}
+
+func stripExif(writer *imgmeta.JpegWriter, rules tStripRules) ([]string, []string, error) {
+	editor, err := writer.Exif()
+	if err != nil {
+		return nil, nil, err
+	}
+	removed := []string{}
+	for _, ifd := range []uint16{imgmeta.ExifIFD0, imgmeta.ExifIFDExif, imgmeta.ExifIFDGPS, imgmeta.ExifIFDInterop} {
+		for _, id := range editor.Tags(ifd) {
+			tag := "EXIF:" + imgmeta.ExifTagName(ifd, id)
+			if rules.removes(tag) {
+				editor.Delete(ifd, id)
+				removed = append(removed, tag)
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil, nil
+	}
+
+	// the editor can not lay out SubIFDs and other IFDs again, nor an IFD1 without a JPEG thumbnail
+	dropped := []string{}
+	for _, tag := range editor.Dropped() {
+		name := "EXIF:" + imgmeta.ExifTagName(tag.IFD, tag.ID)
+		if tag.IFD == imgmeta.ExifIFD1 {
+			name = "EXIF:IFD1:" + imgmeta.ExifTagName(tag.IFD, tag.ID)
+		}
+		dropped = append(dropped, name)
+	}
+	return removed, dropped, writer.SetExif(editor)
+}
+
+func stripIPTC(writer *imgmeta.JpegWriter, rules tStripRules) ([]string, []string, error) {
+	tags, removed := []uint16{}, []string{}
+	for _, tag := range writer.IPTCTags() {
+		// the character set and the record version describe the other datasets
+		if tag == imgmeta.IptcTagEnvelopeCharacterSet || tag == imgmeta.IptcTagApplication2RecordVersion {
+			continue
+		}
+		name := "IPTC:" + imgmeta.IPTCTagName(tag)
+		if rules.removes(name) {
+			tags = append(tags, tag)
+			removed = append(removed, name)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, nil, nil
+	}
+	// only the removed datasets are cut out, all others are kept as they are stored
+	return removed, nil, writer.DeleteIPTC(tags...)
+}
+
+func stripXMP(writer *imgmeta.JpegWriter, rules tStripRules) ([]string, []string, error) {
+	editor, err := writer.XMP()
+	if err != nil {
+		return nil, nil, err
+	}
+	packet, err := editor.Encode()
+	if err != nil {
+		return nil, nil, err
+	}
+	xmp, err := imgmeta.ParseXMP(packet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// fields of structures are removed with their property
+	names := []string{}
+	seen := map[string]bool{}
+	for name := range xmp.Properties() {
+		name = strings.SplitN(name, "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	removed := []string{}
+	for _, name := range names {
+		tag := "XMP:" + name
+		if rules.removes(tag) {
+			editor.Delete(name)
+			removed = append(removed, tag)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil, nil
+	}
+	return removed, nil, writer.SetXMP(editor)
+}
@@ -0,0 +1,156 @@
+package app_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/kuetemeier/imgindex/app"
+	"github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strip", func() {
+
+	var dir, jpegPath string
+	var out *bytes.Buffer
+	web := StripProfile{
+		Deny:  []string{"gps", "makernotes", "serials", "owner"},
+		Allow: []string{"copyright", "creator", "licensing"},
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "imgindex")
+		Expect(err).Should(BeNil())
+		out = &bytes.Buffer{}
+		jpegPath = filepath.Join(dir, "the-wall.jpg")
+		Expect(ioutil.WriteFile(filepath.Join(dir, "IMG_0001.CR2"), minimalCR2(1), 0644)).Should(Succeed())
+
+		// the sample with a position, serial numbers, an owner and a MakerNote
+		file, err := os.Open("../testdata/the-wall-sample.jpg")
+		Expect(err).Should(BeNil())
+		defer file.Close()
+		writer, err := imgmeta.NewJpegWriter(file)
+		Expect(err).Should(BeNil())
+		exif, err := writer.Exif()
+		Expect(err).Should(BeNil())
+		Expect(exif.Set(imgmeta.ExifIFDGPS, imgmeta.ExifGpsTagGPSLatitudeRef, "N")).Should(Succeed())
+		Expect(exif.Set(imgmeta.ExifIFDGPS, imgmeta.ExifGpsTagGPSLatitude,
+			[]imgmeta.ExifRational{{Numerator: 52, Denominator: 1}, {Numerator: 31, Denominator: 1}, {Numerator: 12, Denominator: 1}})).Should(Succeed())
+		Expect(exif.Set(imgmeta.ExifIFDExif, imgmeta.ExifTagBodySerialNumber, "012345")).Should(Succeed())
+		Expect(exif.Set(imgmeta.ExifIFDExif, imgmeta.ExifTagCameraOwnerName, "Jane Doe")).Should(Succeed())
+		Expect(exif.Set(imgmeta.ExifIFDExif, imgmeta.ExifTagMakerNote, []byte("Canon maker note"))).Should(Succeed())
+		Expect(writer.SetExif(exif)).Should(Succeed())
+		xmp, err := writer.XMP()
+		Expect(err).Should(BeNil())
+		Expect(xmp.Set("aux:SerialNumber", "012345")).Should(Succeed())
+		Expect(xmp.Set("dc:rights", "Jane Doe")).Should(Succeed())
+		Expect(writer.SetXMP(xmp)).Should(Succeed())
+		Expect(writer.WriteFile(jpegPath)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should only report what would be removed in a dry run", func() {
+		before, err := ioutil.ReadFile(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(Strip(Config{Source: dir, Out: out}, web, true)).Should(Succeed())
+		Expect(out.String()).Should(Equal("IMG_0001.CR2: skipped, only JPEG files can be stripped\n" +
+			"the-wall.jpg: would remove EXIF:MakerNote, EXIF:CameraOwnerName, EXIF:BodySerialNumber, " +
+			"EXIF:GPSLatitudeRef, EXIF:GPSLatitude, XMP:aux:SerialNumber, XMP:exifEX:BodySerialNumber\n"))
+		after, err := ioutil.ReadFile(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(after).Should(Equal(before))
+	})
+
+	It("should remove the denied tags and keep the image data and the allowed tags", func() {
+		before, err := imgmeta.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		hash, err := before.ContentHash(imgmeta.HashSHA256)
+		Expect(err).Should(BeNil())
+
+		Expect(Strip(Config{Source: dir, Out: out}, web, false)).Should(Succeed())
+		Expect(out.String()).Should(ContainSubstring("the-wall.jpg: removed EXIF:MakerNote"))
+		image, err := imgmeta.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(image.ContentHash(imgmeta.HashSHA256)).Should(Equal(hash))
+		Expect(image.ReadTagValue("EXIF", imgmeta.ExifTagArtist)).Should(Equal("Daten-Künstler"))
+		Expect(image.ReadPropertyValue("XMP", "dc:rights")).Should(Equal("Jane Doe"))
+		Expect(image.ReadPropertyValue("IPTC", "Keywords")).Should(Equal([]string{"test", "wall"}))
+		_, err = image.ReadPropertyValue("XMP", "aux:SerialNumber")
+		Expect(err).ShouldNot(BeNil())
+		_, err = image.ReadPropertyValue("XMP", "exifEX:BodySerialNumber")
+		Expect(err).ShouldNot(BeNil())
+		_, err = image.ReadTagValue("EXIF", imgmeta.ExifTagBodySerialNumber)
+		Expect(err).ShouldNot(BeNil())
+		_, err = image.ReadTagValue("EXIF", imgmeta.ExifTagCameraOwnerName)
+		Expect(err).ShouldNot(BeNil())
+		Expect(image.Summary().GPSLatitude).Should(BeNil())
+
+		out.Reset()
+		Expect(Strip(Config{Source: dir, Out: out}, web, false)).Should(Succeed())
+		Expect(out.String()).Should(ContainSubstring("the-wall.jpg: nothing to remove"))
+	})
+
+	It("should keep the datasets it does not remove and report the tags it loses", func() {
+		file, err := os.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		defer file.Close()
+		writer, err := imgmeta.NewJpegWriter(file)
+		Expect(err).Should(BeNil())
+
+		// IFD0 with the Model and SubIFDs, and an IFD1 without a JPEG thumbnail
+		tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 2,
+			0x01, 0x10, 0, 2, 0, 0, 0, 2, 'X', 0, 0, 0,
+			0x01, 0x4A, 0, 4, 0, 0, 0, 1, 0, 0, 0, 38,
+			0, 0, 0, 38, 0, 1,
+			0x01, 0x03, 0, 3, 0, 0, 0, 1, 0, 1, 0, 0,
+			0, 0, 0, 0}
+		Expect(writer.Replace([]byte("Exif\x00\x00"), imgmeta.Segment{
+			Marker: imgmeta.MarkerAPP0 + 1, Payload: append([]byte("Exif\x00\x00"), tiff...)})).Should(Succeed())
+		kept := "\x1c\x01\x14\x00\x02\x00\x01" + // 1:20 FileFormat
+			"\x1c\x02\x5a\x00\x04K\xf6ln" + // 2:90 City in Latin-1
+			"\x1c\x02\xdd\x00\x07unknown" // 2:221, which is not defined
+		iptc := []byte(kept + "\x1c\x02\x19\x00\x05mauer") // 2:25 Keywords
+		resource := append([]byte("8BIM\x04\x04\x00\x00\x00\x00\x00"), byte(len(iptc)))
+		Expect(writer.Replace([]byte("Photoshop 3.0\x00"), imgmeta.Segment{
+			Marker: imgmeta.MarkerAPP0 + 13, Payload: append(append([]byte("Photoshop 3.0\x00"), resource...), iptc...)})).Should(Succeed())
+		Expect(writer.WriteFile(jpegPath)).Should(Succeed())
+
+		profile := StripProfile{Deny: []string{"EXIF:Model", "IPTC:Keywords"}}
+		Expect(Strip(Config{Source: dir, Out: out}, profile, true)).Should(Succeed())
+		Expect(out.String()).Should(ContainSubstring("the-wall.jpg: would remove EXIF:Model, IPTC:Keywords; " +
+			"would also drop EXIF:SubIFDs, EXIF:IFD1:Compression (can not be written again)\n"))
+
+		Expect(Strip(Config{Source: dir, Out: out}, profile, false)).Should(Succeed())
+		image, err := imgmeta.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("IPTC", "City")).Should(Equal("Köln"))
+		_, err = image.ReadPropertyValue("IPTC", "Keywords")
+		Expect(err).ShouldNot(BeNil())
+		data, err := ioutil.ReadFile(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(bytes.Contains(data, []byte(kept))).Should(BeTrue())
+	})
+
+	It("should keep allowed tags of denied sections and reject unknown groups", func() {
+		profile := StripProfile{Deny: []string{"EXIF", "IPTC:*"}, Allow: []string{"copyright", "EXIF:Model"}}
+		Expect(Strip(Config{Source: dir, Out: out}, profile, false)).Should(Succeed())
+		image, err := imgmeta.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(image.ReadTagValue("EXIF", imgmeta.ExifTagModel)).Should(Equal("Kamera-Modell"))
+		_, err = image.ReadTagValue("EXIF", imgmeta.ExifTagArtist)
+		Expect(err).ShouldNot(BeNil())
+		_, err = image.ReadPropertyValue("IPTC", "Keywords")
+		Expect(err).ShouldNot(BeNil())
+		Expect(image.ReadPropertyValue("IPTC", "Copyright")).ShouldNot(BeEmpty())
+
+		Expect(Strip(Config{Source: dir, Out: out}, StripProfile{Deny: []string{"secrets"}}, true)).ShouldNot(Succeed())
+	})
+
+})
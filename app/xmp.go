@@ -0,0 +1,97 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kuetemeier/imgindex/imgmeta"
+)
+
+// Targets of Config.XMPTargets
+const (
+	XMPEmbedded = "embedded" // into the image, only for JPEG
+	XMPSidecar  = "sidecar"  // into an XMP file next to the image
+)
+
+// aDefaultXMPTargets are used for the formats that Config.XMPTargets does not name
+var aDefaultXMPTargets = map[string]string{"jpeg": XMPEmbedded, "default": XMPSidecar}
+
+// xmpTarget returns where the XMP of an image is written. Config.XMPTargets is looked up by the format
+// (e.g. 'cr2'), then by 'raw' for RAW files and then by 'default'.
+func xmpTarget(cfg Config, image imgmeta.Image) string {
+	keys := []string{image.Format()}
+	if image.IsRaw() {
+		keys = append(keys, "raw")
+	}
+	keys = append(keys, "default")
+	for _, targets := range []map[string]string{cfg.XMPTargets, aDefaultXMPTargets} {
+		for _, key := range keys {
+			if target, ok := targets[key]; ok {
+				return target
+			}
+		}
+	}
+	return XMPSidecar
+}
+
+// WriteXMP changes the XMP of the image at path with edit and writes it into the image or its sidecar, as
+// configured in cfg.XMPTargets. It returns the path of the written file.
+func WriteXMP(cfg Config, path string, edit func(editor *imgmeta.XMPEditor) error) (string, error) {
+	image, err := imgmeta.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	switch target := xmpTarget(cfg, image); target {
+	case XMPSidecar:
+		editor, err := imgmeta.OpenXMPSidecar(path)
+		if err != nil {
+			return "", err
+		}
+		if err := edit(editor); err != nil {
+			return "", err
+		}
+		return imgmeta.XMPSidecar(path), imgmeta.WriteXMPSidecar(path, editor)
+
+	case XMPEmbedded:
+		if image.Format() != "jpeg" {
+			return "", fmt.Errorf("embedded XMP can not be written to %s files", image.Format())
+		}
+		return path, updateJpeg(path, func(writer *imgmeta.JpegWriter) error {
+			return editJpegXMP(writer, edit)
+		})
+
+	default:
+		return "", fmt.Errorf("unknown XMP target '%s'", target)
+	}
+}
+
+// editJpegXMP changes the embedded XMP of a JPEG with edit
+func editJpegXMP(writer *imgmeta.JpegWriter, edit func(editor *imgmeta.XMPEditor) error) error {
+	editor, err := writer.XMP()
+	if err != nil {
+		return err
+	}
+	if err := edit(editor); err != nil {
+		return err
+	}
+	return writer.SetXMP(editor)
+}
+
+// updateJpeg changes the segments of the JPEG at path with update and replaces the file, keeping its mode
+func updateJpeg(path string, update func(writer *imgmeta.JpegWriter) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer, err := imgmeta.NewJpegWriter(file)
+	if err != nil {
+		return err
+	}
+	if err := update(writer); err != nil {
+		return err
+	}
+	writer.PreserveMode = true
+	return writer.WriteFile(path)
+}
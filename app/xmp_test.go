@@ -0,0 +1,73 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/kuetemeier/imgindex/app"
+	"github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WriteXMP", func() {
+
+	var dir, jpegPath, rawPath string
+	var original []byte
+
+	setTitle := func(editor *imgmeta.XMPEditor) error {
+		return editor.Set("dc:title", "Die Mauer")
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "imgindex")
+		Expect(err).Should(BeNil())
+		original, err = ioutil.ReadFile("../testdata/the-wall-sample.jpg")
+		Expect(err).Should(BeNil())
+		jpegPath = filepath.Join(dir, "the-wall.jpg")
+		Expect(ioutil.WriteFile(jpegPath, original, 0600)).Should(Succeed())
+		rawPath = filepath.Join(dir, "IMG_0001.CR2")
+		Expect(ioutil.WriteFile(rawPath, minimalCR2(1), 0644)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should embed the XMP of JPEGs and write sidecars for RAW files", func() {
+		written, err := WriteXMP(Config{}, jpegPath, setTitle)
+		Expect(err).Should(BeNil())
+		Expect(written).Should(Equal(jpegPath))
+		image, err := imgmeta.Open(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("Die Mauer"))
+		info, err := os.Stat(jpegPath)
+		Expect(err).Should(BeNil())
+		Expect(info.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+
+		written, err = WriteXMP(Config{}, rawPath, setTitle)
+		Expect(err).Should(BeNil())
+		Expect(written).Should(Equal(filepath.Join(dir, "IMG_0001.xmp")))
+		packet, err := ioutil.ReadFile(written)
+		Expect(err).Should(BeNil())
+		xmp, err := imgmeta.ParseXMP(packet)
+		Expect(err).Should(BeNil())
+		Expect(xmp.Properties()["dc:title"]).Should(Equal("Die Mauer"))
+	})
+
+	It("should follow the configured targets", func() {
+		cfg := Config{XMPTargets: map[string]string{"jpeg": XMPSidecar, "raw": XMPEmbedded}}
+		written, err := WriteXMP(cfg, jpegPath, setTitle)
+		Expect(err).Should(BeNil())
+		Expect(written).Should(Equal(filepath.Join(dir, "the-wall.xmp")))
+		Expect(ioutil.ReadFile(jpegPath)).Should(Equal(original))
+
+		_, err = WriteXMP(cfg, rawPath, setTitle)
+		Expect(err).ShouldNot(BeNil())
+		_, err = WriteXMP(Config{XMPTargets: map[string]string{"default": "cloud"}}, rawPath, setTitle)
+		Expect(err).ShouldNot(BeNil())
+	})
+
+})
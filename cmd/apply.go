@@ -0,0 +1,75 @@
+/*
+Copyright © 2020 Jörg Kütemeier <joerg@kuetemeier.de>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/kuetemeier/imgindex/app"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// applyCmd represents the 'apply' command
+var applyCmd = &cobra.Command{
+	Use:   "apply <spreadsheet>",
+	Short: "write captions and keywords from a CSV or JSON spreadsheet into images",
+	Long: `Write captions and keywords from a CSV or JSON spreadsheet into images.
+
+	Every row names an image by its path relative to the source directory or by its name, in a 'file' column.
+	The other columns are written to the fields configured in 'apply.columns', e.g. the IPTC caption and
+	dc:description of the XMP. Empty cells are skipped, and values of images whose metadata is newer than the
+	spreadsheet are kept. XMP is written into the image or a sidecar as configured in 'xmp.targets'.
+	With --dry-run, the values that would change are reported as a diff.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run:  runApply,
+}
+
+func init() {
+	RootCmd.AddCommand(applyCmd)
+
+	viper.SetDefault("apply.columns", []app.ApplyColumn{
+		{Column: "title", Type: app.ApplyTypeXMP, ID: "dc:title"},
+		{Column: "caption", Type: app.ApplyTypeIPTC, ID: "description"},
+		{Column: "caption", Type: app.ApplyTypeXMP, ID: "dc:description"},
+		{Column: "keywords", Type: app.ApplyTypeIPTC, ID: "Keywords", Separator: ";"},
+		{Column: "keywords", Type: app.ApplyTypeXMP, ID: "dc:subject", Separator: ";"},
+	})
+
+	applyCmd.Flags().Bool("dry-run", false, "Only report the values that would change")
+}
+
+func runApply(cmd *cobra.Command, args []string) {
+	log.Info("Applying spreadsheet " + args[0] + ".")
+
+	columns := []app.ApplyColumn{}
+	if err := viper.UnmarshalKey("apply.columns", &columns); err != nil {
+		log.Error(err.Error())
+		return
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	cfg := app.Config{
+		Source:     viper.GetString("source"),
+		XMPTargets: viper.GetStringMapString("xmp.targets"),
+		Out:        cmd.OutOrStdout(),
+	}
+
+	if err := app.Apply(cfg, args[0], columns, dryRun); err != nil {
+		log.Error(err.Error())
+	}
+}
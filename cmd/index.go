@@ -21,6 +21,7 @@ import (
 	"github.com/kuetemeier/imgindex/app"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // indexCmd represents the filter command
@@ -51,5 +52,19 @@ func init() {
 func run(cmd *cobra.Command, args []string) {
 	log.Info("Indexing meta data.")
 
-	app.Index()
+	cfg := app.Config{
+		Source:        viper.GetString("source"),
+		Destination:   viper.GetString("destination"),
+		Fields:        fields,
+		HashAlgorithm: viper.GetString("hashAlgorithm"),
+		BlurHashX:     viper.GetInt("blurHash.componentsX"),
+		BlurHashY:     viper.GetInt("blurHash.componentsY"),
+		PreviewSize:   viper.GetInt("preview.size"),
+		Version:       version,
+		Out:           cmd.OutOrStdout(),
+	}
+
+	if err := app.Index(cfg); err != nil {
+		log.Error(err.Error())
+	}
 }
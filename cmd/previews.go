@@ -0,0 +1,57 @@
+/*
+Copyright © 2020 Jörg Kütemeier <joerg@kuetemeier.de>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/kuetemeier/imgindex/app"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// previewsCmd represents the 'previews' command
+var previewsCmd = &cobra.Command{
+	Use:   "previews",
+	Short: "extract the embedded JPEGs of RAW files",
+	Long: `Extract the embedded JPEGs of RAW files.
+
+	The largest JPEG embedded in every RAW file (CR2, CR3, NEF, ARW, ORF, RW2, DNG) is written to the
+	output directory, with the orientation and the key EXIF and XMP metadata of the RAW file.
+	`,
+	Run: runPreviews,
+}
+
+func init() {
+	RootCmd.AddCommand(previewsCmd)
+
+	viper.SetDefault("previews.output", "previews")
+	previewsCmd.Flags().StringP("output", "o", "previews", "Directory to write the previews to")
+	viper.BindPFlag("previews.output", previewsCmd.Flags().Lookup("output"))
+}
+
+func runPreviews(cmd *cobra.Command, args []string) {
+	log.Info("Extracting previews of RAW files.")
+
+	cfg := app.Config{
+		Source: viper.GetString("source"),
+		Out:    cmd.OutOrStdout(),
+	}
+
+	if err := app.Previews(cfg, viper.GetString("previews.output")); err != nil {
+		log.Error(err.Error())
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/kuetemeier/imgindex/app"
+	"github.com/kuetemeier/imgindex/imgmeta"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -68,12 +70,8 @@ eyes : brown
 beard: true
 `)
 
-type tField struct {
-	Name     string `mapstructure:"name"`
-	Type     string `mapstructure:"type"`
-	ID       string `mapstructure:"id"`
-	NewField string
-}
+// fields holds the configured index fields, see processConfig
+var fields []app.Field
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -110,7 +108,18 @@ func init() {
 
 	RootCmd.Version = version
 
-	viper.SetDefault("fields", []tField{})
+	viper.SetDefault("source", ".")
+	viper.SetDefault("destination", "")
+	viper.SetDefault("hashAlgorithm", imgmeta.HashSHA256)
+	viper.SetDefault("blurHash.componentsX", 4)
+	viper.SetDefault("blurHash.componentsY", 3)
+	viper.SetDefault("preview.size", 16)
+	viper.SetDefault("xmp.targets", map[string]string{"jpeg": app.XMPEmbedded, "raw": app.XMPSidecar, "default": app.XMPSidecar})
+	viper.SetDefault("fields", []app.Field{
+		{Name: "filename", Type: app.FieldTypeCore, ID: app.CoreFilename},
+		{Name: "filenameRel", Type: app.FieldTypeCore, ID: app.CoreFilenameRelative},
+		{Name: "version", Type: app.FieldTypeCore, ID: app.CoreVersion},
+	})
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
@@ -222,13 +231,7 @@ func configureLog() {
 
 func processConfig() {
 
-	//type tFields []tField
-	type tFields struct {
-		Collection []tField
-	}
-
-	//var fieldList tField
-	fieldList := make([]tField, 0)
+	fieldList := make([]app.Field, 0)
 
 	log.Debugf("fiels: %v", viper.Get("fields"))
 	log.Debugln()
@@ -238,11 +241,6 @@ func processConfig() {
 		log.Fatal("unable to decode 'fields' configuration into struct:", err)
 	}
 
-	if len(fieldList) > 0 {
-		var f tField
-		f = fieldList[0]
-
-		log.Debug(fmt.Sprintf("fieldList: %v", fieldList))
-		log.Debug(fmt.Sprintf("f: %v", f.ID))
-	}
+	log.Debug(fmt.Sprintf("fieldList: %v", fieldList))
+	fields = fieldList
 }
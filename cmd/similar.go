@@ -0,0 +1,62 @@
+/*
+Copyright © 2020 Jörg Kütemeier <joerg@kuetemeier.de>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cmd holds all commands.
+package cmd
+
+import (
+	"github.com/kuetemeier/imgindex/app"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// similarCmd represents the 'similar' command
+var similarCmd = &cobra.Command{
+	Use:   "similar",
+	Short: "find near-duplicate images",
+	Long: `Find near-duplicate images.
+
+	Images are compared by a perceptual hash (dHash or pHash) of their pixels.
+	Images whose hashes differ in at most 'threshold' bits are reported as a cluster (JSON).
+	`,
+	Run: runSimilar,
+}
+
+func init() {
+	RootCmd.AddCommand(similarCmd)
+
+	viper.SetDefault("similar.hash", app.CorePHash)
+	similarCmd.Flags().String("hash", app.CorePHash, "Perceptual hash to compare, 'dHash' or 'pHash'")
+	viper.BindPFlag("similar.hash", similarCmd.Flags().Lookup("hash"))
+
+	viper.SetDefault("similar.threshold", 10)
+	similarCmd.Flags().IntP("threshold", "t", 10, "Maximum Hamming distance (0-64) of similar images")
+	viper.BindPFlag("similar.threshold", similarCmd.Flags().Lookup("threshold"))
+}
+
+func runSimilar(cmd *cobra.Command, args []string) {
+	log.Info("Searching near-duplicate images.")
+
+	cfg := app.Config{
+		Source: viper.GetString("source"),
+		Out:    cmd.OutOrStdout(),
+	}
+
+	if err := app.Similar(cfg, viper.GetString("similar.hash"), viper.GetInt("similar.threshold")); err != nil {
+		log.Error(err.Error())
+	}
+}
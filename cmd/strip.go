@@ -0,0 +1,88 @@
+/*
+Copyright © 2020 Jörg Kütemeier <joerg@kuetemeier.de>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kuetemeier/imgindex/app"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// stripCmd represents the 'strip' command
+var stripCmd = &cobra.Command{
+	Use:   "strip",
+	Short: "remove private metadata from JPEG files before publishing",
+	Long: `Remove private metadata from JPEG files before publishing.
+
+	The tags denied by the profile are removed from the EXIF, IPTC and XMP of every JPEG, unless the profile
+	allows them. Profiles are defined in 'strip.profiles' as 'allow' and 'deny' lists of groups (gps, makernotes,
+	serials, owner, location, comments, history, copyright, creator, licensing) and tags like 'EXIF:GPSLatitude'.
+	The image data is copied as it is. EXIF tags that can not be written again, like SubIFDs, are lost when the
+	EXIF is changed and are reported as well. With --dry-run, only the tags that would be removed are reported.
+	`,
+	Run: runStrip,
+}
+
+// defaultStripProfiles are available unless the configuration defines profiles with the same name
+var defaultStripProfiles = map[string]app.StripProfile{
+	"web": {
+		Deny:  []string{"gps", "makernotes", "serials", "owner"},
+		Allow: []string{"copyright", "creator", "licensing"},
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(stripCmd)
+
+	viper.SetDefault("strip.profile", "web")
+	stripCmd.Flags().StringP("profile", "p", "web", "Profile of the metadata to remove, see 'strip.profiles'")
+	viper.BindPFlag("strip.profile", stripCmd.Flags().Lookup("profile"))
+
+	stripCmd.Flags().Bool("dry-run", false, "Only report what would be removed")
+}
+
+func runStrip(cmd *cobra.Command, args []string) {
+	log.Info("Stripping metadata of JPEG files.")
+
+	profiles := map[string]app.StripProfile{}
+	for name, profile := range defaultStripProfiles {
+		profiles[name] = profile
+	}
+	if err := viper.UnmarshalKey("strip.profiles", &profiles); err != nil {
+		log.Error(err.Error())
+		return
+	}
+	name := viper.GetString("strip.profile")
+	profile, ok := profiles[name]
+	if !ok {
+		log.Error(fmt.Sprintf("Unknown strip profile '%s'", name))
+		return
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	cfg := app.Config{
+		Source: viper.GetString("source"),
+		Out:    cmd.OutOrStdout(),
+	}
+
+	if err := app.Strip(cfg, profile, dryRun); err != nil {
+		log.Error(err.Error())
+	}
+}
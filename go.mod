@@ -3,6 +3,7 @@ module github.com/kuetemeier/imgindex
 go 1.14
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
 	github.com/golang/protobuf v1.4.1 // indirect
 	github.com/mitchellh/go-homedir v1.1.0
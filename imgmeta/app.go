@@ -11,6 +11,7 @@ var idJFIF = []byte{'J', 'F', 'I', 'F', 0}
 var idJFXX = []byte{'J', 'F', 'X', 'X', 0}
 var idEXIF = []byte{'E', 'x', 'i', 'f', 0, 0}
 var idXMP = []byte{'h', 't', 't', 'p', ':', '/', '/', 'n', 's', '.', 'a', 'd', 'o', 'b', 'e', '.', 'c', 'o', 'm', '/', 'x', 'a', 'p', '/', '1', '.', '0', '/', 0}
+var idXMPExt = []byte("http://ns.adobe.com/xmp/extension/\x00")
 var idAPP2 = []byte{'I', 'C', 'C', '_', 'P', 'R', 'O', 'F', 'I', 'L', 'E', 0}
 var idIPTC = []byte{'P', 'h', 'o', 't', 'o', 's', 'h', 'o', 'p', ' ', '3', '.', '0', 0}
 
@@ -22,9 +23,11 @@ const (
 
 const (
 	cIFDZERO    uint16 = 0x0000
+	cIFDONE     uint16 = 0x0001 // thumbnail IFD, linked by IFD0
 	cIFDEXIF    uint16 = 0x8769
 	cIFDGPS     uint16 = 0x8825
 	cIFDINTEROP uint16 = 0xa005
+	cIFDANY     uint16 = 0xffff // any of the IFDs above
 )
 
 func fAPPReadBlock(marker uint16, reader *JpegReader, extra uint32) (appblock []byte, err error) {
@@ -82,6 +85,13 @@ func fAPPReadAPP1(marker uint16, reader *JpegReader) (a APP, err error) {
 		exif := &tEXIFAPP{block: app.block, offset: app.offset, endian: binary.BigEndian}
 		return exif, err
 	} else if app.HasID(idXMP) {
+		xmp, xmpErr := newXMPAPP(app.block, app.block[4+len(idXMP):])
+		if xmpErr != nil {
+			// a broken packet must not fail the whole JPEG
+			log.Warn(xmpErr.Error())
+		}
+		return xmp, err
+	} else if app.HasID(idXMPExt) {
 		return app, nil
 	}
 	return app, &exifError{"APP1 has wrong identifier, should be 'EXIF' or 'XMP'"}
@@ -109,7 +119,7 @@ func fAPPReadIPTC(marker uint16, reader *JpegReader) (a APP, err error) {
 	return app, &exifError{"APP13 has wrong identifier, should be 'Photoshop 3.0\000'"}
 }
 
-func fAPPReadSOF0(marker uint16, reader *JpegReader) (a APP, err error) {
+func fAPPReadSOFn(marker uint16, reader *JpegReader) (a APP, err error) {
 	app := &tSOFnAPP{marker: marker, endian: binary.BigEndian}
 	app.block, err = fAPPReadBlock(marker, reader, 0)
 	return app, nil
@@ -144,21 +154,33 @@ var aSegments = map[uint16]tAPPSegment{
 	cMETA: {name: "META", marker: cMETA, reader: fAPPReadIgnore},
 	cIPTC: {name: "IPTC", marker: cIPTC, reader: fAPPReadIPTC},
 
-	cSOF0:     {name: "SOF0", marker: cSOF0, reader: fAPPReadSOF0},
-	cSOF1:     {name: "SOF1", marker: cSOF1, reader: fAPPReadIgnore},
-	cSOF1 + 1: {name: "SOF2", marker: cSOF1 + 1, reader: fAPPReadIgnore},
-	cSOF1 + 2: {name: "SOF3", marker: cSOF1 + 2, reader: fAPPReadIgnore},
-	cSOF1 + 4: {name: "SOF5", marker: cSOF1 + 4, reader: fAPPReadIgnore},
-	cSOF1 + 5: {name: "SOF6", marker: cSOF1 + 5, reader: fAPPReadIgnore},
-	cSOF1 + 6: {name: "SOF7", marker: cSOF1 + 6, reader: fAPPReadIgnore},
-	cSOF1 + 8: {name: "SOF9", marker: cSOF1 + 8, reader: fAPPReadIgnore},
-	cSOF1 + 9: {name: "SOF10", marker: cSOF1 + 9, reader: fAPPReadIgnore},
-	cSOF11:    {name: "SOF11", marker: cSOF11, reader: fAPPReadIgnore},
+	cAPP4:  {name: "APP4", marker: cAPP4, reader: fAPPReadIgnore},
+	cAPP5:  {name: "APP5", marker: cAPP5, reader: fAPPReadIgnore},
+	cAPP6:  {name: "APP6", marker: cAPP6, reader: fAPPReadIgnore},
+	cAPP7:  {name: "APP7", marker: cAPP7, reader: fAPPReadIgnore},
+	cAPP8:  {name: "APP8", marker: cAPP8, reader: fAPPReadIgnore},
+	cAPP9:  {name: "APP9", marker: cAPP9, reader: fAPPReadIgnore},
+	cAPP10: {name: "APP10", marker: cAPP10, reader: fAPPReadIgnore},
+	cAPP11: {name: "APP11", marker: cAPP11, reader: fAPPReadIgnore},
+	cPINF:  {name: "PINF", marker: cPINF, reader: fAPPReadIgnore},
+	cAPP14: {name: "APP14", marker: cAPP14, reader: fAPPReadIgnore},
+	cAPP15: {name: "APP15", marker: cAPP15, reader: fAPPReadIgnore},
+
+	cSOF0:     {name: "SOF0", marker: cSOF0, reader: fAPPReadSOFn},
+	cSOF1:     {name: "SOF1", marker: cSOF1, reader: fAPPReadSOFn},
+	cSOF1 + 1: {name: "SOF2", marker: cSOF1 + 1, reader: fAPPReadSOFn},
+	cSOF1 + 2: {name: "SOF3", marker: cSOF1 + 2, reader: fAPPReadSOFn},
+	cSOF1 + 4: {name: "SOF5", marker: cSOF1 + 4, reader: fAPPReadSOFn},
+	cSOF1 + 5: {name: "SOF6", marker: cSOF1 + 5, reader: fAPPReadSOFn},
+	cSOF1 + 6: {name: "SOF7", marker: cSOF1 + 6, reader: fAPPReadSOFn},
+	cSOF1 + 8: {name: "SOF9", marker: cSOF1 + 8, reader: fAPPReadSOFn},
+	cSOF1 + 9: {name: "SOF10", marker: cSOF1 + 9, reader: fAPPReadSOFn},
+	cSOF11:    {name: "SOF11", marker: cSOF11, reader: fAPPReadSOFn},
 
 	cDHT: {name: "cDHT", marker: cDHT, reader: fAPPReadIgnore},
 	cDAC: {name: "cDAC", marker: cDAC, reader: fAPPReadIgnore},
-	cDQT: {name: "cDQT", marker: cDQT, reader: fAPPReadIgnore},
-	cSOS: {name: "cSOS", marker: cSOS, reader: fAPPEnd},
+	cDQT: {name: "DQT", marker: cDQT, reader: fAPPReadDQT},
+	cSOS: {name: "cSOS", marker: cSOS, reader: fAPPReadSOS},
 
 	cRST0:     {name: "cRST0", marker: cRST0, reader: fAPPReadIgnore},
 	cRST0 + 1: {name: "cRST1", marker: cRST0 + 6, reader: fAPPReadIgnore},
@@ -215,6 +237,9 @@ func (t tAPP) ID(cid []byte) (id []byte) {
 	return
 }
 func (t tAPP) HasID(cid []byte) bool {
+	if len(t.block) < 4+len(cid) {
+		return false
+	}
 	id := t.block[4 : 4+len(cid)]
 	for i, b := range id {
 		if b != cid[i] {
@@ -228,3 +253,56 @@ func (t tAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
 	log.Debug(fmt.Sprintf("Read value of tag:0x%X in APP:BASIC\n", tagID2Find))
 	return int(0), nil
 }
+
+// Tags of the image size, the same in every tValuesAPP
+const (
+	cValuesImageWidth  uint16 = 0x0001
+	cValuesImageHeight uint16 = 0x0002
+)
+
+// tValuesAPP is the section of a format whose values are not stored in APPn segments, e.g. the header of a PNG.
+// The formats embed it and add their own readers.
+type tValuesAPP struct {
+	name   string                 // name of the section, e.g. "PNG"
+	names  map[string]uint16      // tags by property name
+	values map[uint16]interface{} // values by tag
+}
+
+func (t tValuesAPP) Name() string {
+	return t.name
+}
+func (t tValuesAPP) Marker() uint16 {
+	return 0
+}
+func (t tValuesAPP) Length() uint16 {
+	return 0
+}
+func (t tValuesAPP) ID(cid []byte) []byte {
+	return []byte{}
+}
+func (t tValuesAPP) HasID(cid []byte) bool {
+	return true
+}
+
+func (t tValuesAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
+	value, ok := t.values[tagID2Find]
+	if !ok {
+		return nil, &exifError{fmt.Sprintf("%s tag 0x%X not found", t.name, tagID2Find)}
+	}
+	return value, nil
+}
+
+// ReadProperty returns a value by its name, e.g. 'ImageWidth'
+func (t tValuesAPP) ReadProperty(name string) (interface{}, error) {
+	tag, ok := t.names[name]
+	if !ok {
+		return nil, &exifError{fmt.Sprintf("%s property '%s' not found", t.name, name)}
+	}
+	return t.ReadValue(tag)
+}
+
+func (t tValuesAPP) size() (uint32, uint32, bool) {
+	width, okW := t.values[cValuesImageWidth].(uint32)
+	height, okH := t.values[cValuesImageHeight].(uint32)
+	return width, height, okW && okH
+}
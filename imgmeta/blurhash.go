@@ -0,0 +1,120 @@
+package imgmeta
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+BlurHash
+
+A BlurHash (https://blurha.sh) is a compact string representation of a placeholder for an image. The image is
+described by a few cosine components per axis (like a very coarse JPEG), quantised and encoded with a base83
+alphabet:
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    SizeFlag         1 char   (componentsX - 1) + (componentsY - 1) * 9
+    MaximumAC        1 char   quantised maximum value of the AC components
+    DC               4 chars  average colour (sRGB)
+    AC           2n chars     the other components, 19 levels per channel
+
+The hash is computed from a thumbnail of the image, the result is nearly the same and a lot faster.
+
+*/
+
+const cBase83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash returns the BlurHash of the thumbnail with componentsX x componentsY components (1-9 each)
+func (t Thumbnail) BlurHash(componentsX, componentsY int) (string, error) {
+	if componentsX < 1 || componentsX > 9 || componentsY < 1 || componentsY > 9 {
+		return "", &exifError{fmt.Sprintf("BlurHash components must be between 1 and 9, got %dx%d", componentsX, componentsY)}
+	}
+
+	w, h := t.Bounds().Dx(), t.Bounds().Dy()
+	if w == 0 || h == 0 {
+		return "", &exifError{"Image is empty"}
+	}
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1.0
+			}
+			var r, g, b float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+					p := t.Pix[t.PixOffset(x, y):]
+					r += basis * sRGBToLinear(p[0])
+					g += basis * sRGBToLinear(p[1])
+					b += basis * sRGBToLinear(p[2])
+				}
+			}
+			scale := 1.0 / float64(w*h)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((componentsX-1)+(componentsY-1)*9, 1))
+
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		actualMax := 0.0
+		for _, f := range factors[1:] {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encode83(linearTosRGB(dc[0])<<16|linearTosRGB(dc[1])<<8|linearTosRGB(dc[2]), 4))
+
+	for _, f := range factors[1:] {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+
+	return hash.String(), nil
+}
+
+func encode83(value, length int) string {
+	result := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		result[i] = cBase83Chars[value%83]
+		value /= 83
+	}
+	return string(result)
+}
+
+func sRGBToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearTosRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
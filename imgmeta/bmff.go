@@ -0,0 +1,242 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+/*
+ISO Base Media File Format (ISO/IEC 14496-12)
+
+HEIF, AVIF, CR3, JPEG XL containers and MP4/MOV files are made up of nested boxes:
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    Size             4 bytes  size of the box including the header (big-endian),
+                              1: a 64 bit size follows the type, 0: the box extends to the end of the file
+    Type             4 bytes  box type, e.g. "ftyp"
+    Largesize        8 bytes  only if Size is 1
+    Payload            ...    data or child boxes
+
+A full box starts its payload with a version (1 byte) and flags (3 bytes). The first box of a file is the
+file type box:
+
+    ftyp   major brand (4), minor version (4), compatible brands (4 each)
+
+*/
+
+// tBox is a box with its payload, without the header
+type tBox struct {
+	boxType string
+	offset  int64 // offset of the payload in the file, or in its parent
+	data    []byte
+}
+
+// readBoxHeader reads the header of the next box, size is the size of the payload, -1 if the box
+// extends to the end of the file
+func readBoxHeader(r io.Reader) (boxType string, size int64, err error) {
+	header := make([]byte, 8)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	boxType = string(header[4:])
+	size = int64(binary.BigEndian.Uint32(header))
+	switch size {
+	case 0:
+		return boxType, -1, nil
+	case 1:
+		if _, err = io.ReadFull(r, header); err != nil {
+			return
+		}
+		size = int64(binary.BigEndian.Uint64(header)) - 16
+	default:
+		size -= 8
+	}
+	if size < 0 {
+		err = &exifError{fmt.Sprintf("Box '%s' has an invalid size", boxType)}
+	}
+	return
+}
+
+// readTopLevelBoxes reads the boxes of a file. The payload is read for the box types in load, all other
+// boxes are skipped. Boxes larger than maxSize are not loaded.
+func readTopLevelBoxes(r io.ReadSeeker, load map[string]bool, maxSize int64) ([]tBox, error) {
+	boxes := []tBox{}
+	for {
+		boxType, size, err := readBoxHeader(r)
+		if err == io.EOF {
+			return boxes, nil
+		}
+		if err != nil {
+			return boxes, err
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return boxes, err
+		}
+		if size < 0 {
+			end, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return boxes, err
+			}
+			size = end - offset
+			r.Seek(offset, io.SeekStart)
+		}
+
+		box := tBox{boxType: boxType, offset: offset}
+		if load[boxType] && size <= maxSize {
+			box.data = make([]byte, size)
+			if _, err := io.ReadFull(r, box.data); err != nil {
+				return boxes, &exifError{fmt.Sprintf("Box '%s' is truncated", boxType)}
+			}
+		}
+		boxes = append(boxes, box)
+
+		if _, err := r.Seek(offset+size, io.SeekStart); err != nil {
+			return boxes, err
+		}
+	}
+}
+
+// readBoxes splits a payload into its child boxes, reading stops at the first malformed box
+func readBoxes(data []byte) []tBox {
+	boxes := []tBox{}
+	reader := bytes.NewReader(data)
+	for reader.Len() >= 8 {
+		boxType, size, err := readBoxHeader(reader)
+		if err != nil {
+			break
+		}
+		offset := int64(len(data) - reader.Len())
+		if size < 0 {
+			size = int64(reader.Len())
+		}
+		if offset+size > int64(len(data)) {
+			break
+		}
+		boxes = append(boxes, tBox{boxType: boxType, offset: offset, data: data[offset : offset+size]})
+		reader.Seek(offset+size, io.SeekStart)
+	}
+	return boxes
+}
+
+// findBox returns the first box of a type
+func findBox(boxes []tBox, boxType string) (tBox, bool) {
+	for _, box := range boxes {
+		if box.boxType == boxType {
+			return box, true
+		}
+	}
+	return tBox{}, false
+}
+
+// findBoxPath follows a path of box types like "moov/trak/mdia", starting with the children of boxes
+func findBoxPath(boxes []tBox, path ...string) (tBox, bool) {
+	box := tBox{}
+	for i, boxType := range path {
+		var ok bool
+		if box, ok = findBox(boxes, boxType); !ok {
+			return box, false
+		}
+		if i < len(path)-1 {
+			boxes = readBoxes(box.data)
+		}
+	}
+	return box, true
+}
+
+// tBoxReader reads the fields of a box payload, reading beyond the end sets failed and returns zero values
+type tBoxReader struct {
+	data   []byte
+	pos    int
+	failed bool
+}
+
+// next returns the next n bytes, or nil if there are not as many
+func (b *tBoxReader) next(n int) []byte {
+	if n < 0 || b.pos+n > len(b.data) {
+		b.failed = true
+		b.pos = len(b.data)
+		return nil
+	}
+	field := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return field
+}
+
+// fixed returns the next n bytes of a number, zeros if there are not as many
+func (b *tBoxReader) fixed(n int) []byte {
+	if field := b.next(n); field != nil {
+		return field
+	}
+	return make([]byte, n)
+}
+
+func (b *tBoxReader) u8() uint8 {
+	return b.fixed(1)[0]
+}
+func (b *tBoxReader) u16() uint16 {
+	return binary.BigEndian.Uint16(b.fixed(2))
+}
+func (b *tBoxReader) u32() uint32 {
+	return binary.BigEndian.Uint32(b.fixed(4))
+}
+func (b *tBoxReader) u64() uint64 {
+	return binary.BigEndian.Uint64(b.fixed(8))
+}
+
+// uint reads an unsigned value of 0, 2, 4 or 8 bytes, as used by the iloc box
+func (b *tBoxReader) uint(size int) uint64 {
+	switch size {
+	case 2:
+		return uint64(b.u16())
+	case 4:
+		return uint64(b.u32())
+	case 8:
+		return b.u64()
+	}
+	return 0
+}
+
+func (b *tBoxReader) fourCC() string {
+	return string(b.next(4))
+}
+
+// fullBox reads version and flags of a full box
+func (b *tBoxReader) fullBox() (version uint8, flags uint32) {
+	header := b.u32()
+	return uint8(header >> 24), header & 0xffffff
+}
+
+// str reads a null-terminated string
+func (b *tBoxReader) str() string {
+	if b.pos >= len(b.data) {
+		return ""
+	}
+	end := bytes.IndexByte(b.data[b.pos:], 0)
+	if end < 0 {
+		s := string(b.data[b.pos:])
+		b.pos = len(b.data)
+		return s
+	}
+	s := string(b.data[b.pos : b.pos+end])
+	b.pos += end + 1
+	return s
+}
+
+func (b *tBoxReader) rest() []byte {
+	return b.next(len(b.data) - b.pos)
+}
+
+// readFtyp returns major and compatible brands of a ftyp box
+func readFtyp(box tBox) (major string, compatible []string) {
+	reader := &tBoxReader{data: box.data}
+	major = reader.fourCC()
+	reader.u32() // minor version
+	for len(reader.data)-reader.pos >= 4 {
+		compatible = append(compatible, reader.fourCC())
+	}
+	return
+}
@@ -0,0 +1,116 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// The builders of the boxes, chunks and blocks that the samples of the formats are made of
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="4">
+<dc:title><rdf:Alt><rdf:li xml:lang="de">Die Mauer</rdf:li><rdf:li xml:lang="x-default">The Wall</rdf:li></rdf:Alt></dc:title>
+<dc:subject><rdf:Bag><rdf:li>wall</rdf:li><rdf:li>test</rdf:li></rdf:Bag></dc:subject>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+
+func u16(v uint16) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func u32(v uint32) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// box returns an ISO base media file format box (HEIF, JPEG XL, MP4/MOV and CR3)
+func box(boxType string, payload ...[]byte) []byte {
+	data := make([]byte, 8)
+	copy(data[4:], boxType)
+	for _, p := range payload {
+		data = append(data, p...)
+	}
+	binary.BigEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+// riffChunk returns a RIFF chunk (WebP), padded to an even length
+func riffChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 9+len(data))
+	copy(chunk, chunkType)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// pngChunk returns a PNG chunk with its CRC
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+func deflate(data []byte) []byte {
+	buf := bytes.Buffer{}
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// tiffWithOrientation returns a big-endian TIFF structure with only the Orientation tag
+func tiffWithOrientation(orientation uint16) []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(tiff[18:], orientation)
+	return tiff
+}
+
+// dataset returns an IPTC dataset
+func dataset(record, number byte, value string) []byte {
+	return append([]byte{0x1c, record, number, byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+// resource returns a Photoshop image resource block without a name
+func resource(id uint16, data []byte) []byte {
+	block := append([]byte("8BIM"), u16(id)...)
+	block = append(block, 0, 0)
+	block = append(append(block, u32(uint32(len(data)))...), data...)
+	if len(data)%2 == 1 {
+		block = append(block, 0)
+	}
+	return block
+}
+
+// psdFile returns an 8 bit RGB PSD (version 1) or PSB (version 2) with the image resources and, if layerInfo is
+// not nil, a layer section holding it
+func psdFile(version uint16, channels uint16, width, height uint32, resources []byte, layerInfo []byte) []byte {
+	length := func(n int) []byte {
+		if version == 2 {
+			return append(u32(0), u32(uint32(n))...)
+		}
+		return u32(uint32(n))
+	}
+	layers := []byte{}
+	if layerInfo != nil {
+		layers = append(length(len(layerInfo)), layerInfo...)
+	}
+
+	data := append([]byte("8BPS"), u16(version)...)
+	data = append(data, make([]byte, 6)...)
+	data = append(data, u16(channels)...)
+	data = append(data, u32(height)...)
+	data = append(data, u32(width)...)
+	data = append(data, u16(8)...)
+	data = append(data, u16(3)...)
+	data = append(data, u32(0)...)
+	data = append(append(data, u32(uint32(len(resources)))...), resources...)
+	data = append(append(data, length(len(layers))...), layers...)
+	return append(data, u16(0)...)
+}
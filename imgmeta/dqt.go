@@ -0,0 +1,201 @@
+package imgmeta
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+Structure of a DQT (Define Quantization Table) segment
+
+A DQT segment holds one or more quantization tables. Every table starts with a byte whose upper nibble is the
+precision (0: 8 bit, 1: 16 bit values) and whose lower nibble is the table ID (0-3), followed by 64 values in
+zigzag order. Usually table 0 is used for the luminance and table 1 for both chrominance components.
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    Marker           2 bytes  0xFFDB
+    Length           2 bytes  length of the segment
+    PqTq             1 byte   precision and table ID
+    Qk         64 or 128 bytes quantization values, zigzag order
+    ...                       more tables
+
+Encoders based on libjpeg (and most others) scale the example tables of the JPEG standard (Annex K) with a
+quality factor from 1 to 100. Comparing the stored tables to the scaled example tables gives an estimate of the
+quality an image was saved with.
+
+*/
+
+type tDQTAPP struct {
+	endian binary.ByteOrder
+	block  []byte
+	tables map[uint8][]uint16 // quantization tables by ID, natural order
+}
+
+func (t tDQTAPP) Name() string {
+	return "DQT"
+}
+func (t tDQTAPP) Marker() uint16 {
+	return cDQT
+}
+func (t tDQTAPP) Length() uint16 {
+	return t.endian.Uint16(t.block[2:])
+}
+func (t tDQTAPP) ID(cid []byte) []byte {
+	return []byte{}
+}
+func (t tDQTAPP) HasID(cid []byte) bool {
+	return true
+}
+
+// ReadValue returns the estimated quality (DQTQuality) or a quantization table (DQTTable0 - DQTTable3)
+func (t tDQTAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
+	switch tagID2Find {
+	case DQTQuality:
+		return t.Quality()
+	case DQTTable0, DQTTable1, DQTTable2, DQTTable3:
+		table, ok := t.tables[uint8(tagID2Find-DQTTable0)]
+		if !ok {
+			return nil, &exifError{fmt.Sprintf("Quantization table %d not found", tagID2Find-DQTTable0)}
+		}
+		return table, nil
+	}
+	return nil, &exifError{fmt.Sprintf("DQT has no tag 0x%X", tagID2Find)}
+}
+
+// JpegQuality estimates the quality (1-100) of a JPEG from its quantization tables
+func (i Image) JpegQuality() (int, error) {
+	dqt, ok := i.apps["DQT"].(*tDQTAPP)
+	if !ok {
+		return 0, &exifError{"Image has no quantization tables"}
+	}
+	return dqt.Quality()
+}
+
+// merge adds the tables of another DQT segment, JPEGs often use one segment per table
+func (t *tDQTAPP) merge(other *tDQTAPP) {
+	for id, table := range other.tables {
+		t.tables[id] = table
+	}
+}
+
+// Quality estimates the libjpeg quality (1-100) the tables were created with. Luminance and
+// chrominance table are compared to the scaled example tables, the closest quality wins.
+func (t tDQTAPP) Quality() (int, error) {
+	luminance, ok := t.tables[0]
+	if !ok {
+		return 0, &exifError{"Luminance quantization table not found"}
+	}
+	chrominance, hasChrominance := t.tables[1]
+
+	best, bestError := 0, -1
+	for quality := 1; quality <= 100; quality++ {
+		e := tableError(luminance, aStdLuminanceQuant, quality)
+		if hasChrominance {
+			e += tableError(chrominance, aStdChrominanceQuant, quality)
+		}
+		if bestError < 0 || e < bestError {
+			best, bestError = quality, e
+		}
+	}
+	return best, nil
+}
+
+// tableError sums the differences between a table and the example table scaled to quality
+func tableError(table []uint16, std [64]uint16, quality int) int {
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+
+	sum := 0
+	for i, v := range std {
+		q := (int(v)*scale + 50) / 100
+		if q < 1 {
+			q = 1
+		} else if q > 255 {
+			q = 255
+		}
+		d := q - int(table[i])
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return sum
+}
+
+func fAPPReadDQT(marker uint16, reader *JpegReader) (a APP, err error) {
+	app := &tDQTAPP{endian: binary.BigEndian, tables: map[uint8][]uint16{}}
+	app.block, err = fAPPReadBlock(marker, reader, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	data := app.block[4:]
+	for len(data) > 0 {
+		precision, id := data[0]>>4, data[0]&0x0F
+		size := 64
+		if precision != 0 {
+			size = 128
+		}
+		if len(data) < 1+size {
+			return nil, &exifError{"DQT segment is too short"}
+		}
+
+		table := make([]uint16, 64)
+		for k := 0; k < 64; k++ {
+			if precision == 0 {
+				table[aZigzagToNatural[k]] = uint16(data[1+k])
+			} else {
+				table[aZigzagToNatural[k]] = binary.BigEndian.Uint16(data[1+2*k:])
+			}
+		}
+		app.tables[id] = table
+		data = data[1+size:]
+	}
+	return app, nil
+}
+
+// Tags of the DQT section
+const (
+	DQTQuality uint16 = 0x0001
+	DQTTable0  uint16 = 0x0100
+	DQTTable1  uint16 = 0x0101
+	DQTTable2  uint16 = 0x0102
+	DQTTable3  uint16 = 0x0103
+)
+
+var aZigzagToNatural = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// Example tables of the JPEG standard, Annex K, natural order
+var aStdLuminanceQuant = [64]uint16{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+var aStdChrominanceQuant = [64]uint16{
+	17, 18, 24, 47, 99, 99, 99, 99,
+	18, 21, 26, 66, 99, 99, 99, 99,
+	24, 26, 56, 99, 99, 99, 99, 99,
+	47, 66, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+	99, 99, 99, 99, 99, 99, 99, 99,
+}
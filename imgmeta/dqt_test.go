@@ -0,0 +1,45 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func encodedJpeg(quality int) string {
+	buf := bytes.Buffer{}
+	img := image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio420)
+	Expect(jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})).Should(Succeed())
+
+	tmp, err := ioutil.TempFile("", "imgindex-*.jpg")
+	Expect(err).Should(BeNil())
+	defer tmp.Close()
+	tmp.Write(buf.Bytes())
+	return tmp.Name()
+}
+
+var _ = Describe("DQT", func() {
+
+	It("should estimate the quality of the sample", func() {
+		Expect(readJpegFile(sampleJpeg).JpegQuality()).Should(Equal(70))
+	})
+
+	for _, quality := range []int{10, 50, 75, 95} {
+		quality := quality
+		It("should estimate the quality of the encoder", func() {
+			path := encodedJpeg(quality)
+			defer os.Remove(path)
+
+			image := readJpegFile(path)
+			Expect(image.JpegQuality()).Should(Equal(quality))
+			Expect(image.ReadTagValue("DQT", DQTTable1)).Should(HaveLen(64))
+		})
+	}
+
+})
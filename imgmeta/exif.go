@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -89,6 +90,9 @@ func (t tEXIFAPP) ID(cid []byte) (id []byte) {
 	return
 }
 func (t tEXIFAPP) HasID(cid []byte) bool {
+	if len(t.block) < 4+len(cid) {
+		return false
+	}
 	id := t.block[4 : 4+len(cid)]
 	for i, b := range id {
 		if b != cid[i] {
@@ -98,7 +102,11 @@ func (t tEXIFAPP) HasID(cid []byte) bool {
 	return true
 }
 
+// TIFFByteOrder returns the byte order of the TIFF header, big-endian if the header is truncated
 func (t tEXIFAPP) TIFFByteOrder() binary.ByteOrder {
+	if len(t.block) < 12 {
+		return binary.BigEndian
+	}
 	bo := binary.BigEndian.Uint16(t.block[10:12])
 	if bo == cINTEL {
 		return binary.LittleEndian
@@ -106,11 +114,30 @@ func (t tEXIFAPP) TIFFByteOrder() binary.ByteOrder {
 	return binary.BigEndian
 }
 
+// TIFFOffsetToIFD0 returns the offset of IFD0 relative to the TIFF header, 0 if the header is truncated
 func (t tEXIFAPP) TIFFOffsetToIFD0() uint32 {
+	if len(t.block) < 18 {
+		return 0
+	}
 	endian := t.TIFFByteOrder()
 	return endian.Uint32(t.block[14:18])
 }
 
+// newExifAPP wraps a bare TIFF structure (as stored by PNG, WebP, HEIF, ...) into an EXIF APP1 block,
+// so the same IFD code reads it
+func newExifAPP(tiff []byte) *tEXIFAPP {
+	block := make([]byte, 10, 10+len(tiff))
+	binary.BigEndian.PutUint16(block, cEXIF)
+	length := len(tiff) + 8
+	if length > 0xFFFF {
+		length = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(block[2:], uint16(length))
+	copy(block[4:], idEXIF)
+	block = append(block, tiff...)
+	return &tEXIFAPP{block: block, offset: 0, endian: binary.BigEndian}
+}
+
 type ifdOffsetItem struct {
 	offset  uint32
 	ifdType uint16
@@ -119,7 +146,20 @@ type ifdOffsetItem struct {
 func (t tEXIFAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
 	log.Debug(fmt.Sprintf("Read value of tag:0x%X in APP:EXIF\n", tagID2Find))
 
+	ifd, tag, found := t.findTag(tagID2Find, cIFDANY)
+	if !found {
+		return nil, &exifError{fmt.Sprintf("EXIF tag 0x%X not found", tagID2Find)}
+	}
+	return ifd.ReadValue(tag)
+}
+
+// findTag searches a tag in IFD0 and the IFDs linked by it. With ifdType cIFDANY the first match
+// in any IFD is returned, otherwise only the IFD of that type (e.g. cIFDGPS) is searched.
+func (t tEXIFAPP) findTag(tagID2Find uint16, ifdType uint16) (tExifIFD, tExifTag, bool) {
 	tiffOffset := uint32(10)
+	if t.TIFFOffsetToIFD0() < 8 {
+		return tExifIFD{}, tExifTag{}, false
+	}
 	ifd0Offset := tiffOffset + t.TIFFOffsetToIFD0()
 	endian := t.TIFFByteOrder()
 
@@ -131,7 +171,11 @@ func (t tEXIFAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
 		ifdItem := ifdQueue[len(ifdQueue)-1]
 		ifdQueue = ifdQueue[:len(ifdQueue)-1]
 
-		ifd := tExifIFD{offset: ifdItem.offset, appblock: t.block, endian: endian}
+		ifd := tExifIFD{offset: ifdItem.offset, base: tiffOffset, appblock: t.block, endian: endian}
+		if !ifd.valid() {
+			log.Warn(fmt.Sprintf("EXIF IFD at offset %d is out of range", ifdItem.offset))
+			continue
+		}
 		// How many fields does this IFD have ?
 		numberOfTags := ifd.NumberOfTags()
 
@@ -139,8 +183,8 @@ func (t tEXIFAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
 			tag := ifd.GetTag(i)
 			tagID := tag.TagID()
 
-			if tagID == tagID2Find {
-				return ifd.ReadValue(tag)
+			if tagID == tagID2Find && (ifdType == cIFDANY || ifdType == ifdItem.ifdType) {
+				return ifd, tag, true
 			}
 
 			// IFD0, reading the offsets to the other IFD segments
@@ -157,15 +201,68 @@ func (t tEXIFAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
 		}
 	}
 
-	return int(1), nil
+	return tExifIFD{}, tExifTag{}, false
+}
+
+// rawTag returns a tag of an IFD (e.g. cIFDGPS) with its undecoded value
+func (t tEXIFAPP) rawTag(tagID uint16, ifdType uint16) (tExifEntry, bool) {
+	ifd, tag, found := t.findTag(tagID, ifdType)
+	if !found {
+		return tExifEntry{}, false
+	}
+	data, err := ifd.valueBytes(tag)
+	if err != nil {
+		return tExifEntry{}, false
+	}
+	return tExifEntry{
+		id:     tagID,
+		typeID: tag.TypeID() &^ cARRAY,
+		count:  tag.countOrComponents(),
+		data:   append([]byte{}, data...),
+		endian: ifd.endian,
+	}, true
+}
+
+// rationals decodes the value of an unsigned rational tag, it is empty for other types
+func (e tExifEntry) rationals() []float64 {
+	if e.typeID != cURATIONAL || uint64(len(e.data)) < uint64(e.count)*8 {
+		return nil
+	}
+	values := make([]float64, e.count)
+	for i := range values {
+		numerator := e.endian.Uint32(e.data[i*8:])
+		denominator := e.endian.Uint32(e.data[i*8+4:])
+		if denominator != 0 {
+			values[i] = float64(numerator) / float64(denominator)
+		}
+	}
+	return values
 }
 
 type tExifIFD struct {
 	offset   uint32           // IFD-Offset
+	base     uint32           // Offset of the TIFF header, value offsets are relative to it
 	endian   binary.ByteOrder // Endian
 	appblock []byte
 }
 
+// valid reports whether the IFD and all of its tags are inside the block
+func (ifd tExifIFD) valid() bool {
+	if uint64(ifd.offset)+2 > uint64(len(ifd.appblock)) {
+		return false
+	}
+	return uint64(ifd.offset)+2+uint64(ifd.NumberOfTags())*12 <= uint64(len(ifd.appblock))
+}
+
+// next returns the offset of the next IFD in the chain relative to the TIFF header, 0 if there is none
+func (ifd tExifIFD) next() uint32 {
+	o := uint64(ifd.offset) + 2 + uint64(ifd.NumberOfTags())*12
+	if o+4 > uint64(len(ifd.appblock)) {
+		return 0
+	}
+	return ifd.endian.Uint32(ifd.appblock[o:])
+}
+
 func (ifd tExifIFD) NumberOfTags() uint32 {
 	return uint32(ifd.endian.Uint16(ifd.appblock[ifd.offset:]))
 }
@@ -207,24 +304,10 @@ func (tag tExifTag) countOrComponents() uint32 {
 func (tag tExifTag) valueOrOffset() uint32 {
 	return tag.endian.Uint32(tag.appblock[tag.offset+8:])
 }
-func (tag tExifTag) valueAsU8() uint8 {
-	return tag.appblock[tag.offset+8+3]
-}
-func (tag tExifTag) valueAsU16() uint16 {
-	return binary.LittleEndian.Uint16(tag.appblock[tag.offset+8+2:])
-}
-func (tag tExifTag) valueAsU32() uint32 {
-	return binary.LittleEndian.Uint32(tag.appblock[tag.offset+8:])
-}
-func (tag tExifTag) valueAsFloat32() float32 {
-	bits := binary.LittleEndian.Uint32(tag.appblock[tag.offset+8:])
-	float := math.Float32frombits(bits)
-	return float
-}
 
 type tExifTagFieldType uint16
 
-var aExifTagFieldSize = []int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+var aExifTagFieldSize = []int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4}
 
 func getExifTagFieldSize(fieldType tExifTagFieldType) int {
 	return aExifTagFieldSize[int(fieldType)]
@@ -244,110 +327,136 @@ const (
 	cSRATIONAL = 0x000A
 	cFLOAT32   = 0x000B
 	cFLOAT64   = 0x000C
+	cIFDOFFSET = 0x000D // TIFF-EP, offset of a SubIFD
 )
 
-func (ifd tExifIFD) readValueFromOffset(offset uint32, typeID uint16, count uint32) (interface{}, error) {
-	switch typeID {
-	case cARRAY | cUBYTE:
-		offset = ifd.offset + offset
-		array := append([]uint8{}, ifd.appblock[offset:offset+count]...)
-		return array, nil
-	case cARRAY | cUSHORT:
-		offset = ifd.offset + offset
-		block := ifd.appblock[offset : offset+count*2]
-		array := make([]uint16, count, count)
-		for i := uint32(0); i < count; i++ {
-			array[i] = ifd.endian.Uint16(block[i*2:])
+// valueBytes returns the raw data of a tag, values up to 4 bytes are stored in the tag itself
+func (ifd tExifIFD) valueBytes(tag tExifTag) ([]byte, error) {
+	fieldType := tag.TypeID() &^ cARRAY
+	if fieldType == 0 || int(fieldType) >= len(aExifTagFieldSize) {
+		return nil, &exifError{fmt.Sprintf("Unknown EXIF field type %d", fieldType)}
+	}
+
+	size := uint64(getExifTagFieldSize(tExifTagFieldType(fieldType))) * uint64(tag.countOrComponents())
+	if size <= 4 {
+		return tag.appblock[tag.offset+8 : uint64(tag.offset)+8+size], nil
+	}
+	start := uint64(ifd.base) + uint64(tag.valueOrOffset())
+	if start+size > uint64(len(ifd.appblock)) {
+		return nil, &exifError{"EXIF tag value is out of range"}
+	}
+	return ifd.appblock[start : start+size], nil
+}
+
+// ReadValue decodes the value of a tag. Single values are returned as scalars (e.g. uint16),
+// multiple values as slices (e.g. []uint16), rationals as float64, ASCII as string and
+// undefined data as []byte.
+func (ifd tExifIFD) ReadValue(tag tExifTag) (interface{}, error) {
+	data, err := ifd.valueBytes(tag)
+	if err != nil {
+		return nil, err
+	}
+	count := int(tag.countOrComponents())
+
+	switch tag.TypeID() &^ cARRAY {
+	case cASCII:
+		return strings.TrimRight(string(data), "\x00"), nil
+	case cUNDEFINED:
+		return append([]byte{}, data...), nil
+	case cUBYTE:
+		array := append([]uint8{}, data...)
+		if count == 1 {
+			return array[0], nil
 		}
 		return array, nil
-	case cARRAY | cULONG:
-		offset = ifd.offset + offset
-		block := ifd.appblock[offset : offset+count*4]
-		array := make([]uint32, count, count)
-		for i := uint32(0); i < count; i++ {
-			array[i] = ifd.endian.Uint32(block[i*4:])
+	case cSBYTE:
+		array := make([]int8, count)
+		for i := range array {
+			array[i] = int8(data[i])
+		}
+		if count == 1 {
+			return array[0], nil
 		}
 		return array, nil
-	case cARRAY | cSBYTE:
-		offset = ifd.offset + offset
-		block := ifd.appblock[offset : offset+count]
-		array := make([]int8, count, count)
-		for i := uint32(0); i < count; i++ {
-			array[i] = int8(block[i])
+	case cUSHORT:
+		array := make([]uint16, count)
+		for i := range array {
+			array[i] = ifd.endian.Uint16(data[i*2:])
+		}
+		if count == 1 {
+			return array[0], nil
 		}
 		return array, nil
-	case cARRAY | cSSHORT:
-		offset = ifd.offset + offset
-		block := ifd.appblock[offset : offset+count*2]
-		array := make([]int16, count, count)
-		for i := uint32(0); i < count; i++ {
-			array[i] = int16(ifd.endian.Uint16(block[i*2:]))
+	case cSSHORT:
+		array := make([]int16, count)
+		for i := range array {
+			array[i] = int16(ifd.endian.Uint16(data[i*2:]))
+		}
+		if count == 1 {
+			return array[0], nil
 		}
 		return array, nil
-	case cARRAY | cSLONG:
-		offset = ifd.offset + offset
-		block := ifd.appblock[offset : offset+count*4]
-		array := make([]int32, count, count)
-		for i := uint32(0); i < count; i++ {
-			array[i] = int32(ifd.endian.Uint32(block[i*4:]))
+	case cULONG, cIFDOFFSET:
+		array := make([]uint32, count)
+		for i := range array {
+			array[i] = ifd.endian.Uint32(data[i*4:])
+		}
+		if count == 1 {
+			return array[0], nil
 		}
 		return array, nil
-	case cFLOAT64:
-		bits := ifd.endian.Uint64(ifd.appblock[ifd.offset+offset:])
-		float := math.Float64frombits(bits)
-		return float, nil
-	case cURATIONAL:
-		numerator := ifd.endian.Uint32(ifd.appblock[ifd.offset+offset:])
-		denominator := ifd.endian.Uint32(ifd.appblock[ifd.offset+offset+4:])
-		return float64(numerator) / float64(denominator), nil
-	case cSRATIONAL:
-		numerator := int32(ifd.endian.Uint32(ifd.appblock[ifd.offset+offset:]))
-		denominator := int32(ifd.endian.Uint32(ifd.appblock[ifd.offset+offset+4:]))
-		return float64(numerator) / float64(denominator), nil
-	}
-	return int(0), &exifError{"Reading EXIF tag value from offset failed"}
-}
-
-func (ifd tExifIFD) ReadValue(tag tExifTag) (interface{}, error) {
-
-	switch tag.TypeID() {
-	case cUBYTE:
-		return uint8(tag.valueOrOffset()), nil
-	case cUSHORT:
-		return uint16(tag.valueOrOffset()), nil
-	case cULONG:
-		return uint32(tag.valueOrOffset()), nil
-	case cSBYTE:
-		return int8(tag.valueOrOffset()), nil
-	case cSSHORT:
-		return int16(tag.valueOrOffset()), nil
 	case cSLONG:
-		return int32(tag.valueOrOffset()), nil
+		array := make([]int32, count)
+		for i := range array {
+			array[i] = int32(ifd.endian.Uint32(data[i*4:]))
+		}
+		if count == 1 {
+			return array[0], nil
+		}
+		return array, nil
+	case cURATIONAL, cSRATIONAL:
+		signed := tag.TypeID()&^cARRAY == cSRATIONAL
+		array := make([]float64, count)
+		for i := range array {
+			numerator := ifd.endian.Uint32(data[i*8:])
+			denominator := ifd.endian.Uint32(data[i*8+4:])
+			if denominator == 0 {
+				continue
+			}
+			if signed {
+				array[i] = float64(int32(numerator)) / float64(int32(denominator))
+			} else {
+				array[i] = float64(numerator) / float64(denominator)
+			}
+		}
+		if count == 1 {
+			return array[0], nil
+		}
+		return array, nil
 	case cFLOAT32:
-		return tag.valueAsFloat32(), nil
+		array := make([]float32, count)
+		for i := range array {
+			array[i] = math.Float32frombits(ifd.endian.Uint32(data[i*4:]))
+		}
+		if count == 1 {
+			return array[0], nil
+		}
+		return array, nil
 	case cFLOAT64:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
-	case cURATIONAL:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
-	case cSRATIONAL:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
-	case cARRAY | cUBYTE:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
-	case cARRAY | cUSHORT:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
-	case cARRAY | cULONG:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
-	case cARRAY | cSBYTE:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
-	case cARRAY | cSSHORT:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
-	case cARRAY | cSLONG:
-		return ifd.readValueFromOffset(tag.valueOrOffset(), tag.TypeID(), tag.countOrComponents())
+		array := make([]float64, count)
+		for i := range array {
+			array[i] = math.Float64frombits(ifd.endian.Uint64(data[i*8:]))
+		}
+		if count == 1 {
+			return array[0], nil
+		}
+		return array, nil
 	}
-	return int(0), &exifError{"Reading EXIF tag value failed"}
+	return nil, &exifError{"Reading EXIF tag value failed"}
 }
 
 const (
+	ExifTagNewSubfileType              uint16 = 0xFE
 	ExifTagImageWidth                  uint16 = 0x100
 	ExifTagImageHeight                 uint16 = 0x101
 	ExifTagBitsPerSample               uint16 = 0x102
@@ -369,6 +478,7 @@ const (
 	ExifTagSoftware                    uint16 = 0x131
 	ExifTagDateTime                    uint16 = 0x132
 	ExifTagArtist                      uint16 = 0x13B
+	ExifTagSubIFDs                     uint16 = 0x14A
 	ExifTagWhitePoint                  uint16 = 0x13E
 	ExifTagPrimaryChromaticities       uint16 = 0x13F
 	ExifTagJPEGInterchangeFormat       uint16 = 0x201
@@ -378,6 +488,9 @@ const (
 	ExifTagYCbCrPositioning            uint16 = 0x213
 	ExifTagReferenceBlackWhite         uint16 = 0x214
 	ExifTagCopyright                   uint16 = 0x8298
+	ExifTagDNGVersion                  uint16 = 0xC612
+	ExifTagDNGBackwardVersion          uint16 = 0xC613
+	ExifTagUniqueCameraModel           uint16 = 0xC614
 
 	ExifTagExposureTime              uint16 = 0x829A
 	ExifTagFNumber                   uint16 = 0x829D
@@ -394,6 +507,9 @@ const (
 	ExifTagExifVersion               uint16 = 0x9000
 	ExifTagDateTimeOriginal          uint16 = 0x9003
 	ExifTagDateTimeDigitized         uint16 = 0x9004
+	ExifTagOffsetTime                uint16 = 0x9010
+	ExifTagOffsetTimeOriginal        uint16 = 0x9011
+	ExifTagOffsetTimeDigitized       uint16 = 0x9012
 	ExifTagComponentsConfiguration   uint16 = 0x9101
 	ExifTagCompressedBitsPerPixel    uint16 = 0x9102
 	ExifTagShutterSpeedValue         uint16 = 0x9201
@@ -496,6 +612,7 @@ type tExifTagDescr struct {
 
 var aExifTagDescr = map[uint16]tExifTagDescr{
 	// Primary tags
+	ExifTagNewSubfileType:              {tag: cIFDZERO, name: "NewSubfileType", id: ExifTagNewSubfileType},
 	ExifTagImageWidth:                  {tag: cIFDZERO, name: "ImageWidth", id: ExifTagImageWidth},
 	ExifTagImageHeight:                 {tag: cIFDZERO, name: "ImageLength", id: ExifTagImageHeight},
 	ExifTagBitsPerSample:               {tag: cIFDZERO, name: "BitsPerSample", id: ExifTagBitsPerSample},
@@ -517,6 +634,7 @@ var aExifTagDescr = map[uint16]tExifTagDescr{
 	ExifTagSoftware:                    {tag: cIFDZERO, name: "Software", id: ExifTagSoftware},
 	ExifTagDateTime:                    {tag: cIFDZERO, name: "DateTime", id: ExifTagDateTime},
 	ExifTagArtist:                      {tag: cIFDZERO, name: "Artist", id: ExifTagArtist},
+	ExifTagSubIFDs:                     {tag: cIFDZERO, name: "SubIFDs", id: ExifTagSubIFDs},
 	ExifTagWhitePoint:                  {tag: cIFDZERO, name: "WhitePoint", id: ExifTagWhitePoint},
 	ExifTagPrimaryChromaticities:       {tag: cIFDZERO, name: "PrimaryChromaticities", id: ExifTagPrimaryChromaticities},
 	ExifTagJPEGInterchangeFormat:       {tag: cIFDZERO, name: "JPEGInterchangeFormat", id: ExifTagJPEGInterchangeFormat},
@@ -526,6 +644,9 @@ var aExifTagDescr = map[uint16]tExifTagDescr{
 	ExifTagYCbCrPositioning:            {tag: cIFDZERO, name: "YCbCrPositioning", id: ExifTagYCbCrPositioning},
 	ExifTagReferenceBlackWhite:         {tag: cIFDZERO, name: "ReferenceBlackWhite", id: ExifTagReferenceBlackWhite},
 	ExifTagCopyright:                   {tag: cIFDZERO, name: "Copyright", id: ExifTagCopyright},
+	ExifTagDNGVersion:                  {tag: cIFDZERO, name: "DNGVersion", id: ExifTagDNGVersion},
+	ExifTagDNGBackwardVersion:          {tag: cIFDZERO, name: "DNGBackwardVersion", id: ExifTagDNGBackwardVersion},
+	ExifTagUniqueCameraModel:           {tag: cIFDZERO, name: "UniqueCameraModel", id: ExifTagUniqueCameraModel},
 
 	// EXIF tags
 	ExifTagExposureTime:              {tag: cIFDEXIF, name: "ExposureTime", id: ExifTagExposureTime},
@@ -543,6 +664,9 @@ var aExifTagDescr = map[uint16]tExifTagDescr{
 	ExifTagExifVersion:               {tag: cIFDEXIF, name: "ExifVersion", id: ExifTagExifVersion},
 	ExifTagDateTimeOriginal:          {tag: cIFDEXIF, name: "DateTimeOriginal", id: ExifTagDateTimeOriginal},
 	ExifTagDateTimeDigitized:         {tag: cIFDEXIF, name: "DateTimeDigitized", id: ExifTagDateTimeDigitized},
+	ExifTagOffsetTime:                {tag: cIFDEXIF, name: "OffsetTime", id: ExifTagOffsetTime},
+	ExifTagOffsetTimeOriginal:        {tag: cIFDEXIF, name: "OffsetTimeOriginal", id: ExifTagOffsetTimeOriginal},
+	ExifTagOffsetTimeDigitized:       {tag: cIFDEXIF, name: "OffsetTimeDigitized", id: ExifTagOffsetTimeDigitized},
 	ExifTagComponentsConfiguration:   {tag: cIFDEXIF, name: "ComponentsConfiguration", id: ExifTagComponentsConfiguration},
 	ExifTagCompressedBitsPerPixel:    {tag: cIFDEXIF, name: "CompressedBitsPerPixel", id: ExifTagCompressedBitsPerPixel},
 	ExifTagShutterSpeedValue:         {tag: cIFDEXIF, name: "ShutterSpeedValue", id: ExifTagShutterSpeedValue},
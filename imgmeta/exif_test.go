@@ -0,0 +1,47 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EXIF", func() {
+
+	It("should read ASCII, SHORT and RATIONAL values", func() {
+		image := readJpegFile(sampleJpeg)
+
+		Expect(image.ReadTagValue("EXIF", ExifTagMake)).Should(Equal("Kamera-Hersteller"))
+		Expect(image.ReadTagValue("EXIF", ExifTagDateTimeOriginal)).Should(Equal("2020:05:03 17:10:36"))
+		Expect(image.ReadTagValue("EXIF", ExifTagPixelXDimension)).Should(Equal(uint16(500)))
+		Expect(image.ReadTagValue("EXIF", ExifTagXResolution)).Should(Equal(72.0))
+	})
+
+	It("should fail for missing tags", func() {
+		image := readJpegFile(sampleJpeg)
+
+		_, err := image.ReadTagValue("EXIF", ExifTagFNumber)
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should fail for an EXIF segment without a complete TIFF header", func() {
+		original, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		Expect(writer.Replace([]byte("Exif\x00\x00"), Segment{Marker: MarkerAPP0 + 1, Payload: []byte("Exif\x00\x00MM")})).Should(Succeed())
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+
+		image, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		_, err = image.ReadTagValue("EXIF", ExifTagMake)
+		Expect(err).ShouldNot(BeNil())
+		Expect(image.Orientation()).Should(Equal(uint16(1)))
+	})
+
+})
@@ -0,0 +1,554 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Editing EXIF
+
+An ExifEditor reads the IFDs of an EXIF TIFF structure (see exif.go), changes their tags and lays them out again:
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    TIFF header      8 bytes  byte order of the original
+    IFD0                ...   with its data area and the links to the Exif and the GPS IFD
+    Exif IFD            ...   with the link to the Interop IFD
+    Interop IFD         ...
+    GPS IFD             ...
+    IFD1                ...   thumbnail IFD, linked by IFD0, if the EXIF has a JPEG thumbnail
+    Thumbnail           ...   JPEG thumbnail
+    MakerNote           ...   at its original offset, the blocks above are placed around it
+
+Vendors store offsets in their MakerNotes that are relative to the TIFF header, so the MakerNote is never moved.
+IFDs without tags are left out. The whole structure has to fit into one APP1 segment.
+
+*/
+
+// tExifEntry is a tag with its undecoded value, as it is stored in an IFD
+type tExifEntry struct {
+	id     uint16
+	typeID uint16 // field type without cARRAY
+	count  uint32
+	data   []byte           // value in the byte order endian
+	endian binary.ByteOrder // byte order of data
+	offset uint32           // position of a value that is not stored in the data area of its IFD, e.g. a MakerNote
+}
+
+// tRawExif is implemented by EXIF sections that can return tags with their undecoded value
+type tRawExif interface {
+	rawTag(tagID uint16, ifdType uint16) (tExifEntry, bool)
+}
+
+// in returns the entry with its value converted to the byte order endian
+func (e tExifEntry) in(endian binary.ByteOrder) tExifEntry {
+	if e.endian == nil || e.endian == endian {
+		e.endian = endian
+		return e
+	}
+
+	unit := 1
+	if int(e.typeID) < len(aExifTagFieldSize) {
+		unit = aExifTagFieldSize[e.typeID]
+	}
+	if e.typeID == cURATIONAL || e.typeID == cSRATIONAL {
+		unit = 4 // numerator and denominator are swapped on their own
+	}
+	data := append([]byte{}, e.data...)
+	if unit > 1 {
+		for i := 0; i+unit <= len(data); i += unit {
+			for j, k := i, i+unit-1; j < k; j, k = j+1, k-1 {
+				data[j], data[k] = data[k], data[j]
+			}
+		}
+	}
+	e.data, e.endian = data, endian
+	return e
+}
+
+// ifdSize returns the size of an IFD with its data area
+func ifdSize(entries []tExifEntry) uint32 {
+	size := 2 + 12*uint32(len(entries)) + 4
+	for _, e := range entries {
+		if len(e.data) > 4 && e.offset == 0 {
+			size += uint32(len(e.data)+1) &^ 1
+		}
+	}
+	return size
+}
+
+// writeIFD writes the entries sorted by tag ID, followed by the link to the next IFD and the data area.
+// offset is the position of the IFD relative to the TIFF header. Values with an offset of their own are not
+// written, only linked.
+func writeIFD(buf *bytes.Buffer, endian binary.ByteOrder, entries []tExifEntry, offset uint32, next uint32) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+
+	dataOffset := offset + 2 + 12*uint32(len(entries)) + 4
+	values := []byte{}
+	binary.Write(buf, endian, uint16(len(entries)))
+	for _, e := range entries {
+		e = e.in(endian)
+		binary.Write(buf, endian, e.id)
+		binary.Write(buf, endian, e.typeID)
+		binary.Write(buf, endian, e.count)
+		if len(e.data) <= 4 {
+			buf.Write(append(append([]byte{}, e.data...), make([]byte, 4-len(e.data))...))
+			continue
+		}
+		if e.offset != 0 {
+			binary.Write(buf, endian, e.offset)
+			continue
+		}
+		binary.Write(buf, endian, dataOffset+uint32(len(values)))
+		values = append(values, e.data...)
+		if len(values)%2 == 1 {
+			values = append(values, 0)
+		}
+	}
+	binary.Write(buf, endian, next)
+	buf.Write(values)
+}
+
+// pointerEntry returns a LONG entry that links to another IFD
+func pointerEntry(id uint16, offset uint32, endian binary.ByteOrder) tExifEntry {
+	data := make([]byte, 4)
+	endian.PutUint32(data, offset)
+	return tExifEntry{id: id, typeID: cULONG, count: 1, data: data, endian: endian}
+}
+
+// cMaxExifSize is the maximum size of a TIFF structure in an APP1 segment, behind the length and "Exif\x00\x00"
+const cMaxExifSize = 0xFFFF - 2 - 6
+
+// IFDs whose tags an ExifEditor changes
+const (
+	ExifIFD0       = cIFDZERO
+	ExifIFDExif    = cIFDEXIF
+	ExifIFDGPS     = cIFDGPS
+	ExifIFDInterop = cIFDINTEROP
+)
+
+// ExifIFD1 is the IFD of the thumbnail, which an ExifEditor keeps only with a JPEG thumbnail
+const ExifIFD1 = cIFDONE
+
+// ExifTag is a tag of an IFD, e.g. {ExifIFDGPS, ExifGpsTagGPSLatitude}
+type ExifTag struct {
+	IFD uint16
+	ID  uint16
+}
+
+// aExifLinks are the IFDs linked by a tag of another IFD, the ID of the tag is the one of the linked IFD
+var aExifLinks = []struct{ parent, child uint16 }{
+	{cIFDZERO, cIFDEXIF},
+	{cIFDZERO, cIFDGPS},
+	{cIFDEXIF, cIFDINTEROP},
+}
+
+// ExifRational is an unsigned rational value, e.g. {1, 250} for an exposure time of 1/250 s
+type ExifRational struct {
+	Numerator   uint32
+	Denominator uint32
+}
+
+// ExifEditor changes the tags of IFD0, the Exif, the GPS and the Interop IFD of an EXIF TIFF structure
+type ExifEditor struct {
+	endian    binary.ByteOrder
+	ifds      map[uint16][]tExifEntry // tags by IFD, without the links between the IFDs
+	thumbnail []byte                  // JPEG thumbnail of IFD1
+	makerNote uint32                  // original offset of the MakerNote, 0 if it may be moved
+	dropped   []ExifTag               // tags that were read but can not be written again
+}
+
+// exifLink reports whether a tag of the IFD parent links to another IFD
+func exifLink(parent uint16, id uint16) bool {
+	for _, link := range aExifLinks {
+		if link.parent == parent && link.child == id {
+			return true
+		}
+	}
+	return false
+}
+
+// NewExifEditor reads a TIFF structure, as stored behind "Exif\x00\x00" in APP1. Without data, the editor
+// starts with an empty big-endian EXIF.
+func NewExifEditor(tiff []byte) (*ExifEditor, error) {
+	e := &ExifEditor{endian: binary.BigEndian, ifds: map[uint16][]tExifEntry{}}
+	if len(tiff) == 0 {
+		return e, nil
+	}
+	if len(tiff) < 8 {
+		return nil, &exifError{"TIFF header is truncated"}
+	}
+	switch binary.BigEndian.Uint16(tiff) {
+	case cINTEL:
+		e.endian = binary.LittleEndian
+	case cMOTOROLA:
+	default:
+		return nil, &exifError{"Unknown TIFF byte order"}
+	}
+	if e.endian.Uint16(tiff[2:]) != cTIFFSignature {
+		return nil, &exifError{"Wrong TIFF signature"}
+	}
+
+	ifd0 := tExifIFD{offset: e.endian.Uint32(tiff[4:]), appblock: tiff, endian: e.endian}
+	if !ifd0.valid() {
+		return nil, &exifError{"IFD0 is out of range"}
+	}
+	queue := []ifdOffsetItem{{offset: ifd0.offset, ifdType: cIFDZERO}}
+	if next := ifd0.next(); next != 0 {
+		queue = append(queue, ifdOffsetItem{offset: next, ifdType: cIFDONE})
+	}
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+		ifd := tExifIFD{offset: item.offset, appblock: tiff, endian: e.endian}
+		if _, done := e.ifds[item.ifdType]; done || !ifd.valid() {
+			log.Warn(fmt.Sprintf("EXIF IFD at offset %d is out of range", item.offset))
+			continue
+		}
+
+		entries := []tExifEntry{}
+		for i := uint32(0); i < ifd.NumberOfTags(); i++ {
+			tag := ifd.GetTag(i)
+			if exifLink(item.ifdType, tag.TagID()) {
+				queue = append(queue, ifdOffsetItem{offset: tag.valueOrOffset(), ifdType: tag.TagID()})
+				continue
+			}
+			data, err := ifd.valueBytes(tag)
+			if err != nil || tag.TypeID()&^cARRAY == cIFDOFFSET || tag.TagID() == ExifTagSubIFDs {
+				log.Warn(fmt.Sprintf("EXIF tag 0x%X of IFD 0x%X can not be rewritten and is dropped", tag.TagID(), item.ifdType))
+				e.dropped = append(e.dropped, ExifTag{IFD: item.ifdType, ID: tag.TagID()})
+				continue
+			}
+			if item.ifdType == cIFDEXIF && tag.TagID() == ExifTagMakerNote && len(data) > 4 {
+				e.makerNote = tag.valueOrOffset()
+			}
+			entries = append(entries, tExifEntry{
+				id:     tag.TagID(),
+				typeID: tag.TypeID() &^ cARRAY,
+				count:  tag.countOrComponents(),
+				data:   append([]byte{}, data...),
+				endian: e.endian,
+			})
+		}
+		e.ifds[item.ifdType] = entries
+	}
+
+	e.readThumbnail(tiff)
+	return e, nil
+}
+
+// readThumbnail copies the JPEG thumbnail of IFD1, IFD1 is dropped if it has none
+func (e *ExifEditor) readThumbnail(tiff []byte) {
+	if _, ok := e.ifds[cIFDONE]; !ok {
+		return
+	}
+	offset, hasOffset := e.uint32Value(cIFDONE, ExifTagJPEGInterchangeFormat)
+	length, hasLength := e.uint32Value(cIFDONE, ExifTagJPEGInterchangeFormatLength)
+	if !hasOffset || !hasLength || uint64(offset)+uint64(length) > uint64(len(tiff)) {
+		log.Warn("EXIF IFD1 has no JPEG thumbnail and is dropped")
+		for _, entry := range e.ifds[cIFDONE] {
+			e.dropped = append(e.dropped, ExifTag{IFD: cIFDONE, ID: entry.id})
+		}
+		delete(e.ifds, cIFDONE)
+		return
+	}
+	e.thumbnail = append([]byte{}, tiff[offset:offset+length]...)
+	e.Delete(cIFDONE, ExifTagJPEGInterchangeFormat)
+}
+
+// uint32Value returns a SHORT or LONG tag with a single value
+func (e *ExifEditor) uint32Value(ifd uint16, id uint16) (uint32, bool) {
+	value, err := e.Value(ifd, id)
+	switch v := value.(type) {
+	case uint16:
+		return uint32(v), err == nil
+	case uint32:
+		return v, err == nil
+	}
+	return 0, false
+}
+
+// ByteOrder returns the byte order of the EXIF, which Encode keeps
+func (e *ExifEditor) ByteOrder() binary.ByteOrder {
+	return e.endian
+}
+
+// Value returns a tag of an IFD, decoded like ReadTagValue does
+func (e *ExifEditor) Value(ifd uint16, id uint16) (interface{}, error) {
+	for _, entry := range e.ifds[ifd] {
+		if entry.id == id {
+			buf := &bytes.Buffer{}
+			writeIFD(buf, e.endian, []tExifEntry{entry}, 0, 0)
+			single := tExifIFD{appblock: buf.Bytes(), endian: e.endian}
+			return single.ReadValue(single.GetTag(0))
+		}
+	}
+	return nil, &exifError{fmt.Sprintf("EXIF tag 0x%X not found", id)}
+}
+
+// Tags returns the IDs of the tags of an IFD, in ascending order
+func (e *ExifEditor) Tags(ifd uint16) []uint16 {
+	ids := []uint16{}
+	for _, entry := range e.ifds[ifd] {
+		ids = append(ids, entry.id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Dropped returns the tags that the editor read but leaves out when it encodes the EXIF, e.g. SubIFDs, other
+// links to IFDs and the tags of an IFD1 without a JPEG thumbnail
+func (e *ExifEditor) Dropped() []ExifTag {
+	return append([]ExifTag{}, e.dropped...)
+}
+
+// ExifTagName returns the name of a tag of an IFD, e.g. 'GPSLatitude' for ExifGpsTagGPSLatitude in ExifIFDGPS,
+// or its ID in hex if it is unknown
+func ExifTagName(ifd uint16, id uint16) string {
+	if descr, ok := aExifTagDescr[id]; ok && (descr.tag == cIFDGPS) == (ifd == cIFDGPS) {
+		return descr.name
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
+
+// checkTag returns an error if the tag of the IFD can not be changed
+func checkTag(ifd uint16, id uint16) error {
+	if ifd != cIFDZERO && ifd != cIFDEXIF && ifd != cIFDGPS && ifd != cIFDINTEROP {
+		return &exifError{fmt.Sprintf("EXIF IFD 0x%X can not be edited", ifd)}
+	}
+	if exifLink(ifd, id) || (ifd == cIFDZERO && id == ExifTagSubIFDs) {
+		return &exifError{fmt.Sprintf("EXIF tag 0x%X links to another IFD", id)}
+	}
+	return nil
+}
+
+// Set adds or replaces a tag of an IFD, e.g. Set(ExifIFD0, ExifTagCopyright, "Joerg Kuetemeier"). Values are
+// written by their type:
+//
+//	string                       ASCII
+//	uint8                        BYTE
+//	[]byte                       UNDEFINED, or BYTE if the tag is a BYTE tag already
+//	uint16, []uint16             SHORT
+//	uint32, []uint32             LONG
+//	int16, []int16               SSHORT
+//	int32, []int32               SLONG
+//	ExifRational, []ExifRational RATIONAL
+func (e *ExifEditor) Set(ifd uint16, id uint16, value interface{}) error {
+	if err := checkTag(ifd, id); err != nil {
+		return err
+	}
+	entry, err := exifEntry(id, value, e.endian)
+	if err != nil {
+		return err
+	}
+	if ifd == cIFDEXIF && id == ExifTagMakerNote {
+		e.makerNote = 0
+	}
+	for i, old := range e.ifds[ifd] {
+		if old.id == id {
+			if entry.typeID == cUNDEFINED && old.typeID == cUBYTE {
+				entry.typeID = cUBYTE
+			}
+			e.ifds[ifd][i] = entry
+			return nil
+		}
+	}
+	e.ifds[ifd] = append(e.ifds[ifd], entry)
+	return nil
+}
+
+// Delete removes a tag of an IFD and reports whether it was there
+func (e *ExifEditor) Delete(ifd uint16, id uint16) bool {
+	for i, entry := range e.ifds[ifd] {
+		if entry.id == id {
+			if ifd == cIFDEXIF && id == ExifTagMakerNote {
+				e.makerNote = 0
+			}
+			e.ifds[ifd] = append(e.ifds[ifd][:i], e.ifds[ifd][i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// exifEntry encodes a tag value, see Set
+func exifEntry(id uint16, value interface{}, endian binary.ByteOrder) (tExifEntry, error) {
+	entry := tExifEntry{id: id, endian: endian}
+	switch v := value.(type) {
+	case string:
+		entry.typeID, entry.data = cASCII, append([]byte(v), 0)
+	case []byte:
+		entry.typeID, entry.data = cUNDEFINED, append([]byte{}, v...)
+	case uint8:
+		entry.typeID, entry.data = cUBYTE, []byte{v}
+	case uint16, []uint16:
+		entry.typeID = cUSHORT
+	case uint32, []uint32:
+		entry.typeID = cULONG
+	case int16, []int16:
+		entry.typeID = cSSHORT
+	case int32, []int32:
+		entry.typeID = cSLONG
+	case ExifRational, []ExifRational:
+		entry.typeID = cURATIONAL
+	default:
+		return entry, &exifError{fmt.Sprintf("EXIF tag 0x%X can not be written as %T", id, value)}
+	}
+	if entry.data == nil {
+		buf := &bytes.Buffer{}
+		binary.Write(buf, endian, value)
+		entry.data = buf.Bytes()
+	}
+	entry.count = uint32(len(entry.data) / aExifTagFieldSize[entry.typeID])
+	if entry.count == 0 {
+		return entry, &exifError{fmt.Sprintf("EXIF tag 0x%X has no value", id)}
+	}
+	return entry, nil
+}
+
+// tExifLayout hands out the positions of the blocks of a TIFF structure, leaving out a reserved range
+type tExifLayout struct {
+	end      uint32    // end of the blocks placed so far
+	reserved [2]uint32 // range that is kept free for the MakerNote
+}
+
+// place returns the position of a block of size bytes, at an even offset
+func (l *tExifLayout) place(size uint32) uint32 {
+	offset := (l.end + 1) &^ 1
+	if offset < l.reserved[1] && offset+size > l.reserved[0] {
+		offset = (l.reserved[1] + 1) &^ 1
+	}
+	l.end = offset + size
+	return offset
+}
+
+// Encode writes the TIFF structure in the original byte order, with the offsets of all IFDs and values computed
+// again. An error is returned if it does not fit into an APP1 segment.
+func (e *ExifEditor) Encode() ([]byte, error) {
+	order := []uint16{cIFDZERO, cIFDEXIF, cIFDINTEROP, cIFDGPS, cIFDONE}
+	written := map[uint16]bool{cIFDZERO: true, cIFDONE: e.thumbnail != nil}
+	entries := map[uint16][]tExifEntry{}
+	for _, ifd := range order {
+		entries[ifd] = append([]tExifEntry{}, e.ifds[ifd]...)
+		if ifd != cIFDONE && len(entries[ifd]) > 0 {
+			written[ifd] = true
+		}
+	}
+	if written[cIFDINTEROP] {
+		written[cIFDEXIF] = true
+	}
+
+	// the links are added first, so the sizes of the IFDs are known
+	for _, link := range aExifLinks {
+		if written[link.child] {
+			entries[link.parent] = append(entries[link.parent], pointerEntry(link.child, 0, e.endian))
+		}
+	}
+	if written[cIFDONE] {
+		entries[cIFDONE] = append(entries[cIFDONE], pointerEntry(ExifTagJPEGInterchangeFormat, 0, e.endian))
+	}
+
+	layout := &tExifLayout{end: 8}
+	if e.makerNote >= 8 {
+		for i, entry := range entries[cIFDEXIF] {
+			if entry.id == ExifTagMakerNote {
+				entries[cIFDEXIF][i].offset = e.makerNote
+				layout.reserved = [2]uint32{e.makerNote, e.makerNote + uint32(len(entry.data))}
+			}
+		}
+	}
+	offsets := map[uint16]uint32{}
+	for _, ifd := range order {
+		if written[ifd] {
+			offsets[ifd] = layout.place(ifdSize(entries[ifd]))
+		}
+	}
+	thumbnail := layout.place(uint32(len(e.thumbnail)))
+
+	for _, link := range aExifLinks {
+		if written[link.child] {
+			setEntry(entries[link.parent], pointerEntry(link.child, offsets[link.child], e.endian))
+		}
+	}
+	if written[cIFDONE] {
+		setEntry(entries[cIFDONE], pointerEntry(ExifTagJPEGInterchangeFormat, thumbnail, e.endian))
+	}
+
+	size := layout.end
+	if layout.reserved[1] > size {
+		size = layout.reserved[1]
+	}
+	if size > cMaxExifSize {
+		return nil, &exifError{fmt.Sprintf("EXIF is too large for an APP1 segment (%d bytes)", size)}
+	}
+
+	out := make([]byte, size)
+	if e.endian == binary.LittleEndian {
+		binary.BigEndian.PutUint16(out, cINTEL)
+	} else {
+		binary.BigEndian.PutUint16(out, cMOTOROLA)
+	}
+	e.endian.PutUint16(out[2:], cTIFFSignature)
+	e.endian.PutUint32(out[4:], offsets[cIFDZERO])
+	for _, ifd := range order {
+		if !written[ifd] {
+			continue
+		}
+		next := uint32(0)
+		if ifd == cIFDZERO && written[cIFDONE] {
+			next = offsets[cIFDONE]
+		}
+		buf := &bytes.Buffer{}
+		writeIFD(buf, e.endian, entries[ifd], offsets[ifd], next)
+		copy(out[offsets[ifd]:], buf.Bytes())
+		for _, entry := range entries[ifd] {
+			if entry.offset != 0 {
+				copy(out[entry.offset:], entry.in(e.endian).data)
+			}
+		}
+	}
+	copy(out[thumbnail:], e.thumbnail)
+	return out, nil
+}
+
+// setEntry replaces the entry with the same ID
+func setEntry(entries []tExifEntry, entry tExifEntry) {
+	for i := range entries {
+		if entries[i].id == entry.id {
+			entries[i] = entry
+		}
+	}
+}
+
+// Exif returns an editor for the EXIF of the JPEG, which is empty if the JPEG has none
+func (w *JpegWriter) Exif() (*ExifEditor, error) {
+	index := w.Find(cEXIF, idEXIF)
+	if index < 0 {
+		return NewExifEditor(nil)
+	}
+	return NewExifEditor(w.Segments[index].Payload[len(idEXIF):])
+}
+
+// SetExif replaces the EXIF of the JPEG by the one of the editor. If the JPEG has none, the APP1 segment is added
+// behind the APP0 segments, where readers expect it.
+func (w *JpegWriter) SetExif(e *ExifEditor) error {
+	tiff, err := e.Encode()
+	if err != nil {
+		return err
+	}
+	segment := Segment{Marker: cEXIF, Payload: append(append([]byte{}, idEXIF...), tiff...)}
+	if w.Find(cEXIF, idEXIF) >= 0 {
+		return w.Replace(idEXIF, segment)
+	}
+	index := 0
+	for index < len(w.Segments) && w.Segments[index].Marker == MarkerAPP0 {
+		index++
+	}
+	w.Segments = append(w.Segments[:index], append([]Segment{segment}, w.Segments[index:]...)...)
+	return nil
+}
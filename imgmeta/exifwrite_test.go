@@ -0,0 +1,174 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// makerNoteTiff returns a little-endian TIFF whose Exif IFD has a MakerNote
+func makerNoteTiff(makerNote []byte) []byte {
+	return buildTiff(binary.LittleEndian, []testIFD{
+		{tags: map[uint16]interface{}{
+			ExifTagMake: "Canon",
+			0x8769:      testIFDRef(1),
+		}},
+		{tags: map[uint16]interface{}{
+			ExifTagDateTimeOriginal: "2021:06:01 12:00:00",
+			ExifTagMakerNote:        makerNote,
+		}},
+	})
+}
+
+var _ = Describe("EXIF writing", func() {
+
+	It("should change the tags of a JPEG and keep everything else", func() {
+		original, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		editor, err := writer.Exif()
+		Expect(err).Should(BeNil())
+		Expect(editor.ByteOrder()).Should(Equal(binary.BigEndian))
+		Expect(editor.Value(ExifIFDExif, ExifTagDateTimeOriginal)).Should(Equal("2020:05:03 17:10:36"))
+
+		Expect(editor.Set(ExifIFD0, ExifTagCopyright, "Joerg Kuetemeier")).Should(Succeed())
+		Expect(editor.Set(ExifIFDExif, ExifTagDateTimeOriginal, "2020:05:03 18:10:36")).Should(Succeed())
+		Expect(editor.Set(ExifIFDExif, ExifTagOffsetTimeOriginal, "+02:00")).Should(Succeed())
+		Expect(editor.Set(ExifIFDGPS, ExifGpsTagGPSLatitudeRef, "N")).Should(Succeed())
+		Expect(editor.Set(ExifIFDGPS, ExifGpsTagGPSLatitude, []ExifRational{{52, 1}, {31, 1}, {12, 1}})).Should(Succeed())
+		Expect(editor.Delete(ExifIFD0, ExifTagArtist)).Should(BeTrue())
+		Expect(editor.Delete(ExifIFD0, ExifTagArtist)).Should(BeFalse())
+		Expect(writer.SetExif(editor)).Should(Succeed())
+
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+		image, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadTagValue("EXIF", ExifTagCopyright)).Should(Equal("Joerg Kuetemeier"))
+		Expect(image.ReadTagValue("EXIF", ExifTagModel)).Should(Equal("Kamera-Modell"))
+		_, err = image.ReadTagValue("EXIF", ExifTagArtist)
+		Expect(err).ShouldNot(BeNil())
+		Expect(*image.Metadata().DateTimeOriginal).Should(Equal(MetadataValue{Value: "2020-05-03T18:10:36+02:00", Source: MetadataSourceEXIF}))
+		Expect(*image.Summary().GPSLatitude).Should(BeNumerically("~", 52.52, 1e-9))
+
+		before, err := Decode(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		hash, err := before.ContentHash(HashSHA256)
+		Expect(err).Should(BeNil())
+		Expect(image.ContentHash(HashSHA256)).Should(Equal(hash))
+	})
+
+	It("should keep the byte order and the offset of the MakerNote", func() {
+		makerNote := append([]byte("Vendor MakerNote"), make([]byte, 48)...)
+		tiff := makerNoteTiff(makerNote)
+		editor, err := NewExifEditor(tiff)
+		Expect(err).Should(BeNil())
+
+		// a long description moves the IFDs behind the MakerNote
+		long := string(bytes.Repeat([]byte("x"), 300))
+		Expect(editor.Set(ExifIFD0, ExifTagImageDescription, long)).Should(Succeed())
+		Expect(editor.Set(ExifIFDInterop, 0x0001, "R98")).Should(Succeed())
+		encoded, err := editor.Encode()
+		Expect(err).Should(BeNil())
+		Expect(string(encoded[:2])).Should(Equal("II"))
+		Expect(bytes.Index(encoded, makerNote)).Should(Equal(bytes.Index(tiff, makerNote)))
+
+		image, err := Decode(bytes.NewReader(encoded))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadTagValue("EXIF", ExifTagImageDescription)).Should(Equal(long))
+		Expect(image.ReadTagValue("EXIF", ExifTagMakerNote)).Should(Equal(makerNote))
+		Expect(image.ReadTagValue("EXIF", ExifTagDateTimeOriginal)).Should(Equal("2021:06:01 12:00:00"))
+		Expect(image.ReadTagValue("EXIF", 0x0001)).Should(Equal("R98"))
+	})
+
+	It("should move the JPEG thumbnail of IFD1", func() {
+		thumbnail := []byte{0xFF, 0xD8, 't', 'h', 'u', 'm', 'b', 0xFF, 0xD9}
+		ifds := func(offset uint32) []testIFD {
+			return []testIFD{
+				{tags: map[uint16]interface{}{ExifTagMake: "Canon"}, next: 1},
+				{tags: map[uint16]interface{}{
+					ExifTagCompression:                 []uint16{6},
+					ExifTagJPEGInterchangeFormat:       []uint32{offset},
+					ExifTagJPEGInterchangeFormatLength: []uint32{uint32(len(thumbnail))},
+				}},
+			}
+		}
+		tiff := buildTiff(binary.BigEndian, ifds(0))
+		tiff = append(buildTiff(binary.BigEndian, ifds(uint32(len(tiff)))), thumbnail...)
+
+		editor, err := NewExifEditor(tiff)
+		Expect(err).Should(BeNil())
+		Expect(editor.Set(ExifIFD0, ExifTagModel, "Canon EOS R5 with a long model name")).Should(Succeed())
+		encoded, err := editor.Encode()
+		Expect(err).Should(BeNil())
+		Expect(bytes.Index(encoded, thumbnail)).Should(BeNumerically(">", bytes.Index(tiff, thumbnail)))
+
+		thumbnailEditor, err := NewExifEditor(encoded)
+		Expect(err).Should(BeNil())
+		Expect(thumbnailEditor.Value(ExifIFD0, ExifTagModel)).Should(Equal("Canon EOS R5 with a long model name"))
+		encodedAgain, err := thumbnailEditor.Encode()
+		Expect(err).Should(BeNil())
+		Expect(encodedAgain).Should(Equal(encoded))
+	})
+
+	It("should report the tags it can not write again", func() {
+		tiff := buildTiff(binary.LittleEndian, []testIFD{
+			{tags: map[uint16]interface{}{ExifTagMake: "Canon"}, next: 1, subIFDs: []int{2}},
+			{tags: map[uint16]interface{}{ExifTagCompression: []uint16{1}, ExifTagImageWidth: []uint32{160}}},
+			{tags: map[uint16]interface{}{ExifTagImageWidth: []uint32{6000}}},
+		})
+		editor, err := NewExifEditor(tiff)
+		Expect(err).Should(BeNil())
+		Expect(editor.Dropped()).Should(ConsistOf(
+			ExifTag{IFD: ExifIFD0, ID: ExifTagSubIFDs},
+			ExifTag{IFD: ExifIFD1, ID: ExifTagCompression},
+			ExifTag{IFD: ExifIFD1, ID: ExifTagImageWidth},
+		))
+		Expect(editor.Tags(ExifIFD0)).Should(Equal([]uint16{ExifTagMake}))
+	})
+
+	It("should reject tags it can not write", func() {
+		editor, err := NewExifEditor(nil)
+		Expect(err).Should(BeNil())
+		Expect(editor.Set(ExifIFD0, 0x8769, uint32(8))).ShouldNot(Succeed())
+		Expect(editor.Set(0x1234, ExifTagMake, "Canon")).ShouldNot(Succeed())
+		Expect(editor.Set(ExifIFD0, ExifTagMake, 1.5)).ShouldNot(Succeed())
+		Expect(editor.Set(ExifIFD0, ExifTagMake, []uint16{})).ShouldNot(Succeed())
+
+		Expect(editor.Set(ExifIFDExif, ExifTagUserComment, make([]byte, 0x10000))).Should(Succeed())
+		_, err = editor.Encode()
+		Expect(err).ShouldNot(BeNil())
+
+		_, err = NewExifEditor([]byte("XX\x00\x2a\x00\x00\x00\x08"))
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should add the EXIF to a JPEG without one", func() {
+		original, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		Expect(writer.Delete(MarkerAPP0+1, []byte("Exif\x00\x00"))).Should(Equal(1))
+
+		editor, err := writer.Exif()
+		Expect(err).Should(BeNil())
+		Expect(editor.Set(ExifIFD0, ExifTagOrientation, uint16(6))).Should(Succeed())
+		Expect(writer.SetExif(editor)).Should(Succeed())
+		Expect(writer.Segments[1].Marker).Should(Equal(MarkerAPP0 + 1))
+		Expect(writer.Segments[1].HasID([]byte("Exif\x00\x00"))).Should(BeTrue())
+
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+		image, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadTagValue("EXIF", ExifTagOrientation)).Should(Equal(uint16(6)))
+	})
+
+})
@@ -0,0 +1,9 @@
+package imgmeta
+
+// SaveFormats returns a function that restores the registered formats, so that tests can register their own
+func SaveFormats() func() {
+	saved := append([]tFormat{}, aFormats...)
+	return func() {
+		aFormats = saved
+	}
+}
@@ -0,0 +1,102 @@
+package imgmeta
+
+import (
+	"io"
+	"os"
+)
+
+// Decoder reads the metadata of one image format into a format-neutral Image
+type Decoder interface {
+	Decode(r io.ReadSeeker) (Image, error)
+}
+
+// DecoderFunc adapts a function to the Decoder interface
+type DecoderFunc func(r io.ReadSeeker) (Image, error)
+
+// Decode calls f(r)
+func (f DecoderFunc) Decode(r io.ReadSeeker) (Image, error) {
+	return f(r)
+}
+
+// ErrUnknownFormat is returned by Open for files that match no registered format
+var ErrUnknownFormat error = &exifError{"Unknown image format"}
+
+type tFormat struct {
+	name    string
+	magic   string
+	decoder Decoder
+}
+
+var aFormats []tFormat
+
+// RegisterFormat registers a decoder for a format. Name is the name of the format, like "jpeg".
+// Magic is the magic prefix that identifies the format's encoding, '?' matches any one byte.
+// Formats are tried in the order they are registered, usually from init functions.
+func RegisterFormat(name, magic string, decoder Decoder) {
+	aFormats = append(aFormats, tFormat{name: name, magic: magic, decoder: decoder})
+}
+
+// match reports whether magic matches the start of header
+func (f tFormat) match(header []byte) bool {
+	if len(header) < len(f.magic) {
+		return false
+	}
+	for i := 0; i < len(f.magic); i++ {
+		if f.magic[i] != '?' && f.magic[i] != header[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sniff returns the first registered format that matches the start of r, r is rewound afterwards
+func sniff(r io.ReadSeeker) (tFormat, error) {
+	size := 0
+	for _, f := range aFormats {
+		if len(f.magic) > size {
+			size = len(f.magic)
+		}
+	}
+
+	header := make([]byte, size)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return tFormat{}, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return tFormat{}, err
+	}
+
+	for _, f := range aFormats {
+		if f.match(header[:n]) {
+			return f, nil
+		}
+	}
+	return tFormat{}, ErrUnknownFormat
+}
+
+// Decode detects the format of r by its magic bytes and reads the metadata with the registered decoder.
+// A decoder may refine the format name, e.g. "dng" for a TIFF with a DNGVersion tag.
+func Decode(r io.ReadSeeker) (Image, error) {
+	format, err := sniff(r)
+	if err != nil {
+		return Image{}, err
+	}
+
+	image, err := format.decoder.Decode(r)
+	if image.format == "" {
+		image.format = format.name
+	}
+	return image, err
+}
+
+// Open opens the file at path and reads its metadata, see Decode
+func Open(path string) (Image, error) {
+	fhnd, err := os.Open(path)
+	if err != nil {
+		return Image{}, err
+	}
+	defer fhnd.Close()
+
+	return Decode(fhnd)
+}
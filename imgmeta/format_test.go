@@ -0,0 +1,45 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Format registry", func() {
+
+	It("should detect JPEG files", func() {
+		image, err := Open(sampleJpeg)
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("jpeg"))
+		Expect(image.ReadTagValue("SOF0", SOF0ImageWidth)).Should(Equal(uint32(500)))
+	})
+
+	It("should reject unknown files", func() {
+		_, err := Open("../README.md")
+		Expect(err).Should(Equal(ErrUnknownFormat))
+	})
+
+	It("should dispatch to registered decoders", func() {
+		restore := SaveFormats()
+		defer restore()
+		called := false
+		RegisterFormat("test", "TST?FMT", DecoderFunc(func(r io.ReadSeeker) (Image, error) {
+			called = true
+			return Image{}, nil
+		}))
+
+		image, err := Decode(bytes.NewReader([]byte("TST1FMT and some data")))
+		Expect(err).Should(BeNil())
+		Expect(called).Should(BeTrue())
+		Expect(image.Format()).Should(Equal("test"))
+
+		restore()
+		_, err = Decode(bytes.NewReader([]byte("TST1FMT and some data")))
+		Expect(err).Should(Equal(ErrUnknownFormat))
+	})
+
+})
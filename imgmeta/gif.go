@@ -0,0 +1,263 @@
+package imgmeta
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of a GIF file
+
+    [Record name]               [size]   [description]
+    ---------------------------------------
+    Header                      6 bytes  "GIF87a" or "GIF89a"
+    Logical screen descriptor   7 bytes  width (2), height (2), flags (1), background colour (1), aspect ratio (1)
+    Global colour table           ...    3*2^(size+1) bytes if the flag 0x80 is set, size is flags&0x07
+    Blocks                        ...
+    Trailer                     1 byte   0x3B
+
+All values are little-endian. A block is one of
+
+    0x2C        image descriptor: position (4), size (4), flags (1), local colour table, LZW code size (1), image data
+    0x21 0xF9   graphic control extension: flags (1), delay in 1/100 s (2), transparent colour (1)
+    0x21 0xFE   comment extension: text (ASCII)
+    0x21 0xFF   application extension: identifier and authentication code (11), application data
+    0x21 ...    other extensions (plain text)
+
+The image data and the data of the extensions are stored in sub-blocks: a size byte followed by as many bytes,
+the last sub-block has the size 0. Some application extensions are:
+
+    NETSCAPE2.0, ANIMEXTS1.0    sub-block 1, loop count (2), 0 is an endless loop
+    XMP DataXMP                 the XMP packet, not in sub-blocks but followed by a 257 byte "magic trailer"
+                                (0x01, 0xFF ... 0x00) that ends the sub-block chain wherever a reader jumps in
+
+*/
+
+func init() {
+	RegisterFormat("gif", "GIF87a", DecoderFunc(decodeGif))
+	RegisterFormat("gif", "GIF89a", DecoderFunc(decodeGif))
+}
+
+// Tags of the GIF section
+const (
+	GIFImageWidth  uint16 = 0x0001
+	GIFImageHeight uint16 = 0x0002
+	GIFVersion     uint16 = 0x0003
+	GIFFrameCount  uint16 = 0x0004
+	GIFDuration    uint16 = 0x0005 // total delay of all frames in milliseconds
+	GIFLoopCount   uint16 = 0x0006
+	GIFComment     uint16 = 0x0007
+)
+
+var aGIFTagNames = map[string]uint16{
+	"ImageWidth":  GIFImageWidth,
+	"ImageHeight": GIFImageHeight,
+	"Version":     GIFVersion,
+	"FrameCount":  GIFFrameCount,
+	"Duration":    GIFDuration,
+	"LoopCount":   GIFLoopCount,
+	"Comment":     GIFComment,
+}
+
+const (
+	cGIFImage          = 0x2C
+	cGIFExtension      = 0x21
+	cGIFTrailer        = 0x3B
+	cGIFGraphicControl = 0xF9
+	cGIFCommentExt     = 0xFE
+	cGIFApplication    = 0xFF
+	cGIFColorTable     = 0x80
+	cGIFXMPTrailerSize = 257
+)
+
+// tGIFAPP holds the screen descriptor, the animation and the comments of a GIF
+type tGIFAPP struct {
+	tValuesAPP
+}
+
+func decodeGif(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "gif"}
+	br := bufio.NewReader(r)
+
+	header := make([]byte, 13)
+	if _, err = io.ReadFull(br, header); err != nil || !strings.HasPrefix(string(header), "GIF") {
+		return image, &exifError{"Wrong format"}
+	}
+	gif := &tGIFAPP{tValuesAPP: tValuesAPP{name: "GIF", names: aGIFTagNames, values: map[uint16]interface{}{
+		GIFVersion:     string(header[3:6]),
+		GIFImageWidth:  uint32(binary.LittleEndian.Uint16(header[6:])),
+		GIFImageHeight: uint32(binary.LittleEndian.Uint16(header[8:])),
+	}}}
+	image.apps[gif.Name()] = gif
+	if err = skipColorTable(br, header[10]); err != nil {
+		return image, err
+	}
+
+	frames := uint32(0)
+	duration := uint32(0)
+	comments := []string{}
+	for {
+		introducer, err := br.ReadByte()
+		if err != nil {
+			log.Warn("GIF ended without trailer")
+			break
+		}
+		if introducer == cGIFTrailer {
+			break
+		}
+
+		switch introducer {
+		case cGIFImage:
+			descriptor := make([]byte, 10) // descriptor and LZW code size
+			if _, err = io.ReadFull(br, descriptor[:9]); err != nil {
+				return image, &exifError{"GIF image descriptor is truncated"}
+			}
+			if err = skipColorTable(br, descriptor[8]); err != nil {
+				return image, err
+			}
+			if _, err = io.ReadFull(br, descriptor[9:]); err != nil {
+				return image, &exifError{"GIF image is truncated"}
+			}
+			if _, err = readSubBlocks(br, false); err != nil {
+				return image, err
+			}
+			frames++
+		case cGIFExtension:
+			label, err := br.ReadByte()
+			if err != nil {
+				return image, &exifError{"GIF extension is truncated"}
+			}
+			if label == cGIFApplication {
+				if err = gif.readApplication(&image, br); err != nil {
+					return image, err
+				}
+				continue
+			}
+			data, err := readSubBlocks(br, label == cGIFGraphicControl || label == cGIFCommentExt)
+			if err != nil {
+				return image, err
+			}
+			if label == cGIFGraphicControl && len(data) >= 3 {
+				duration += uint32(binary.LittleEndian.Uint16(data[1:])) * 10
+			} else if label == cGIFCommentExt {
+				comments = append(comments, string(data))
+			}
+		default:
+			log.Warn(fmt.Sprintf("GIF has an unknown block 0x%X", introducer))
+			return image, nil
+		}
+	}
+
+	gif.values[GIFFrameCount] = frames
+	gif.values[GIFDuration] = duration
+	if len(comments) > 0 {
+		gif.values[GIFComment] = strings.Join(comments, "\n")
+	}
+	return image, nil
+}
+
+// readApplication reads the loop count of NETSCAPE2.0 and ANIMEXTS1.0 and the XMP packet of XMP DataXMP
+func (t *tGIFAPP) readApplication(image *Image, br *bufio.Reader) error {
+	id, err := readSubBlock(br)
+	if err != nil {
+		return err
+	}
+
+	switch string(id) {
+	case "NETSCAPE2.0", "ANIMEXTS1.0":
+		data, err := readSubBlocks(br, true)
+		if err != nil {
+			return err
+		}
+		if len(data) >= 3 && data[0] == 1 {
+			t.values[GIFLoopCount] = binary.LittleEndian.Uint16(data[1:])
+		}
+	case "XMP DataXMP":
+		// the size bytes of the sub-blocks are part of the packet
+		raw := []byte{}
+		for {
+			size, err := br.ReadByte()
+			if err != nil {
+				return &exifError{"GIF XMP data is truncated"}
+			}
+			if size == 0 {
+				break
+			}
+			data := make([]byte, int(size)+1)
+			data[0] = size
+			if _, err = io.ReadFull(br, data[1:]); err != nil {
+				return &exifError{"GIF XMP data is truncated"}
+			}
+			raw = append(raw, data...)
+		}
+		if len(raw) < cGIFXMPTrailerSize {
+			log.Warn("GIF XMP data has no magic trailer")
+			return nil
+		}
+		packet := raw[:len(raw)-cGIFXMPTrailerSize]
+		xmp, err := newXMPAPP(packet, packet)
+		if err != nil {
+			log.Warn(err.Error())
+		}
+		image.apps[xmp.Name()] = xmp
+	default:
+		_, err = readSubBlocks(br, false)
+	}
+	return err
+}
+
+// skipColorTable skips the colour table that follows a descriptor with the given flags
+func skipColorTable(br *bufio.Reader, flags byte) error {
+	if flags&cGIFColorTable == 0 {
+		return nil
+	}
+	size := 3 << (flags&0x07 + 1)
+	if _, err := br.Discard(size); err != nil {
+		return &exifError{"GIF colour table is truncated"}
+	}
+	return nil
+}
+
+// readSubBlock reads one sub-block
+func readSubBlock(br *bufio.Reader) ([]byte, error) {
+	size, err := br.ReadByte()
+	if err != nil {
+		return nil, &exifError{"GIF sub-block is truncated"}
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(br, data); err != nil {
+		return nil, &exifError{"GIF sub-block is truncated"}
+	}
+	return data, nil
+}
+
+// readSubBlocks reads the sub-blocks up to the terminating empty sub-block, their data is only
+// kept if keep is set
+func readSubBlocks(br *bufio.Reader, keep bool) ([]byte, error) {
+	data := []byte{}
+	for {
+		size, err := br.ReadByte()
+		if err != nil {
+			return nil, &exifError{"GIF sub-block is truncated"}
+		}
+		if size == 0 {
+			return data, nil
+		}
+		if !keep {
+			if _, err = br.Discard(int(size)); err != nil {
+				return nil, &exifError{"GIF sub-block is truncated"}
+			}
+			continue
+		}
+		block := make([]byte, size)
+		if _, err = io.ReadFull(br, block); err != nil {
+			return nil, &exifError{"GIF sub-block is truncated"}
+		}
+		data = append(data, block...)
+	}
+}
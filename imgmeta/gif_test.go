@@ -0,0 +1,73 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// gifXMP returns an XMP DataXMP application extension with the magic trailer
+func gifXMP(packet string) []byte {
+	ext := append([]byte{0x21, 0xff, 11}, "XMP DataXMP"...)
+	ext = append(ext, packet...)
+	ext = append(ext, 0x01)
+	for i := 0xff; i >= 0; i-- {
+		ext = append(ext, byte(i))
+	}
+	return append(ext, 0)
+}
+
+// sampleGif returns an animation of three frames with 0.5 s delay, looped twice, with a comment and XMP
+func sampleGif() []byte {
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{LoopCount: 2}
+	for i := 0; i < 3; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 120, 80), palette))
+		anim.Delay = append(anim.Delay, 50)
+	}
+	buf := &bytes.Buffer{}
+	gif.EncodeAll(buf, anim)
+	data := buf.Bytes()
+
+	comment := append([]byte{0x21, 0xfe, 5}, "Hello"...)
+	comment = append(comment, 0)
+	extensions := append(comment, gifXMP(testXMP)...)
+	return append(append(append([]byte{}, data[:len(data)-1]...), extensions...), 0x3b)
+}
+
+var _ = Describe("GIF", func() {
+
+	It("should read an animated GIF", func() {
+		image, err := Decode(bytes.NewReader(sampleGif()))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("gif"))
+
+		Expect(image.ReadPropertyValue("GIF", "Version")).Should(Equal("89a"))
+		Expect(image.ReadPropertyValue("GIF", "FrameCount")).Should(Equal(uint32(3)))
+		Expect(image.ReadPropertyValue("GIF", "Duration")).Should(Equal(uint32(1500)))
+		Expect(image.ReadPropertyValue("GIF", "LoopCount")).Should(Equal(uint16(2)))
+		Expect(image.ReadTagValue("GIF", GIFComment)).Should(Equal("Hello"))
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{120, 80}))
+	})
+
+	It("should read a still GIF without a loop", func() {
+		buf := &bytes.Buffer{}
+		gif.Encode(buf, image.NewPaletted(image.Rect(0, 0, 16, 9), color.Palette{color.Black}), nil)
+
+		image, err := Decode(bytes.NewReader(buf.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("GIF", "FrameCount")).Should(Equal(uint32(1)))
+		_, err = image.ReadPropertyValue("GIF", "LoopCount")
+		Expect(err).ShouldNot(BeNil())
+	})
+
+})
@@ -0,0 +1,39 @@
+package imgmeta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// Supported algorithms for the content hash
+const (
+	HashSHA256 = "sha256"
+	HashXXHash = "xxhash"
+)
+
+// ContentHash returns a hex encoded hash over the entropy-coded scan data of the image.
+// Metadata segments (APPn, COM) are not part of the hash, so it stays the same when only
+// the metadata of a file is changed or the file is renamed.
+// Supported algorithms are HashSHA256 (the default, if algorithm is empty) and HashXXHash.
+func (i Image) ContentHash(algorithm string) (string, error) {
+	if len(i.scans) == 0 {
+		return "", &exifError{"Image has no scan data"}
+	}
+
+	var h hash.Hash
+	switch algorithm {
+	case HashSHA256, "":
+		h = sha256.New()
+	case HashXXHash:
+		h = newXXHash64()
+	default:
+		return "", &exifError{fmt.Sprintf("Unknown hash algorithm '%s'", algorithm)}
+	}
+
+	for _, scan := range i.scans {
+		h.Write(scan)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
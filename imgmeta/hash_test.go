@@ -0,0 +1,80 @@
+package imgmeta_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const sampleJpeg = "../testdata/the-wall-sample.jpg"
+
+func readJpegFile(path string) Image {
+	fhnd, err := os.Open(path)
+	Expect(err).Should(BeNil())
+	defer fhnd.Close()
+
+	image, err := ReadJpeg(fhnd)
+	Expect(err).Should(BeNil())
+	return image
+}
+
+// withoutSegment returns a copy of a JPEG file without the first segment with the given marker
+func withoutSegment(data []byte, marker uint16) []byte {
+	for i := 2; i+4 < len(data); {
+		m := binary.BigEndian.Uint16(data[i:])
+		l := int(binary.BigEndian.Uint16(data[i+2:]))
+		if m == marker {
+			return append(append([]byte{}, data[:i]...), data[i+2+l:]...)
+		}
+		i += 2 + l
+	}
+	return data
+}
+
+var _ = Describe("ContentHash", func() {
+
+	It("should hash the scan data with SHA-256", func() {
+		image := readJpegFile(sampleJpeg)
+
+		hash, err := image.ContentHash(HashSHA256)
+		Expect(err).Should(BeNil())
+		Expect(hash).Should(Equal("0ec7275129f9b219a22d1f4c9992f72737aaa600629efad19f23aa623fc3d519"))
+	})
+
+	It("should support a fast mode", func() {
+		image := readJpegFile(sampleJpeg)
+
+		hash, err := image.ContentHash(HashXXHash)
+		Expect(err).Should(BeNil())
+		Expect(hash).Should(Equal("189befcc2a1a57b3"))
+	})
+
+	It("should not change if metadata segments are removed", func() {
+		data, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+
+		tmp, err := ioutil.TempFile("", "imgindex-*.jpg")
+		Expect(err).Should(BeNil())
+		defer os.Remove(tmp.Name())
+
+		_, err = tmp.Write(withoutSegment(data, 0xFFED))
+		Expect(err).Should(BeNil())
+		tmp.Close()
+
+		original, _ := readJpegFile(sampleJpeg).ContentHash(HashSHA256)
+		stripped, err := readJpegFile(tmp.Name()).ContentHash(HashSHA256)
+		Expect(err).Should(BeNil())
+		Expect(stripped).Should(Equal(original))
+	})
+
+	It("should fail for unknown algorithms", func() {
+		image := readJpegFile(sampleJpeg)
+
+		_, err := image.ContentHash("md4")
+		Expect(err).ShouldNot(BeNil())
+	})
+})
@@ -0,0 +1,418 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of a HEIF file (HEIC, AVIF)
+
+HEIF is based on the ISO base media file format (see bmff.go). The images and the metadata are stored as items,
+described by the meta box:
+
+    ftyp   brands, e.g. "heic" (HEVC coded) or "avif" (AV1 coded)
+    meta   full box with the children:
+      hdlr   handler, "pict"
+      pitm   ID of the primary item, 2 bytes (version 0) or 4 bytes
+      iinf   item infos, entry count, followed by infe boxes:
+        infe   version 2/3: item ID (2/4), protection index (2), item type (4), name (string),
+               for items of type "mime" the content type (string)
+      iloc   item locations: sizes of offsets and lengths (4 bit each), for every item its ID, the
+             construction method (0: file offset, 1: offset in the idat box), a base offset and extents
+      iprp   item properties:
+        ipco   property boxes, e.g. ispe (width (4), height (4)) or irot (counter-clockwise rotation * 90)
+        ipma   association of items with properties (1-based index into ipco)
+      idat   item data (optional)
+    mdat   coded image data and metadata items
+
+The metadata items are:
+
+    Exif   offset to the TIFF header (4), followed by the TIFF structure
+    mime   with content type "application/rdf+xml", an XMP packet
+
+The dimensions and rotation are the ones of the primary item. As specified by HEIF, the rotation of irot is
+used as orientation of the image, the EXIF orientation is ignored.
+
+*/
+
+func init() {
+	for _, brand := range []string{"heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1", "avif", "avis"} {
+		RegisterFormat("heif", "????ftyp"+brand, DecoderFunc(decodeHeif))
+	}
+}
+
+// Tags of the HEIF section
+const (
+	HEIFImageWidth       uint16 = 0x0001
+	HEIFImageHeight      uint16 = 0x0002
+	HEIFRotation         uint16 = 0x0003
+	HEIFMajorBrand       uint16 = 0x0004
+	HEIFCompatibleBrands uint16 = 0x0005
+	HEIFPrimaryItemType  uint16 = 0x0006
+	HEIFItemCount        uint16 = 0x0007
+)
+
+var aHEIFTagNames = map[string]uint16{
+	"ImageWidth":       HEIFImageWidth,
+	"ImageHeight":      HEIFImageHeight,
+	"Rotation":         HEIFRotation,
+	"MajorBrand":       HEIFMajorBrand,
+	"CompatibleBrands": HEIFCompatibleBrands,
+	"PrimaryItemType":  HEIFPrimaryItemType,
+	"ItemCount":        HEIFItemCount,
+}
+
+// aHEIFRotationOrientation maps the counter-clockwise rotation of irot to the EXIF orientation
+var aHEIFRotationOrientation = map[uint16]uint16{0: 1, 90: 8, 180: 3, 270: 6}
+
+const cHEIFMaxItemSize = 16 << 20 // metadata items larger than this are skipped
+
+// tHEIFAPP holds the values of the primary item of a HEIF
+type tHEIFAPP struct {
+	tValuesAPP
+}
+
+func (t tHEIFAPP) orientation() (uint16, bool) {
+	rotation, _ := t.values[HEIFRotation].(uint16)
+	orientation, ok := aHEIFRotationOrientation[rotation]
+	return orientation, ok
+}
+
+type tHEIFExtent struct {
+	offset uint64
+	length uint64
+}
+
+type tHEIFItem struct {
+	id           uint32
+	itemType     string
+	contentType  string
+	construction uint16
+	baseOffset   uint64
+	extents      []tHEIFExtent
+	properties   []int // 1-based indices into the ipco box
+}
+
+// tHEIFMeta is the content of the meta box
+type tHEIFMeta struct {
+	primary    uint32
+	items      map[uint32]*tHEIFItem
+	order      []uint32 // item IDs in the order of iinf
+	properties []tBox
+	idat       []byte
+}
+
+func (m *tHEIFMeta) item(id uint32) *tHEIFItem {
+	item, ok := m.items[id]
+	if !ok {
+		item = &tHEIFItem{id: id}
+		m.items[id] = item
+	}
+	return item
+}
+
+// property returns the first property of a type associated with the item
+func (m *tHEIFMeta) property(item *tHEIFItem, boxType string) (tBox, bool) {
+	for _, index := range item.properties {
+		if index > 0 && index <= len(m.properties) && m.properties[index-1].boxType == boxType {
+			return m.properties[index-1], true
+		}
+	}
+	return tBox{}, false
+}
+
+// readHeifMeta reads the payload of a meta box
+func readHeifMeta(data []byte) (*tHEIFMeta, error) {
+	meta := &tHEIFMeta{items: map[uint32]*tHEIFItem{}}
+	if len(data) < 4 {
+		return meta, &exifError{"HEIF meta box is too short"}
+	}
+
+	for _, box := range readBoxes(data[4:]) {
+		reader := &tBoxReader{data: box.data}
+		switch box.boxType {
+		case "pitm":
+			if version, _ := reader.fullBox(); version == 0 {
+				meta.primary = uint32(reader.u16())
+			} else {
+				meta.primary = reader.u32()
+			}
+		case "iinf":
+			version, _ := reader.fullBox()
+			if version == 0 {
+				reader.u16()
+			} else {
+				reader.u32()
+			}
+			for _, infe := range readBoxes(reader.rest()) {
+				if infe.boxType == "infe" {
+					meta.readInfe(infe)
+				}
+			}
+		case "iloc":
+			meta.readIloc(reader)
+		case "iprp":
+			meta.readIprp(box)
+		case "idat":
+			meta.idat = box.data
+		}
+		if reader.failed {
+			log.Warn(fmt.Sprintf("HEIF box '%s' is truncated", box.boxType))
+		}
+	}
+	return meta, nil
+}
+
+func (m *tHEIFMeta) readInfe(box tBox) {
+	reader := &tBoxReader{data: box.data}
+	version, _ := reader.fullBox()
+	if version < 2 {
+		return
+	}
+	id := uint32(0)
+	if version == 2 {
+		id = uint32(reader.u16())
+	} else {
+		id = reader.u32()
+	}
+	reader.u16() // protection index
+	item := m.item(id)
+	item.itemType = reader.fourCC()
+	reader.str() // item name
+	if item.itemType == "mime" {
+		item.contentType = reader.str()
+	}
+	m.order = append(m.order, id)
+}
+
+func (m *tHEIFMeta) readIloc(reader *tBoxReader) {
+	version, _ := reader.fullBox()
+	sizes := reader.u16()
+	offsetSize, lengthSize := int(sizes>>12), int(sizes>>8&0xf)
+	baseOffsetSize, indexSize := int(sizes>>4&0xf), 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xf)
+	}
+
+	count := uint32(0)
+	if version < 2 {
+		count = uint32(reader.u16())
+	} else {
+		count = reader.u32()
+	}
+	for i := uint32(0); i < count && !reader.failed; i++ {
+		id := uint32(0)
+		if version < 2 {
+			id = uint32(reader.u16())
+		} else {
+			id = reader.u32()
+		}
+		item := m.item(id)
+		if version == 1 || version == 2 {
+			item.construction = reader.u16() & 0xf
+		}
+		reader.u16() // data reference index
+		item.baseOffset = reader.uint(baseOffsetSize)
+		extents := reader.u16()
+		item.extents = nil
+		for j := uint16(0); j < extents && !reader.failed; j++ {
+			reader.uint(indexSize)
+			offset := reader.uint(offsetSize)
+			length := reader.uint(lengthSize)
+			item.extents = append(item.extents, tHEIFExtent{offset: offset, length: length})
+		}
+	}
+}
+
+func (m *tHEIFMeta) readIprp(box tBox) {
+	children := readBoxes(box.data)
+	if ipco, ok := findBox(children, "ipco"); ok {
+		m.properties = readBoxes(ipco.data)
+	}
+	ipma, ok := findBox(children, "ipma")
+	if !ok {
+		return
+	}
+
+	reader := &tBoxReader{data: ipma.data}
+	version, flags := reader.fullBox()
+	count := reader.u32()
+	for i := uint32(0); i < count && !reader.failed; i++ {
+		id := uint32(0)
+		if version < 1 {
+			id = uint32(reader.u16())
+		} else {
+			id = reader.u32()
+		}
+		item := m.item(id)
+		associations := reader.u8()
+		for j := uint8(0); j < associations; j++ {
+			if flags&1 == 1 {
+				item.properties = append(item.properties, int(reader.u16()&0x7fff))
+			} else {
+				item.properties = append(item.properties, int(reader.u8()&0x7f))
+			}
+		}
+	}
+}
+
+// readItemData reads the data of an item from its extents
+func (m *tHEIFMeta) readItemData(r io.ReadSeeker, item *tHEIFItem) ([]byte, error) {
+	data := []byte{}
+	for _, extent := range item.extents {
+		if uint64(len(data))+extent.length > cHEIFMaxItemSize {
+			return nil, &exifError{fmt.Sprintf("HEIF item %d is too large", item.id)}
+		}
+		offset := item.baseOffset + extent.offset
+
+		switch item.construction {
+		case 0:
+			if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+				return nil, err
+			}
+			var chunk []byte
+			var err error
+			if extent.length == 0 {
+				chunk, err = readAllLimited(r, cHEIFMaxItemSize)
+			} else {
+				chunk = make([]byte, extent.length)
+				_, err = io.ReadFull(r, chunk)
+			}
+			if err != nil {
+				return nil, &exifError{fmt.Sprintf("HEIF item %d is truncated", item.id)}
+			}
+			data = append(data, chunk...)
+		case 1:
+			end := offset + extent.length
+			if extent.length == 0 {
+				end = uint64(len(m.idat))
+			}
+			if end > uint64(len(m.idat)) || offset > end {
+				return nil, &exifError{fmt.Sprintf("HEIF item %d is out of range", item.id)}
+			}
+			data = append(data, m.idat[offset:end]...)
+		default:
+			return nil, &exifError{fmt.Sprintf("HEIF item %d has unsupported construction method %d", item.id, item.construction)}
+		}
+	}
+	return data, nil
+}
+
+// readAllLimited reads r up to its end, but not more than limit bytes
+func readAllLimited(r io.Reader, limit int64) ([]byte, error) {
+	buf := bytes.Buffer{}
+	_, err := io.Copy(&buf, io.LimitReader(r, limit))
+	return buf.Bytes(), err
+}
+
+// exifItemTIFF returns the TIFF structure of an Exif item
+func exifItemTIFF(data []byte) ([]byte, bool) {
+	if len(data) < 4 {
+		return nil, false
+	}
+	offset := uint64(binary.BigEndian.Uint32(data)) + 4
+	if offset+8 > uint64(len(data)) {
+		return nil, false
+	}
+	tiff := bytes.TrimPrefix(data[offset:], idEXIF)
+	return tiff, len(tiff) >= 8
+}
+
+// heifFormat names the format by its brands
+func heifFormat(major string, compatible []string) string {
+	switch major {
+	case "avif", "avis":
+		return "avif"
+	case "heic", "heix", "heim", "heis", "hevc", "hevx":
+		return "heic"
+	}
+	for _, brand := range compatible {
+		switch brand {
+		case "avif":
+			return "avif"
+		case "heic", "heix":
+			return "heic"
+		}
+	}
+	return "heif"
+}
+
+func decodeHeif(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}}
+
+	boxes, err := readTopLevelBoxes(r, map[string]bool{"ftyp": true, "meta": true}, cHEIFMaxItemSize)
+	if err != nil && len(boxes) == 0 {
+		return image, err
+	}
+	ftyp, ok := findBox(boxes, "ftyp")
+	if !ok {
+		return image, &exifError{"Wrong format"}
+	}
+	major, compatible := readFtyp(ftyp)
+	image.format = heifFormat(major, compatible)
+
+	heif := &tHEIFAPP{tValuesAPP: tValuesAPP{name: "HEIF", names: aHEIFTagNames, values: map[uint16]interface{}{
+		HEIFMajorBrand:       major,
+		HEIFCompatibleBrands: compatible,
+	}}}
+	image.apps[heif.Name()] = heif
+
+	metaBox, ok := findBox(boxes, "meta")
+	if !ok || metaBox.data == nil {
+		return image, &exifError{"HEIF has no meta box"}
+	}
+	meta, err := readHeifMeta(metaBox.data)
+	if err != nil {
+		return image, err
+	}
+	heif.values[HEIFItemCount] = uint32(len(meta.order))
+
+	if primary, ok := meta.items[meta.primary]; ok {
+		heif.values[HEIFPrimaryItemType] = primary.itemType
+		if ispe, ok := meta.property(primary, "ispe"); ok && len(ispe.data) >= 12 {
+			heif.values[HEIFImageWidth] = binary.BigEndian.Uint32(ispe.data[4:])
+			heif.values[HEIFImageHeight] = binary.BigEndian.Uint32(ispe.data[8:])
+		}
+		rotation := uint16(0)
+		if irot, ok := meta.property(primary, "irot"); ok && len(irot.data) >= 1 {
+			rotation = uint16(irot.data[0]&3) * 90
+		}
+		heif.values[HEIFRotation] = rotation
+	}
+
+	for _, id := range meta.order {
+		item := meta.items[id]
+		isExif := item.itemType == "Exif" && !image.HasSection("EXIF")
+		isXMP := item.itemType == "mime" && item.contentType == "application/rdf+xml" && !image.HasSection("XMP")
+		if !isExif && !isXMP {
+			continue
+		}
+
+		data, err := meta.readItemData(r, item)
+		if err != nil {
+			log.Warn(err.Error())
+			continue
+		}
+		if isExif {
+			tiff, ok := exifItemTIFF(data)
+			if !ok {
+				log.Warn("HEIF Exif item is invalid")
+				continue
+			}
+			exif := newExifAPP(tiff)
+			image.apps[exif.Name()] = exif
+		} else {
+			xmp, err := newXMPAPP(data, data)
+			if err != nil {
+				log.Warn(err.Error())
+			}
+			image.apps[xmp.Name()] = xmp
+		}
+	}
+	return image, nil
+}
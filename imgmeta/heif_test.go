@@ -0,0 +1,65 @@
+package imgmeta_test
+
+import (
+	"bytes"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func infe(id uint16, itemType string, extra string) []byte {
+	return box("infe", []byte{2, 0, 0, 0}, u16(id), u16(0), []byte(itemType), []byte("\x00"+extra))
+}
+
+// sampleHeif returns a HEIF with an image item, an Exif item in mdat and an XMP item in idat
+func sampleHeif(major string) []byte {
+	ftyp := box("ftyp", []byte(major), u32(0), []byte("mif1"+major))
+	exif := append(u32(6), append([]byte("Exif\x00\x00"), tiffWithOrientation(1)...)...)
+	mdat := box("mdat", exif)
+	exifOffset := uint32(len(ftyp) + 8)
+
+	iloc := box("iloc", []byte{1, 0, 0, 0}, []byte{0x44, 0x00}, u16(2),
+		u16(2), u16(0), u16(0), u16(1), u32(exifOffset), u32(uint32(len(exif))),
+		u16(3), u16(1), u16(0), u16(1), u32(0), u32(uint32(len(testXMP)))) // construction method 1: idat
+	meta := box("meta", []byte{0, 0, 0, 0},
+		box("hdlr", make([]byte, 8), []byte("pict"), make([]byte, 13)),
+		box("pitm", []byte{0, 0, 0, 0}, u16(1)),
+		box("iinf", []byte{0, 0, 0, 0}, u16(3), infe(1, "hvc1", ""), infe(2, "Exif", ""), infe(3, "mime", "application/rdf+xml\x00")),
+		iloc,
+		box("iprp",
+			box("ipco", box("ispe", []byte{0, 0, 0, 0}, u32(4032), u32(3024)), box("irot", []byte{3})),
+			box("ipma", []byte{0, 0, 0, 0}, u32(1), u16(1), []byte{2, 0x81, 0x02})),
+		box("idat", []byte(testXMP)),
+	)
+
+	return append(append(ftyp, mdat...), meta...)
+}
+
+var _ = Describe("HEIF", func() {
+
+	It("should read the primary item, Exif and XMP of a HEIC", func() {
+		image, err := Decode(bytes.NewReader(sampleHeif("heic")))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("heic"))
+		Expect(image.ReadPropertyValue("HEIF", "PrimaryItemType")).Should(Equal("hvc1"))
+		Expect(image.ReadPropertyValue("HEIF", "Rotation")).Should(Equal(uint16(270)))
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+
+		// irot wins over the EXIF orientation
+		Expect(image.ReadTagValue("EXIF", ExifTagOrientation)).Should(Equal(uint16(1)))
+		Expect(image.Orientation()).Should(Equal(uint16(6)))
+
+		width, height, err := image.DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{3024, 4032}))
+	})
+
+	It("should read AVIF with the same code", func() {
+		image, err := Decode(bytes.NewReader(sampleHeif("avif")))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("avif"))
+		Expect(image.ReadTagValue("HEIF", HEIFImageWidth)).Should(Equal(uint32(4032)))
+	})
+
+})
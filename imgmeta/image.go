@@ -8,7 +8,14 @@ import (
 
 // Image holds both 'Image Data' and 'AP'
 type Image struct {
-	apps map[string]APP
+	apps   map[string]APP
+	scans  [][]byte // entropy-coded data of all scans, in file order
+	format string   // name of the format as registered, e.g. "jpeg"
+}
+
+// Format returns the name of the image format, e.g. "jpeg"
+func (i Image) Format() string {
+	return i.format
 }
 
 // ReadTagValue reads the value of a tag given as an ID
@@ -25,6 +32,33 @@ func (i Image) ReadTagValue(appname string, tagID uint16) (value interface{}, er
 	return
 }
 
+// HasSection reports whether the image has a meta section, e.g. "EXIF"
+func (i Image) HasSection(appname string) bool {
+	_, exists := i.apps[appname]
+	return exists
+}
+
+// PropertyReader is implemented by sections whose values are read by name instead of a tag ID,
+// e.g. XMP ('dc:title') or PNG text chunks ('Title')
+type PropertyReader interface {
+	ReadProperty(name string) (interface{}, error)
+}
+
+// ReadPropertyValue reads the value of a property given by its name
+// Examples:
+//             title := image.ReadPropertyValue("XMP", "dc:title")
+func (i Image) ReadPropertyValue(appname string, name string) (value interface{}, err error) {
+	app, exists := i.apps[appname]
+	if !exists {
+		return nil, &exifError{fmt.Sprintf("Image does not have '%s' meta section", appname)}
+	}
+	reader, ok := app.(PropertyReader)
+	if !ok {
+		return nil, &exifError{fmt.Sprintf("Meta section '%s' has no named properties", appname)}
+	}
+	return reader.ReadProperty(name)
+}
+
 // Image Sections
 const (
 	cSOI = 0xFFD8
@@ -36,6 +70,17 @@ const (
 	cMETA = 0xFFE3 // APP3, "META\x00\x00" or "Meta\x00\x00"
 	cIPTC = 0xFFED // APP13, "Photoshop 3.0\x00"
 
+	cAPP4  = 0xFFE4
+	cAPP5  = 0xFFE5
+	cAPP6  = 0xFFE6
+	cAPP7  = 0xFFE7
+	cAPP8  = 0xFFE8
+	cAPP9  = 0xFFE9
+	cAPP10 = 0xFFEA
+	cAPP11 = 0xFFEB
+	cAPP14 = 0xFFEE // APP14, "Adobe"
+	cAPP15 = 0xFFEF
+
 	cPINF = 0xFFEC // Picture Info
 
 	cSOF0  = 0xFFC0 // Start of Frame (baseline JPEG)
@@ -1,9 +1,12 @@
 package imgmeta
 
 import (
+	"bytes"
+	"crypto/md5"
 	"encoding/binary"
 	"fmt"
-	"time"
+	"strings"
+	"unicode/utf8"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -77,6 +80,19 @@ type tIPTCAPP struct {
 	block  []byte           // full APP block
 }
 
+// newIPTCAPP wraps Photoshop image resources of other formats, e.g. of PSD, as an APP13 segment
+func newIPTCAPP(resources []byte) *tIPTCAPP {
+	block := make([]byte, 4, 4+len(idIPTC)+len(resources))
+	binary.BigEndian.PutUint16(block, cIPTC)
+	length := len(idIPTC) + len(resources) + 2
+	if length > 0xFFFF {
+		length = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(block[2:], uint16(length))
+	block = append(append(block, idIPTC...), resources...)
+	return &tIPTCAPP{offset: 0, endian: binary.BigEndian, block: block}
+}
+
 func (t tIPTCAPP) Name() string {
 	return "IPTC"
 }
@@ -91,6 +107,9 @@ func (t tIPTCAPP) ID(cid []byte) (id []byte) {
 	return
 }
 func (t tIPTCAPP) HasID(cid []byte) bool {
+	if len(t.block) < 4+len(cid) {
+		return false
+	}
 	id := t.block[4 : 4+len(cid)]
 	for i, b := range id {
 		if b != cid[i] {
@@ -100,19 +119,38 @@ func (t tIPTCAPP) HasID(cid []byte) bool {
 	return true
 }
 
+// Photoshop image resource IDs
+const (
+	c8BIMResolution = 0x03ED
+	c8BIMIPTC       = 0x0404
+	c8BIMThumbnail  = 0x040C
+	c8BIMICCProfile = 0x040F
+	c8BIMExif       = 0x0422
+	c8BIMXMP        = 0x0424
+	c8BIMDigest     = 0x0425 // MD5 of the IPTC block
+)
+
+// tIPTCHeader reads the resource data blocks of Photoshop image resources, e.g. of APP13
 type tIPTCHeader struct {
 	block  []byte
 	endian binary.ByteOrder // Byte-Order
 }
 
 func (t tIPTCHeader) HasValidHeader() bool {
-	return len(t.block) > 8 && t.block[0] == '8' && t.block[1] == 'B' && (t.block[2] == 'I' || t.block[2] == 'P') && (t.block[3] == 'M' || t.block[3] == 'S') && t.block[4] == 4
+	if len(t.block) < 12 || t.block[0] != '8' || t.block[1] != 'B' || (t.block[2] != 'I' && t.block[2] != 'P') || (t.block[3] != 'M' && t.block[3] != 'S') {
+		return false
+	}
+	offset := 4 + 2 + 1 + (t.NameLen() | 1)
+	return uint64(offset)+4 <= uint64(len(t.block)) && uint64(offset)+4+uint64(t.RecordSize()) <= uint64(len(t.block))
+}
+func (t tIPTCHeader) ID() uint16 {
+	return t.endian.Uint16(t.block[4:])
 }
 func (t tIPTCHeader) HasIPTCRecords() bool {
-	return t.block[5] == 0x04
+	return t.ID() == c8BIMIPTC
 }
 func (t tIPTCHeader) HasChecksum() bool {
-	return t.block[5] == 0x25
+	return t.ID() == c8BIMDigest
 }
 func (t tIPTCHeader) NameLen() uint32 {
 	l := uint32(t.block[6])
@@ -125,16 +163,33 @@ func (t tIPTCHeader) RecordSize() uint32 {
 	offset := 4 + 2 + 1 + (t.NameLen() | 1)
 	return t.endian.Uint32(t.block[offset:])
 }
-func (t tIPTCHeader) RecordReader() (r tIPTCRecordReader) {
+func (t tIPTCHeader) Data() []byte {
 	offset := 4 + 2 + 1 + (t.NameLen() | 1) + 4
-	return tIPTCRecordReader{block: t.block[offset : offset+t.RecordSize()], endian: t.endian, cursor: 0}
+	return t.block[offset : offset+t.RecordSize()]
+}
+func (t tIPTCHeader) RecordReader() (r tIPTCRecordReader) {
+	return tIPTCRecordReader{block: t.Data(), endian: t.endian, cursor: 0}
 }
 func (t tIPTCHeader) Next() tIPTCHeader {
-	move := uint32(4) + 2 + 1 + (t.NameLen() | 1) + 4 + t.RecordSize()
-	move = (move + 1) & 0xfffe
+	move := uint64(4) + 2 + 1 + uint64(t.NameLen()|1) + 4 + uint64(t.RecordSize())
+	move = (move + 1) &^ 1
+	if move > uint64(len(t.block)) {
+		move = uint64(len(t.block))
+	}
 	return tIPTCHeader{block: t.block[move:], endian: t.endian}
 }
 
+// readResources returns the data of the Photoshop image resources in block by their ID, the first one wins
+func readResources(block []byte) map[uint16][]byte {
+	resources := map[uint16][]byte{}
+	for header := (tIPTCHeader{block: block, endian: binary.BigEndian}); header.HasValidHeader(); header = header.Next() {
+		if _, ok := resources[header.ID()]; !ok {
+			resources[header.ID()] = header.Data()
+		}
+	}
+	return resources
+}
+
 type tIPTCRecordReader struct {
 	block  []byte
 	endian binary.ByteOrder // Byte-Order
@@ -142,7 +197,7 @@ type tIPTCRecordReader struct {
 }
 
 func (t tIPTCRecordReader) IsRecord() bool {
-	return t.cursor < uint32(len(t.block)) && t.Tag() == 0x1C
+	return t.cursor+5 <= uint32(len(t.block)) && t.Tag() == 0x1C && t.cursor+t.RecordSize() <= uint32(len(t.block))
 }
 func (t tIPTCRecordReader) Tag() byte {
 	return t.block[t.cursor]
@@ -172,66 +227,134 @@ func (t tIPTCRecordReader) ReadString() string {
 	data := t.RecordData()
 	return string(data)
 }
-func (t tIPTCRecordReader) ReadDate() time.Time {
-	//data := t.RecordData()
-	// CCYYMMDD
-	return time.Now()
+func (t *tIPTCRecordReader) Next() {
+	t.cursor += uint32(t.RecordSize())
 }
-func (t tIPTCRecordReader) ReadTime() time.Time {
-	//data := t.RecordData()
-	return time.Now()
+
+// cIPTCUTF8 is the coded character set (1:90) that announces UTF-8 strings
+const cIPTCUTF8 = "\x1b%G"
+
+// aIPTCAliases are the common names of datasets, as used in the configuration
+var aIPTCAliases = map[string]uint16{
+	"title":       IptcTagApplication2ObjectName,
+	"description": IptcTagApplication2Caption,
+	"creator":     IptcTagApplication2Byline,
+	"state":       IptcTagApplication2ProvinceState,
+	"country":     IptcTagApplication2CountryName,
 }
 
-func (t *tIPTCRecordReader) Next() {
-	t.cursor += uint32(t.RecordSize())
+// resource returns the data of a Photoshop image resource of the segment, e.g. c8BIMIPTC
+func (t tIPTCAPP) resource(id uint16) ([]byte, bool) {
+	if len(t.block) < 4+len(idIPTC) {
+		return nil, false
+	}
+	data, ok := readResources(t.block[4+len(idIPTC):])[id]
+	return data, ok
 }
 
-func (t tIPTCAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
+// records reads the datasets of the IPTC resource by their ID. Strings are UTF-8 if the coded character set
+// (1:90) says so or if they are valid UTF-8, otherwise they are read as Latin-1. The values of repeatable
+// datasets, like the keywords, are returned as []string.
+func (t tIPTCAPP) records() map[uint16]interface{} {
+	values := map[uint16]interface{}{}
+	data, ok := t.resource(c8BIMIPTC)
+	if !ok {
+		return values
+	}
+
+	isUTF8 := false
+	for recordReader := (tIPTCRecordReader{block: data, endian: t.endian}); recordReader.IsRecord(); recordReader.Next() {
+		fieldID := uint16(recordReader.RecordNumber())<<8 | uint16(recordReader.DatasetNumber())
+		field, ok := aIPTCFields[fieldID]
+		if !ok {
+			log.Debug(fmt.Sprintf("IPTC record with id:0x%04X is not listed in our embedded map", fieldID))
+			continue
+		}
 
-	// Skip the IPTC APP13 header (18 bytes)
-	iptcHeader := tIPTCHeader{block: t.block[18:], endian: t.endian}
-
-	// Valid header == 0x38 0x42 0x49 0x4d 0x04
-	for iptcHeader.HasValidHeader() {
-
-		// @NOTE: There seem to be a lot of different IPTC record types, the only one
-		// that contains records is the 0x04 one (0x38 0x42 0x49 0x4d 0x04 0x04).
-		if iptcHeader.HasIPTCRecords() {
-			recordReader := iptcHeader.RecordReader()
-			for recordReader.IsRecord() {
-				fieldID := uint16(recordReader.RecordNumber())<<8 | uint16(recordReader.DatasetNumber())
-				field, ok := aIPTCFields[fieldID]
-				if ok {
-					if field.fieldTypeID == IptcFieldTypeShort {
-						log.Debug(fmt.Sprintf("IPTC tag:%v, type:'short', value:%v\n", fieldID, recordReader.ReadShort()))
-					} else if field.fieldTypeID == IptcFieldTypeString {
-						log.Debug(fmt.Sprintf("IPTC tag:%v, type:'string', value:%v\n", fieldID, recordReader.ReadString()))
-					} else if field.fieldTypeID == IptcFieldTypeDate {
-						log.Debug(fmt.Sprintf("IPTC tag:%v, type:'date', value:%v\n", fieldID, recordReader.ReadDate()))
-					} else if field.fieldTypeID == IptcFieldTypeTime {
-						log.Debug(fmt.Sprintf("IPTC tag:%v, type:'time', value:%v\n", fieldID, recordReader.ReadTime()))
-					}
-					//if fieldID == tagID2Find {
-					//	if field.fieldTypeID == IptcFieldTypeShort {
-					//		return recordReader.ReadShort(), nil
-					//	} else if field.fieldTypeID == IptcFieldTypeString {
-					//		return recordReader.ReadString(), nil
-					//	} else if field.fieldTypeID == IptcFieldTypeDate {
-					//		return recordReader.ReadDate(), nil
-					//	} else if field.fieldTypeID == IptcFieldTypeTime {
-					//		return recordReader.ReadTime(), nil
-					//	}
-					//}
-				} else {
-					return nil, &exifError{fmt.Sprintf("IPTC record with id:0x%02X is not listed in our embedded map", fieldID)}
-				}
-				recordReader.Next()
+		var value interface{}
+		switch field.fieldTypeID {
+		case IptcFieldTypeShort:
+			if recordReader.DataSize() < 2 {
+				continue
 			}
+			value = recordReader.ReadShort()
+		case IptcFieldTypeString, IptcFieldTypeDate, IptcFieldTypeTime:
+			text := bytes.TrimRight(recordReader.RecordData(), "\x00")
+			if fieldID == IptcTagEnvelopeCharacterSet {
+				isUTF8 = string(text) == cIPTCUTF8
+			}
+			if isUTF8 || utf8.Valid(text) {
+				value = string(text)
+			} else {
+				value = latin1ToUTF8(text)
+			}
+		default:
+			value = append([]byte{}, recordReader.RecordData()...)
 		}
-		iptcHeader = iptcHeader.Next()
+		log.Debug(fmt.Sprintf("IPTC tag:0x%04X, value:%v", fieldID, value))
+
+		if text, ok := value.(string); ok && field.isRepeatable {
+			list, _ := values[fieldID].([]string)
+			values[fieldID] = append(list, text)
+		} else if _, exists := values[fieldID]; !exists {
+			values[fieldID] = value
+		}
+	}
+	return values
+}
+
+// digest reports whether the segment has an IPTC digest (8BIM 0x0425) and whether it matches the MD5
+// of the IPTC resource. A mismatch means that the IPTC was changed by an application that ignored the XMP.
+func (t tIPTCAPP) digest() (hasDigest bool, matches bool) {
+	digest, ok := t.resource(c8BIMDigest)
+	if !ok || len(digest) != md5.Size {
+		return false, false
 	}
+	data, _ := t.resource(c8BIMIPTC)
+	sum := md5.Sum(data)
+	return true, bytes.Equal(sum[:], digest)
+}
 
-	return int(0), &exifError{"Reading IPTC tag value failed"}
+func (t tIPTCAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
+	value, ok := t.records()[tagID2Find]
+	if !ok {
+		return nil, &exifError{fmt.Sprintf("IPTC tag 0x%X not found", tagID2Find)}
+	}
+	return value, nil
+}
+
+// ReadProperty returns a dataset by its name without the record prefix, e.g. 'Keywords' or 'CountryName',
+// or by one of the common names 'title', 'description', 'creator', 'state' and 'country'
+func (t tIPTCAPP) ReadProperty(name string) (interface{}, error) {
+	tag, ok := IPTCTag(name)
+	if !ok {
+		return nil, &exifError{fmt.Sprintf("IPTC property '%s' not found", name)}
+	}
+	return t.ReadValue(tag)
+}
+
+// IPTCTag returns the tag of a dataset by its name, an alias like 'description' (see aIPTCAliases) or its name
+// without the record like 'Caption'
+func IPTCTag(name string) (uint16, bool) {
+	if tag, ok := aIPTCAliases[strings.ToLower(name)]; ok {
+		return tag, true
+	}
+	for id := range aIPTCFields {
+		if strings.EqualFold(IPTCTagName(id), name) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// IPTCTagName returns the name of a dataset without its record, e.g. 'Byline' for IptcTagApplication2Byline, or
+// its tag in hex if it is unknown
+func IPTCTagName(tag uint16) string {
+	field, ok := aIPTCFields[tag]
+	if !ok {
+		return fmt.Sprintf("0x%04X", tag)
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(field.tagTypeID, "IptcTagApplication2"), "IptcTagEnvelope")
 }
 
 const (
@@ -0,0 +1,278 @@
+package imgmeta
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+/*
+Writing IPTC
+
+EncodeIPTC builds the datasets of the application record (2:xx) from a map of values by tag. The rules of aIPTCFields
+are enforced: only repeatable datasets may have several values, and no value may be longer than maxSizeInBytes.
+The datasets are written as follows, every string in UTF-8:
+
+    [Record name]        [size]   [description]
+    ---------------------------------------
+    1:90 CharacterSet    3 bytes  ESC % G, which announces UTF-8
+    2:00 RecordVersion   2 bytes  4, unless given
+    2:xx                   ...    the values in the order of their tags, repeatable ones in the given order
+
+The stream is stored in the Photoshop image resource 0x0404 of the APP13 segment. The other resources are kept
+as they are, only the IPTC digest (0x0425, MD5 of the 0x0404 data) is updated, so that readers following the
+Metadata Working Group (see mwg.go) know that the IPTC and the XMP are in sync.
+
+DeleteIPTC does not encode the stream again, it only cuts the datasets of the given tags out of it. Datasets of the
+envelope record, unknown datasets and strings in another character set than UTF-8 are kept as they are.
+
+*/
+
+// cIPTCRecordVersion is the version of the application record that is written
+const cIPTCRecordVersion = 4
+
+// cIPTCMaxResources is the maximum size of the image resources in one APP13 segment
+const cIPTCMaxResources = 0xFFFF - 2 - 14
+
+// EncodeIPTC builds the IPTC datasets of the application record from values by tag, e.g.
+// IptcTagApplication2Keywords. Values are strings, []string for repeatable datasets, int16 or uint16 for
+// binary datasets and []byte for undefined ones.
+func EncodeIPTC(values map[uint16]interface{}) ([]byte, error) {
+	tags := []int{}
+	for tag := range values {
+		if tag&0xFF00 != IptcTagGroupApplication {
+			return nil, &exifError{fmt.Sprintf("IPTC tag 0x%04X is not in the application record", tag)}
+		}
+		if _, ok := aIPTCFields[tag]; !ok {
+			return nil, &exifError{fmt.Sprintf("IPTC tag 0x%04X is not listed in our embedded map", tag)}
+		}
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+
+	out := iptcDataset(IptcTagEnvelopeCharacterSet, []byte(cIPTCUTF8))
+	if _, ok := values[IptcTagApplication2RecordVersion]; !ok {
+		version := make([]byte, 2)
+		binary.BigEndian.PutUint16(version, cIPTCRecordVersion)
+		out = append(out, iptcDataset(IptcTagApplication2RecordVersion, version)...)
+	}
+
+	for _, tag := range tags {
+		field := aIPTCFields[uint16(tag)]
+		datasets, err := iptcFieldData(field, values[uint16(tag)])
+		if err != nil {
+			return nil, err
+		}
+		if len(datasets) > 1 && !field.isRepeatable {
+			return nil, &exifError{fmt.Sprintf("%s is not repeatable", field.tagTypeID)}
+		}
+		for _, data := range datasets {
+			if len(data) > field.maxSizeInBytes || len(data) > 0x7FFF {
+				return nil, &exifError{fmt.Sprintf("%s is longer than %d bytes", field.tagTypeID, field.maxSizeInBytes)}
+			}
+			out = append(out, iptcDataset(uint16(tag), data)...)
+		}
+	}
+	return out, nil
+}
+
+// iptcFieldData returns the data of the datasets of a value
+func iptcFieldData(field tIPTCField, value interface{}) ([][]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return iptcFieldData(field, []string{v})
+	case []string:
+		if field.fieldTypeID == IptcFieldTypeShort || field.fieldTypeID == IptcFieldTypeUndefined {
+			break
+		}
+		datasets := [][]byte{}
+		for _, text := range v {
+			if !utf8.ValidString(text) {
+				return nil, &exifError{fmt.Sprintf("%s is no valid UTF-8", field.tagTypeID)}
+			}
+			datasets = append(datasets, []byte(text))
+		}
+		return datasets, nil
+	case int16:
+		return iptcFieldData(field, uint16(v))
+	case uint16:
+		if field.fieldTypeID != IptcFieldTypeShort {
+			break
+		}
+		data := make([]byte, 2)
+		binary.BigEndian.PutUint16(data, v)
+		return [][]byte{data}, nil
+	case []byte:
+		if field.fieldTypeID != IptcFieldTypeUndefined {
+			break
+		}
+		return [][]byte{v}, nil
+	}
+	return nil, &exifError{fmt.Sprintf("%s can not be written as %T", field.tagTypeID, value)}
+}
+
+// iptcDataset returns a dataset with a standard tag header
+func iptcDataset(tag uint16, data []byte) []byte {
+	dataset := []byte{0x1C, byte(tag >> 8), byte(tag), byte(len(data) >> 8), byte(len(data))}
+	return append(dataset, data...)
+}
+
+// replaceResources returns the Photoshop image resources of block, in which the data of the resources in
+// replace is exchanged. Order, names and all other resources are kept, resources that are not in block yet
+// are appended.
+func replaceResources(block []byte, replace map[uint16][]byte) []byte {
+	out := []byte{}
+	done := map[uint16]bool{}
+	for header := (tIPTCHeader{block: block, endian: binary.BigEndian}); header.HasValidHeader(); header = header.Next() {
+		size := len(header.block) - len(header.Next().block)
+		data, ok := replace[header.ID()]
+		if !ok {
+			out = append(out, header.block[:size]...)
+			continue
+		}
+		// duplicates of a replaced resource are dropped
+		if !done[header.ID()] {
+			done[header.ID()] = true
+			out = append(out, photoshopResource(header.block[:4+2+1+(header.NameLen()|1)], data)...)
+		}
+	}
+
+	ids := []int{}
+	for id := range replace {
+		if !done[id] {
+			ids = append(ids, int(id))
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		header := append([]byte("8BIM"), byte(id>>8), byte(id), 0, 0)
+		out = append(out, photoshopResource(header, replace[uint16(id)])...)
+	}
+	return out
+}
+
+// photoshopResource returns a resource block from its header (signature, ID and name) and its data
+func photoshopResource(header []byte, data []byte) []byte {
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(data)))
+	block := append(append(append([]byte{}, header...), size...), data...)
+	if len(data)%2 == 1 {
+		block = append(block, 0)
+	}
+	return block
+}
+
+// photoshopResources returns the image resources of all APP13 segments of the JPEG, in file order
+func (w *JpegWriter) photoshopResources() []byte {
+	resources := []byte{}
+	for _, segment := range w.Segments {
+		if segment.Marker == cIPTC && segment.HasID(idIPTC) {
+			resources = append(resources, segment.Payload[len(idIPTC):]...)
+		}
+	}
+	return resources
+}
+
+// IPTC returns the datasets of the application record of the JPEG by tag, as read by the IPTC section. Datasets
+// of other records and those that are not in aIPTCFields are left out, see IPTCTags.
+func (w *JpegWriter) IPTC() map[uint16]interface{} {
+	app := newIPTCAPP(w.photoshopResources())
+	values := map[uint16]interface{}{}
+	for tag, value := range app.records() {
+		if tag&0xFF00 == IptcTagGroupApplication {
+			values[tag] = value
+		}
+	}
+	return values
+}
+
+// SetIPTC replaces the IPTC of the JPEG by the datasets of values (see EncodeIPTC), and updates the IPTC digest.
+// All other Photoshop image resources are kept, the APP13 segment is added if the JPEG has none.
+func (w *JpegWriter) SetIPTC(values map[uint16]interface{}) error {
+	iptc, err := EncodeIPTC(values)
+	if err != nil {
+		return err
+	}
+	return w.setIPTCResource(iptc)
+}
+
+// iptcResource returns the IPTC datasets of the JPEG as they are stored
+func (w *JpegWriter) iptcResource() ([]byte, bool) {
+	return newIPTCAPP(w.photoshopResources()).resource(c8BIMIPTC)
+}
+
+// IPTCTags returns the tags of all datasets of the IPTC of the JPEG in the order they are stored, including the
+// envelope record and datasets that are not in aIPTCFields
+func (w *JpegWriter) IPTCTags() []uint16 {
+	data, _ := w.iptcResource()
+	tags := []uint16{}
+	seen := map[uint16]bool{}
+	for reader := (tIPTCRecordReader{block: data, endian: binary.BigEndian}); reader.IsRecord(); reader.Next() {
+		tag := uint16(reader.RecordNumber())<<8 | uint16(reader.DatasetNumber())
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// DeleteIPTC removes the datasets of the tags from the IPTC of the JPEG and updates the IPTC digest. Unlike
+// SetIPTC, it keeps all other datasets as they are stored, including their character set.
+func (w *JpegWriter) DeleteIPTC(tags ...uint16) error {
+	data, ok := w.iptcResource()
+	if !ok {
+		return nil
+	}
+	remove := map[uint16]bool{}
+	for _, tag := range tags {
+		remove[tag] = true
+	}
+
+	iptc := []byte{}
+	reader := tIPTCRecordReader{block: data, endian: binary.BigEndian}
+	for ; reader.IsRecord(); reader.Next() {
+		tag := uint16(reader.RecordNumber())<<8 | uint16(reader.DatasetNumber())
+		if !remove[tag] {
+			iptc = append(iptc, data[reader.cursor:reader.cursor+reader.RecordSize()]...)
+		}
+	}
+	if int(reader.cursor) == len(iptc) {
+		return nil
+	}
+	// data behind the datasets, which can not be read, is kept as well
+	return w.setIPTCResource(append(iptc, data[reader.cursor:]...))
+}
+
+// setIPTCResource replaces the IPTC resource of the JPEG by the datasets in iptc and updates the IPTC digest
+func (w *JpegWriter) setIPTCResource(iptc []byte) error {
+	digest := md5.Sum(iptc)
+	resources := replaceResources(w.photoshopResources(), map[uint16][]byte{c8BIMIPTC: iptc, c8BIMDigest: digest[:]})
+
+	// large resources are split into several APP13 segments, as Photoshop does
+	segments := []Segment{}
+	for len(resources) > 0 {
+		n := len(resources)
+		if n > cIPTCMaxResources {
+			n = cIPTCMaxResources
+		}
+		segments = append(segments, Segment{Marker: cIPTC, Payload: append(append([]byte{}, idIPTC...), resources[:n]...)})
+		resources = resources[n:]
+	}
+
+	index := w.Find(cIPTC, idIPTC)
+	if _, err := w.Delete(cIPTC, idIPTC); err != nil {
+		return err
+	}
+	if index < 0 {
+		if err := w.Insert(segments[0]); err != nil {
+			return err
+		}
+		index = w.Find(cIPTC, idIPTC) + 1
+		segments = segments[1:]
+	}
+	w.Segments = append(w.Segments[:index], append(segments, w.Segments[index:]...)...)
+	return nil
+}
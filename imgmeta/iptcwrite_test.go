@@ -0,0 +1,133 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// resourceIDs returns the IDs of the Photoshop image resources of an APP13 payload
+func resourceIDs(payload []byte) []uint16 {
+	ids := []uint16{}
+	data := payload[len("Photoshop 3.0\x00"):]
+	for len(data) >= 12 && string(data[:4]) == "8BIM" {
+		ids = append(ids, binary.BigEndian.Uint16(data[4:]))
+		offset := 6 + (int(data[6]) | 1) + 1
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		data = data[offset+4+(size+1)&^1:]
+	}
+	return ids
+}
+
+var _ = Describe("IPTC writing", func() {
+
+	It("should enforce the rules of the datasets", func() {
+		_, err := EncodeIPTC(map[uint16]interface{}{IptcTagApplication2ObjectName: []string{"one", "two"}})
+		Expect(err).ShouldNot(BeNil())
+		_, err = EncodeIPTC(map[uint16]interface{}{IptcTagApplication2ObjectName: strings.Repeat("x", 65)})
+		Expect(err).ShouldNot(BeNil())
+		_, err = EncodeIPTC(map[uint16]interface{}{IptcTagEnvelopeDestination: "somewhere"})
+		Expect(err).ShouldNot(BeNil())
+		_, err = EncodeIPTC(map[uint16]interface{}{IptcTagApplication2Urgency: 1})
+		Expect(err).ShouldNot(BeNil())
+
+		data, err := EncodeIPTC(map[uint16]interface{}{
+			IptcTagApplication2Keywords:   []string{"mauer", "berlin"},
+			IptcTagApplication2ObjectName: "Die Mauer",
+		})
+		Expect(err).Should(BeNil())
+		expected := append(dataset(1, 90, "\x1b%G"), 0x1c, 2, 0, 0, 2, 0, 4)
+		expected = append(expected, dataset(2, 5, "Die Mauer")...)
+		expected = append(expected, dataset(2, 25, "mauer")...)
+		expected = append(expected, dataset(2, 25, "berlin")...)
+		Expect(data).Should(Equal(expected))
+	})
+
+	It("should replace the IPTC of a JPEG and keep the other resources", func() {
+		original, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		before := resourceIDs(writer.Segments[writer.Find(MarkerAPP0+13, nil)].Payload)
+
+		values := writer.IPTC()
+		Expect(values[IptcTagApplication2Keywords]).Should(Equal([]string{"test", "wall"}))
+		values[IptcTagApplication2Keywords] = []string{"test", "wall", "Straße"}
+		values[IptcTagApplication2Caption] = "Die Mauer in Berlin"
+		Expect(writer.SetIPTC(values)).Should(Succeed())
+		Expect(resourceIDs(writer.Segments[writer.Find(MarkerAPP0+13, nil)].Payload)).Should(Equal(before))
+
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+		image, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("IPTC", "keywords")).Should(Equal([]string{"test", "wall", "Straße"}))
+		Expect(image.ReadPropertyValue("IPTC", "CharacterSet")).Should(Equal("\x1b%G"))
+		Expect(image.ReadPropertyValue("IPTC", "title")).Should(Equal("Titel - The Wall"))
+
+		// with a matching digest, the XMP wins over the IPTC
+		Expect(image.Metadata().Title.Source).Should(Equal(MetadataSourceXMP))
+	})
+
+	It("should cut datasets out and keep the others as they are stored", func() {
+		original, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		// an envelope dataset, a Latin-1 string and an unknown dataset
+		kept := dataset(1, 20, "\x00\x01")
+		kept = append(kept, dataset(2, 90, "K\xf6ln")...)
+		kept = append(kept, dataset(2, 221, "unknown dataset")...)
+		iptc := append(append([]byte{}, kept...), dataset(2, 25, "mauer")...)
+		iptc = append(iptc, dataset(2, 25, "berlin")...)
+		Expect(writer.Replace([]byte("Photoshop 3.0\x00"), Segment{
+			Marker:  MarkerAPP0 + 13,
+			Payload: append([]byte("Photoshop 3.0\x00"), resource(0x0404, iptc)...),
+		})).Should(Succeed())
+		Expect(writer.IPTCTags()).Should(Equal([]uint16{IptcTagEnvelopeFileFormat, IptcTagApplication2City, 0x02DD, IptcTagApplication2Keywords}))
+
+		Expect(writer.DeleteIPTC(IptcTagApplication2Keywords)).Should(Succeed())
+		payload := writer.Segments[writer.Find(MarkerAPP0+13, nil)].Payload
+		Expect(resourceIDs(payload)).Should(Equal([]uint16{0x0404, 0x0425}))
+		Expect(bytes.Contains(payload, resource(0x0404, kept))).Should(BeTrue())
+
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+		image, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("IPTC", "City")).Should(Equal("Köln"))
+		_, err = image.ReadPropertyValue("IPTC", "Keywords")
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should add an APP13 segment behind the other APPn segments", func() {
+		original, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		Expect(writer.Delete(MarkerAPP0+13, nil)).Should(Equal(1))
+
+		Expect(writer.SetIPTC(map[uint16]interface{}{IptcTagApplication2City: "Berlin"})).Should(Succeed())
+		index := writer.Find(MarkerAPP0+13, nil)
+		Expect(index).ShouldNot(Equal(-1))
+		Expect(resourceIDs(writer.Segments[index].Payload)).Should(Equal([]uint16{0x0404, 0x0425}))
+		for _, segment := range writer.Segments[:index] {
+			Expect(segment.Marker).Should(BeNumerically("<", MarkerAPP0+13))
+		}
+
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+		image, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(image.Metadata().City).Should(Equal(&MetadataValue{Value: "Berlin", Source: MetadataSourceIPTC}))
+	})
+
+})
@@ -3,6 +3,8 @@ package imgmeta
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 
 	log "github.com/sirupsen/logrus"
@@ -17,10 +19,18 @@ func (e *exifError) Error() string {
 	return fmt.Sprintf("%s", e.descr)
 }
 
+func init() {
+	RegisterFormat("jpeg", "\xff\xd8", DecoderFunc(decodeJpeg))
+}
+
 // ReadJpeg will read all sections from the image data
 func ReadJpeg(fhnd *os.File) (image Image, err error) {
-	image = Image{apps: map[string]APP{}}
-	reader, n, err := newJpegReader(fhnd)
+	return decodeJpeg(fhnd)
+}
+
+func decodeJpeg(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "jpeg"}
+	reader, n, err := newJpegReader(r)
 	if n == 0 || err != nil {
 		return
 	}
@@ -32,6 +42,7 @@ func ReadJpeg(fhnd *os.File) (image Image, err error) {
 	}
 
 	appHeader := make([]byte, 2)
+	extendedXMP := [][]byte{}
 	for true {
 		n, err = reader.Read(appHeader)
 		if n != len(appHeader) || err != nil {
@@ -39,10 +50,16 @@ func ReadJpeg(fhnd *os.File) (image Image, err error) {
 		}
 		if appHeader[0] == 0xFF {
 			for appHeader[1] == 0xFF {
-				appHeader[1] = reader.ReadByte()
+				appHeader[1], err = reader.ReadByte()
+				if err != nil {
+					return image, err
+				}
 			}
 
 			marker = binary.BigEndian.Uint16(appHeader)
+			if marker == cEOI {
+				break
+			}
 			segment, ok := aSegments[marker]
 			if !ok {
 				return image, &exifError{"Unidentified APP marker encountered"}
@@ -56,6 +73,20 @@ func ReadJpeg(fhnd *os.File) (image Image, err error) {
 			if app == nil {
 				break
 			}
+			if sos, ok := app.(*tSOSAPP); ok {
+				// A progressive JPEG has several scans, keep all of them
+				image.scans = append(image.scans, sos.scan)
+				continue
+			}
+			if dqt, ok := app.(*tDQTAPP); ok {
+				if prev, ok := image.apps[dqt.Name()].(*tDQTAPP); ok {
+					prev.merge(dqt)
+					continue
+				}
+			}
+			if ext, ok := app.(*tAPP); ok && ext.HasID(idXMPExt) {
+				extendedXMP = append(extendedXMP, ext.block[4+len(idXMPExt):])
+			}
 			log.Debug(fmt.Sprintf("Registering APP %s, Length:%v\n", app.Name(), app.Length()))
 			image.apps[app.Name()] = app
 
@@ -65,6 +96,9 @@ func ReadJpeg(fhnd *os.File) (image Image, err error) {
 			return image, &exifError{fmt.Sprintf("Encountered invalid section marker 0x%X", marker)}
 		}
 	}
+	if xmp, ok := image.apps["XMP"].(*tXMPAPP); ok {
+		xmp.addExtended(extendedXMP)
+	}
 	return image, nil
 }
 
@@ -74,30 +108,30 @@ type JpegReader struct {
 }
 
 func (b *JpegReader) Read(p []byte) (n int, err error) {
-	for i := 0; i < len(p); i++ {
-		p[i] = b.data[b.cursor]
-		b.cursor++
+	if b.cursor >= uint64(len(b.data)) {
+		return 0, io.EOF
 	}
-	return len(p), nil
+	n = copy(p, b.data[b.cursor:])
+	b.cursor += uint64(n)
+	if n < len(p) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
 }
 
-func (b *JpegReader) ReadByte() byte {
+func (b *JpegReader) ReadByte() (byte, error) {
+	if b.cursor >= uint64(len(b.data)) {
+		return 0, io.EOF
+	}
 	v := b.data[b.cursor]
 	b.cursor++
-	return v
+	return v, nil
 }
 
-func newJpegReader(fhnd *os.File) (reader *JpegReader, n int, err error) {
-	stat, err := fhnd.Stat()
+func newJpegReader(r io.Reader) (reader *JpegReader, n int, err error) {
 	reader = &JpegReader{cursor: 0, data: nil}
-	if err != nil {
-		return reader, 0, err
-	}
-	size := stat.Size()
-	reader.cursor = 0
-	reader.data = make([]byte, size)
-	n, err = fhnd.Read(reader.data)
-	return
+	reader.data, err = ioutil.ReadAll(r)
+	return reader, len(reader.data), err
 }
 
 func (b *JpegReader) pos() uint64 {
@@ -0,0 +1,277 @@
+package imgmeta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+Rewriting the metadata of a JPEG
+
+All metadata of a JPEG is stored in marker segments in front of the image data:
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    SOI              2 bytes  0xFFD8
+    Segments           ...    APPn (0xFFE0-0xFFEF), COM (0xFFFE), DQT, DHT, SOFn, ... each one as
+                                  Marker   2 bytes  0xFFxx
+                                  Length   2 bytes  length of the payload + 2
+                                  Payload    ...    e.g. "Exif\x00\x00" and a TIFF structure for APP1
+    SOS              ...      first scan, followed by the entropy-coded data, more scans and EOI
+
+The JpegWriter reads the segments up to the first SOS. Its APPn and COM segments can be replaced, inserted and
+deleted, everything from the first SOS on is copied byte for byte, so the image itself is never decoded.
+
+*/
+
+// Markers of the segments a JpegWriter can change, APP1 is MarkerAPP0 + 1
+const (
+	MarkerAPP0  uint16 = 0xFFE0
+	MarkerAPP15 uint16 = 0xFFEF
+	MarkerCOM   uint16 = cCOMMENT
+)
+
+// cJpegFileMode are the permissions of files written by a JpegWriter that does not preserve the mode
+const cJpegFileMode = 0644
+
+// Segment is a marker segment of a JPEG, e.g. an APP1 segment with EXIF
+type Segment struct {
+	Marker  uint16
+	Payload []byte // data after the length, e.g. "Exif\x00\x00" and the TIFF structure
+}
+
+// HasID reports whether the payload starts with id, e.g. "Exif\x00\x00". Every segment has the nil ID.
+func (s Segment) HasID(id []byte) bool {
+	return bytes.HasPrefix(s.Payload, id)
+}
+
+// JpegWriter rewrites the segments in front of the image data of a JPEG
+type JpegWriter struct {
+	Segments        []Segment // segments between SOI and the first SOS, in file order
+	PreserveMode    bool      // WriteFile keeps the permissions of the file it replaces
+	PreserveModTime bool      // WriteFile keeps the modification time of the file it replaces
+
+	source     io.ReadSeeker
+	scanOffset int64 // offset of the first SOS marker in source
+}
+
+// NewJpegWriter reads the segments of the JPEG in r up to the first SOS. r is read again when the JPEG is
+// written, so it has to stay open until then.
+func NewJpegWriter(r io.ReadSeeker) (*JpegWriter, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(r)
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header[:2]); err != nil || binary.BigEndian.Uint16(header) != cSOI {
+		return nil, &exifError{"Wrong format"}
+	}
+
+	w := &JpegWriter{source: r}
+	offset := start + 2
+	for {
+		if _, err := io.ReadFull(reader, header[:2]); err != nil {
+			return nil, &exifError{fmt.Sprintf("JPEG ends before the image data: %v", err)}
+		}
+		offset += 2
+		if header[0] != 0xFF {
+			return nil, &exifError{fmt.Sprintf("Encountered invalid section marker 0x%X", binary.BigEndian.Uint16(header))}
+		}
+		for header[1] == 0xFF {
+			if header[1], err = reader.ReadByte(); err != nil {
+				return nil, err
+			}
+			offset++
+		}
+
+		marker := binary.BigEndian.Uint16(header)
+		switch {
+		case marker == cSOS:
+			w.scanOffset = offset - 2
+			return w, nil
+		case marker == cEOI:
+			return nil, &exifError{"JPEG has no image data"}
+		case header[1] == 0x01 || (header[1] >= 0xD0 && header[1] <= 0xD7):
+			return nil, &exifError{fmt.Sprintf("Unexpected marker 0x%X before the image data", marker)}
+		}
+
+		if _, err := io.ReadFull(reader, header[2:4]); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(header[2:]))
+		if length < 2 {
+			return nil, &exifError{fmt.Sprintf("Segment 0x%X has an invalid length", marker)}
+		}
+		payload := make([]byte, length-2)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return nil, &exifError{fmt.Sprintf("Segment 0x%X is truncated", marker)}
+		}
+		offset += int64(length)
+		w.Segments = append(w.Segments, Segment{Marker: marker, Payload: payload})
+	}
+}
+
+// editable reports whether a segment may be changed, only APPn and COM segments are
+func editable(marker uint16) bool {
+	return (marker >= MarkerAPP0 && marker <= MarkerAPP15) || marker == MarkerCOM
+}
+
+func checkSegment(segment Segment) error {
+	if !editable(segment.Marker) {
+		return &exifError{fmt.Sprintf("Segment 0x%X is no APPn or COM segment", segment.Marker)}
+	}
+	if len(segment.Payload)+2 > 0xFFFF {
+		return &exifError{fmt.Sprintf("Payload of segment 0x%X is too large (%d bytes)", segment.Marker, len(segment.Payload))}
+	}
+	return nil
+}
+
+// Find returns the index of the first segment with the marker whose payload starts with id, -1 if there is none
+func (w *JpegWriter) Find(marker uint16, id []byte) int {
+	for i, segment := range w.Segments {
+		if segment.Marker == marker && segment.HasID(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Delete removes all segments with the marker whose payload starts with id and returns how many there were,
+// e.g. Delete(MarkerAPP0+1, []byte("Exif\x00\x00")) removes the EXIF
+func (w *JpegWriter) Delete(marker uint16, id []byte) (int, error) {
+	if !editable(marker) {
+		return 0, &exifError{fmt.Sprintf("Segment 0x%X is no APPn or COM segment", marker)}
+	}
+	kept := w.Segments[:0]
+	for _, segment := range w.Segments {
+		if segment.Marker != marker || !segment.HasID(id) {
+			kept = append(kept, segment)
+		}
+	}
+	deleted := len(w.Segments) - len(kept)
+	w.Segments = kept
+	return deleted, nil
+}
+
+// Insert adds a segment behind the APPn segments with the same or a lower marker, so APP0 (JFIF) stays the
+// first segment and COM segments follow all APPn segments
+func (w *JpegWriter) Insert(segment Segment) error {
+	if err := checkSegment(segment); err != nil {
+		return err
+	}
+	index := 0
+	for i, s := range w.Segments {
+		if editable(s.Marker) && s.Marker <= segment.Marker {
+			index = i + 1
+		}
+	}
+	w.Segments = append(w.Segments, Segment{})
+	copy(w.Segments[index+1:], w.Segments[index:])
+	w.Segments[index] = segment
+	return nil
+}
+
+// Replace puts the segment in place of the first segment with its marker whose payload starts with id, other
+// segments with the same marker and id are removed. The segment is inserted if there is none.
+func (w *JpegWriter) Replace(id []byte, segment Segment) error {
+	if err := checkSegment(segment); err != nil {
+		return err
+	}
+	index := w.Find(segment.Marker, id)
+	if index < 0 {
+		return w.Insert(segment)
+	}
+	kept := []Segment{}
+	for i, s := range w.Segments {
+		if i == index {
+			kept = append(kept, segment)
+		} else if s.Marker != segment.Marker || !s.HasID(id) {
+			kept = append(kept, s)
+		}
+	}
+	w.Segments = kept
+	return nil
+}
+
+// WriteTo writes the JPEG with the segments, followed by the image data of the source as it is
+func (w *JpegWriter) WriteTo(out io.Writer) (int64, error) {
+	buf := bufio.NewWriter(out)
+	written := int64(2)
+	binary.Write(buf, binary.BigEndian, uint16(cSOI))
+	for _, segment := range w.Segments {
+		binary.Write(buf, binary.BigEndian, segment.Marker)
+		binary.Write(buf, binary.BigEndian, uint16(len(segment.Payload)+2))
+		buf.Write(segment.Payload)
+		written += int64(len(segment.Payload)) + 4
+	}
+
+	if _, err := w.source.Seek(w.scanOffset, io.SeekStart); err != nil {
+		return written, err
+	}
+	n, err := io.Copy(buf, w.source)
+	written += n
+	if err != nil {
+		return written, err
+	}
+	return written, buf.Flush()
+}
+
+// WriteFile writes the JPEG to path through a temporary file in the same directory, which is renamed to path
+// when it is complete. If path already exists, its mode and modification time are kept as configured.
+func (w *JpegWriter) WriteFile(path string) error {
+	mode, modTime := os.FileMode(cJpegFileMode), time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		if w.PreserveMode {
+			mode = info.Mode().Perm()
+		}
+		if w.PreserveModTime {
+			modTime = info.ModTime()
+		}
+	}
+	return replaceFile(path, mode, modTime, func(out io.Writer) error {
+		_, err := w.WriteTo(out)
+		return err
+	})
+}
+
+// replaceFile writes path through a temporary file in the same directory, which gets the mode and, unless it is
+// zero, the modification time before it is renamed to path
+func replaceFile(path string, mode os.FileMode, modTime time.Time, write func(out io.Writer) error) (err error) {
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+
+	if err = write(temp); err != nil {
+		return err
+	}
+	if err = temp.Sync(); err != nil {
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(temp.Name(), mode); err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		if err = os.Chtimes(temp.Name(), time.Now(), modTime); err != nil {
+			return err
+		}
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,128 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JpegWriter", func() {
+
+	var original []byte
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		original, err = ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		dir, err = ioutil.TempDir("", "jpegwrite")
+		Expect(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should write an unchanged JPEG byte for byte", func() {
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		Expect(writer.Segments[0].Marker).Should(Equal(MarkerAPP0))
+
+		out := &bytes.Buffer{}
+		n, err := writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+		Expect(n).Should(Equal(int64(len(original))))
+		Expect(out.Bytes()).Should(Equal(original))
+	})
+
+	It("should replace, insert and delete segments without changing the image data", func() {
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		xmpID := []byte("http://ns.adobe.com/xap/1.0/\x00")
+		Expect(writer.Find(MarkerAPP0+1, xmpID)).ShouldNot(Equal(-1))
+
+		Expect(writer.Delete(MarkerAPP0+1, xmpID)).Should(Equal(1))
+		Expect(writer.Find(MarkerAPP0+1, xmpID)).Should(Equal(-1))
+		_, err = writer.Delete(0xFFDB, nil)
+		Expect(err).ShouldNot(BeNil())
+		Expect(writer.Replace(nil, Segment{Marker: MarkerCOM, Payload: []byte("first")})).Should(Succeed())
+		Expect(writer.Replace(nil, Segment{Marker: MarkerCOM, Payload: []byte("second")})).Should(Succeed())
+		Expect(writer.Insert(Segment{Marker: MarkerAPP0 + 1, Payload: append(xmpID, testXMP...)})).Should(Succeed())
+
+		// JFIF stays first, the new APP1 follows the EXIF and the comment follows all APPn segments
+		markers := []uint16{}
+		for _, segment := range writer.Segments {
+			markers = append(markers, segment.Marker)
+		}
+		comment := writer.Find(MarkerCOM, nil)
+		Expect(writer.Segments[comment].Payload).Should(Equal([]byte("second")))
+		Expect(markers[0]).Should(Equal(MarkerAPP0))
+		Expect(writer.Find(MarkerAPP0+1, xmpID)).Should(Equal(writer.Find(MarkerAPP0+1, []byte("Exif\x00\x00")) + 1))
+		for _, marker := range markers[comment+1:] {
+			Expect(marker).ShouldNot(BeNumerically(">=", MarkerAPP0))
+		}
+
+		Expect(writer.Insert(Segment{Marker: 0xFFDB, Payload: []byte{}})).ShouldNot(Succeed())
+		Expect(writer.Replace(nil, Segment{Marker: MarkerCOM, Payload: make([]byte, 0xFFFF)})).ShouldNot(Succeed())
+
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+		before, err := Decode(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		after, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(after.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+		hash, err := before.ContentHash(HashSHA256)
+		Expect(err).Should(BeNil())
+		Expect(after.ContentHash(HashSHA256)).Should(Equal(hash))
+	})
+
+	It("should replace a file atomically and keep its mode and modification time", func() {
+		path := filepath.Join(dir, "wall.jpg")
+		Expect(ioutil.WriteFile(path, original, 0600)).Should(Succeed())
+		modTime := time.Date(2020, 5, 3, 17, 10, 36, 0, time.UTC)
+		Expect(os.Chtimes(path, modTime, modTime)).Should(Succeed())
+
+		file, err := os.Open(path)
+		Expect(err).Should(BeNil())
+		defer file.Close()
+		writer, err := NewJpegWriter(file)
+		Expect(err).Should(BeNil())
+		writer.PreserveMode, writer.PreserveModTime = true, true
+		Expect(writer.Delete(MarkerAPP0+13, nil)).Should(Equal(1))
+		Expect(writer.WriteFile(path)).Should(Succeed())
+
+		info, err := os.Stat(path)
+		Expect(err).Should(BeNil())
+		Expect(info.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+		Expect(info.ModTime().Equal(modTime)).Should(BeTrue())
+		Expect(info.Size()).Should(BeNumerically("<", len(original)))
+
+		// no temporary files are left behind
+		files, err := ioutil.ReadDir(dir)
+		Expect(err).Should(BeNil())
+		Expect(files).Should(HaveLen(1))
+
+		writer.PreserveMode, writer.PreserveModTime = false, false
+		Expect(writer.WriteFile(path)).Should(Succeed())
+		info, err = os.Stat(path)
+		Expect(err).Should(BeNil())
+		Expect(info.Mode().Perm()).Should(Equal(os.FileMode(0644)))
+		Expect(info.ModTime().Equal(modTime)).Should(BeFalse())
+	})
+
+	It("should reject data that is no JPEG", func() {
+		_, err := NewJpegWriter(bytes.NewReader([]byte("GIF89a")))
+		Expect(err).ShouldNot(BeNil())
+		_, err = NewJpegWriter(bytes.NewReader([]byte{0xff, 0xd8, 0xff, 0xd9}))
+		Expect(err).ShouldNot(BeNil())
+	})
+
+})
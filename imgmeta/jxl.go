@@ -0,0 +1,274 @@
+package imgmeta
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of a JPEG XL file
+
+A JPEG XL file is either a bare codestream, starting with 0xFF 0x0A, or a container based on the ISO base media
+file format (see bmff.go):
+
+    JXL    signature box, 0x0D 0x0A 0x87 0x0A
+    ftyp   major brand "jxl "
+    jxll   level of the codestream (1)
+    jxlc   the codestream
+    jxlp   part of the codestream: index (4, the highest bit marks the last part), followed by the data
+    Exif   offset to the TIFF header (4), followed by the TIFF structure
+    xml    XMP packet
+    jumb   JUMBF superbox (ISO/IEC 19566-5), e.g. a C2PA manifest: a description box jumd with the type (16),
+           toggles (1) and a label (string, if toggles&0x02), followed by the content boxes
+    brob   brotli compressed box: type of the compressed box (4), followed by the brotli stream
+
+The codestream header is bit-packed, least significant bit first:
+
+    [Field]          [bits]            [description]
+    ---------------------------------------
+    Signature        16                0xFF 0x0A
+    SizeHeader
+      div8           1                 set if the sizes are multiples of 8
+      height         5 or U32          (h+1)*8 if div8, else h+1 with U32 = selector (2) and 9, 13, 18 or 30 bits
+      ratio          3                 0: width follows, else a fixed aspect ratio (see aJXLRatios)
+      width          5 or U32          like height, only if ratio is 0
+    ImageMetadata
+      all_default    1
+      extra_fields   1                 only if not all_default
+      orientation    3                 orientation-1, only if extra_fields
+
+As in HEIF, the orientation of the codestream is the orientation of the image, the EXIF orientation is ignored.
+
+*/
+
+func init() {
+	RegisterFormat("jxl", "\xFF\x0A", DecoderFunc(decodeJxl))
+	RegisterFormat("jxl", "\x00\x00\x00\x0CJXL \x0D\x0A\x87\x0A", DecoderFunc(decodeJxl))
+}
+
+// Tags of the JXL section
+const (
+	JXLImageWidth  uint16 = 0x0001
+	JXLImageHeight uint16 = 0x0002
+	JXLOrientation uint16 = 0x0003
+	JXLContainer   uint16 = 0x0004
+	JXLJUMBFLabels uint16 = 0x0005
+	JXLJUMBF       uint16 = 0x0010
+)
+
+var aJXLTagNames = map[string]uint16{
+	"ImageWidth":  JXLImageWidth,
+	"ImageHeight": JXLImageHeight,
+	"Orientation": JXLOrientation,
+	"Container":   JXLContainer,
+	"JUMBFLabels": JXLJUMBFLabels,
+	"JUMBF":       JXLJUMBF,
+}
+
+// aJXLRatios are the aspect ratios (width/height) of the SizeHeader
+var aJXLRatios = [8][2]uint64{{0, 0}, {1, 1}, {12, 10}, {4, 3}, {3, 2}, {16, 9}, {5, 4}, {2, 1}}
+
+// aJXLU32Bits are the bit counts of the U32 distribution of the sizes, by selector
+var aJXLU32Bits = [4]uint{9, 13, 18, 30}
+
+const (
+	cJXLMaxBoxSize    = 16 << 20 // metadata boxes larger than this are skipped
+	cJXLHeaderSize    = 64       // enough for SizeHeader and the start of ImageMetadata
+	cJXLCodestream    = "\xFF\x0A"
+	cJUMBFLabelToggle = 0x02
+)
+
+// tJXLAPP holds the codestream header and the JUMBF boxes of a JPEG XL
+type tJXLAPP struct {
+	tValuesAPP
+}
+
+func (t tJXLAPP) orientation() (uint16, bool) {
+	orientation, ok := t.values[JXLOrientation].(uint16)
+	return orientation, ok
+}
+
+func decodeJxl(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "jxl"}
+	jxl := &tJXLAPP{tValuesAPP: tValuesAPP{name: "JXL", names: aJXLTagNames, values: map[uint16]interface{}{JXLContainer: false}}}
+	image.apps[jxl.Name()] = jxl
+
+	header := make([]byte, cJXLHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return image, &exifError{"Wrong format"}
+	}
+	if bytes.HasPrefix(header[:n], []byte(cJXLCodestream)) {
+		return image, jxl.readCodestreamHeader(header[:n])
+	}
+
+	jxl.values[JXLContainer] = true
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return image, err
+	}
+	load := map[string]bool{"Exif": true, "xml ": true, "jumb": true, "brob": true}
+	boxes, err := readTopLevelBoxes(r, load, cJXLMaxBoxSize)
+	if err != nil && len(boxes) == 0 {
+		return image, err
+	}
+
+	codestream := false
+	for _, box := range boxes {
+		if box.boxType == "brob" {
+			box = decompressBox(box)
+		}
+		switch box.boxType {
+		case "jxlc", "jxlp":
+			if codestream {
+				continue
+			}
+			offset := box.offset
+			if box.boxType == "jxlp" {
+				offset += 4
+			}
+			if _, err = r.Seek(offset, io.SeekStart); err != nil {
+				return image, err
+			}
+			n, _ := io.ReadFull(r, header)
+			if err = jxl.readCodestreamHeader(header[:n]); err != nil {
+				return image, err
+			}
+			codestream = true
+		case "Exif":
+			if image.HasSection("EXIF") || box.data == nil {
+				continue
+			}
+			tiff, ok := exifItemTIFF(box.data)
+			if !ok {
+				log.Warn("JXL Exif box is invalid")
+				continue
+			}
+			exif := newExifAPP(tiff)
+			image.apps[exif.Name()] = exif
+		case "xml ":
+			if image.HasSection("XMP") || box.data == nil {
+				continue
+			}
+			xmp, err := newXMPAPP(box.data, box.data)
+			if err != nil {
+				log.Warn(err.Error())
+			}
+			image.apps[xmp.Name()] = xmp
+		case "jumb":
+			if box.data == nil {
+				continue
+			}
+			if _, ok := jxl.values[JXLJUMBF]; !ok {
+				jxl.values[JXLJUMBF] = box.data
+			}
+			labels, _ := jxl.values[JXLJUMBFLabels].([]string)
+			jxl.values[JXLJUMBFLabels] = append(labels, jumbfLabels(box.data)...)
+		}
+	}
+
+	if !codestream {
+		return image, &exifError{"JXL container has no codestream"}
+	}
+	return image, nil
+}
+
+// readCodestreamHeader reads the size and the orientation of a codestream
+func (t *tJXLAPP) readCodestreamHeader(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(cJXLCodestream)) {
+		return &exifError{"JXL codestream has no signature"}
+	}
+	bits := &tBitReader{data: data[2:]}
+
+	div8 := bits.bool()
+	height := bits.jxlSize(div8)
+	ratio := bits.u(3)
+	width := uint64(0)
+	if ratio == 0 {
+		width = bits.jxlSize(div8)
+	} else {
+		width = height * aJXLRatios[ratio][0] / aJXLRatios[ratio][1]
+	}
+
+	orientation := uint64(1)
+	if !bits.bool() && bits.bool() {
+		orientation = bits.u(3) + 1
+	}
+	if bits.failed {
+		return &exifError{"JXL codestream header is truncated"}
+	}
+
+	t.values[JXLImageWidth] = uint32(width)
+	t.values[JXLImageHeight] = uint32(height)
+	t.values[JXLOrientation] = uint16(orientation)
+	return nil
+}
+
+// decompressBox returns the box compressed in a brob box, or the box itself if it is invalid
+func decompressBox(box tBox) tBox {
+	if len(box.data) < 4 {
+		return box
+	}
+	boxType := string(box.data[:4])
+	data, err := readAllLimited(brotli.NewReader(bytes.NewReader(box.data[4:])), cJXLMaxBoxSize)
+	if err != nil {
+		log.Warn(fmt.Sprintf("JXL brob box '%s' is invalid: %v", boxType, err))
+		return box
+	}
+	return tBox{boxType: boxType, offset: box.offset, data: data}
+}
+
+// jumbfLabels returns the labels of the description boxes of a JUMBF superbox and its nested superboxes
+func jumbfLabels(data []byte) []string {
+	labels := []string{}
+	for _, box := range readBoxes(data) {
+		switch box.boxType {
+		case "jumd":
+			if len(box.data) > 17 && box.data[16]&cJUMBFLabelToggle != 0 {
+				label := box.data[17:]
+				if end := bytes.IndexByte(label, 0); end >= 0 {
+					label = label[:end]
+				}
+				labels = append(labels, string(label))
+			}
+		case "jumb":
+			labels = append(labels, jumbfLabels(box.data)...)
+		}
+	}
+	return labels
+}
+
+// tBitReader reads bits least significant bit first
+type tBitReader struct {
+	data   []byte
+	pos    uint // position in bits
+	failed bool
+}
+
+func (b *tBitReader) u(n uint) uint64 {
+	value := uint64(0)
+	for i := uint(0); i < n; i++ {
+		if b.pos/8 >= uint(len(b.data)) {
+			b.failed = true
+			return 0
+		}
+		value |= uint64(b.data[b.pos/8]>>(b.pos%8)&1) << i
+		b.pos++
+	}
+	return value
+}
+
+func (b *tBitReader) bool() bool {
+	return b.u(1) == 1
+}
+
+// jxlSize reads a dimension of the SizeHeader
+func (b *tBitReader) jxlSize(div8 bool) uint64 {
+	if div8 {
+		return (b.u(5) + 1) * 8
+	}
+	return b.u(aJXLU32Bits[b.u(2)]) + 1
+}
@@ -0,0 +1,87 @@
+package imgmeta_test
+
+import (
+	"bytes"
+
+	"github.com/andybalholm/brotli"
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// bitWriter writes bits least significant bit first
+type bitWriter struct {
+	data []byte
+	pos  uint
+}
+
+func (b *bitWriter) write(value uint64, n uint) *bitWriter {
+	for i := uint(0); i < n; i++ {
+		if b.pos%8 == 0 {
+			b.data = append(b.data, 0)
+		}
+		b.data[b.pos/8] |= byte(value>>i&1) << (b.pos % 8)
+		b.pos++
+	}
+	return b
+}
+
+// jxlCodestream returns the start of a codestream of 640x480 pixels with the orientation 6
+func jxlCodestream() []byte {
+	bits := &bitWriter{}
+	bits.write(0, 1)                         // div8
+	bits.write(0, 2).write(479, 9)           // height
+	bits.write(0, 3)                         // ratio
+	bits.write(1, 2).write(639, 13)          // width
+	bits.write(0, 1).write(1, 1).write(5, 3) // all_default, extra_fields, orientation
+	return append(append([]byte{0xff, 0x0a}, bits.data...), make([]byte, 8)...)
+}
+
+func sampleJxl() []byte {
+	compressed := &bytes.Buffer{}
+	writer := brotli.NewWriter(compressed)
+	writer.Write([]byte(testXMP))
+	writer.Close()
+
+	jumd := append(make([]byte, 16), 0x03)
+	jumd = append(jumd, "c2pa\x00"...)
+
+	data := append([]byte{0, 0, 0, 12}, "JXL \x0d\x0a\x87\x0a"...)
+	data = append(data, box("ftyp", []byte("jxl "), u32(0), []byte("jxl "))...)
+	data = append(data, box("brob", []byte("xml "), compressed.Bytes())...)
+	data = append(data, box("Exif", u32(0), tiffWithOrientation(3))...)
+	data = append(data, box("jumb", box("jumd", jumd), box("json", []byte("{}")))...)
+	return append(data, box("jxlp", u32(0x80000000), jxlCodestream())...)
+}
+
+var _ = Describe("JPEG XL", func() {
+
+	It("should read the size and orientation of a bare codestream", func() {
+		image, err := Decode(bytes.NewReader(jxlCodestream()))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("jxl"))
+		Expect(image.ReadPropertyValue("JXL", "Container")).Should(BeFalse())
+		Expect(image.Orientation()).Should(Equal(uint16(6)))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{640, 480}))
+	})
+
+	It("should read the metadata boxes of a container", func() {
+		image, err := Decode(bytes.NewReader(sampleJxl()))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("jxl"))
+		Expect(image.ReadPropertyValue("JXL", "Container")).Should(BeTrue())
+		Expect(image.ReadPropertyValue("JXL", "JUMBFLabels")).Should(Equal([]string{"c2pa"}))
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+		Expect(image.ReadTagValue("EXIF", ExifTagOrientation)).Should(Equal(uint16(3)))
+
+		// the orientation of the codestream wins
+		Expect(image.Orientation()).Should(Equal(uint16(6)))
+		width, height, err := image.DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{480, 640}))
+	})
+
+})
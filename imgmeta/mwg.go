@@ -0,0 +1,374 @@
+package imgmeta
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+Reconciliation of EXIF, IPTC and XMP
+
+Descriptive metadata is stored in up to three places at the same time, and the values often disagree because an
+application only updated one of them. The guidelines of the Metadata Working Group (MWG) map the fields:
+
+    [Field]            [EXIF]                                [IPTC]                 [XMP]
+    -----------------------------------------------------------------------------------------------------
+    title              -                                     2:05 Object Name       dc:title
+    description        ImageDescription                      2:120 Caption          dc:description
+    keywords           -                                     2:25 Keywords          dc:subject
+    creator            Artist (separated by ';')             2:80 By-line           dc:creator
+    copyright          Copyright                             2:116 Copyright        dc:rights
+    dateTimeOriginal   DateTimeOriginal, SubsecTimeOriginal, 2:55 Date Created,     photoshop:DateCreated
+                       OffsetTimeOriginal                    2:60 Time Created
+    dateTimeDigitized  DateTimeDigitized, SubsecTimeDig.,    2:62 Digitization Date xmp:CreateDate
+                       OffsetTimeDigitized                   2:63 Digitization Time
+    modifyDate         DateTime, SubsecTime, OffsetTime      -                      xmp:ModifyDate
+    location           -                                     2:92 Sub-location      Iptc4xmpCore:Location
+    city               -                                     2:90 City              photoshop:City
+    state              -                                     2:95 Province/State    photoshop:State
+    country            -                                     2:101 Country          photoshop:Country
+    countryCode        -                                     2:100 Country Code     Iptc4xmpCore:CountryCode
+    gpsLatitude        GPSLatitude, GPSLatitudeRef           -                      exif:GPSLatitude
+    gpsLongitude       GPSLongitude, GPSLongitudeRef         -                      exif:GPSLongitude
+
+A field is taken from the first source that has a value, in this order:
+
+ 1. EXIF
+ 2. IPTC, if the IPTC digest (Photoshop resource 0x0425) does not match the IPTC. The IPTC was then changed by an
+    application that does not know XMP, so it is newer than the XMP.
+ 3. XMP
+ 4. IPTC
+
+Dates are returned in the XMP form of ISO 8601 (2006-01-02T15:04:05.000+01:00), as precise as the source is,
+lists (keywords, creator) as []string and coordinates as signed degrees.
+
+*/
+
+// Sources of the reconciled metadata
+const (
+	MetadataSourceEXIF = "EXIF"
+	MetadataSourceIPTC = "IPTC"
+	MetadataSourceXMP  = "XMP"
+)
+
+// MetadataValue is a reconciled value together with the section it was taken from
+type MetadataValue struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// Metadata is the canonical view of the descriptive metadata of an image, reconciled from EXIF, IPTC and XMP.
+// Fields that none of the sections has are nil.
+type Metadata struct {
+	Title             *MetadataValue `json:"title"`
+	Description       *MetadataValue `json:"description"`
+	Keywords          *MetadataValue `json:"keywords"`
+	Creator           *MetadataValue `json:"creator"`
+	Copyright         *MetadataValue `json:"copyright"`
+	DateTimeOriginal  *MetadataValue `json:"dateTimeOriginal"`
+	DateTimeDigitized *MetadataValue `json:"dateTimeDigitized"`
+	ModifyDate        *MetadataValue `json:"modifyDate"`
+	Location          *MetadataValue `json:"location"`
+	City              *MetadataValue `json:"city"`
+	State             *MetadataValue `json:"state"`
+	Country           *MetadataValue `json:"country"`
+	CountryCode       *MetadataValue `json:"countryCode"`
+	GPSLatitude       *MetadataValue `json:"gpsLatitude"`
+	GPSLongitude      *MetadataValue `json:"gpsLongitude"`
+}
+
+// tMWGReader reads the value of a field from one section, ok is false if the section has none
+type tMWGReader func(i Image) (value interface{}, ok bool)
+
+// tMWGField defines where a field of Metadata is stored in each section
+type tMWGField struct {
+	id    string
+	field func(m *Metadata) **MetadataValue
+	exif  tMWGReader
+	iptc  tMWGReader
+	xmp   tMWGReader
+}
+
+var aMWGFields = []tMWGField{
+	{id: "title", field: func(m *Metadata) **MetadataValue { return &m.Title },
+		iptc: iptcText(IptcTagApplication2ObjectName), xmp: xmpText("dc:title")},
+	{id: "description", field: func(m *Metadata) **MetadataValue { return &m.Description },
+		exif: exifText(ExifTagImageDescription), iptc: iptcText(IptcTagApplication2Caption), xmp: xmpText("dc:description")},
+	{id: "keywords", field: func(m *Metadata) **MetadataValue { return &m.Keywords },
+		iptc: iptcList(IptcTagApplication2Keywords), xmp: xmpList("dc:subject")},
+	{id: "creator", field: func(m *Metadata) **MetadataValue { return &m.Creator },
+		exif: exifList(ExifTagArtist), iptc: iptcList(IptcTagApplication2Byline), xmp: xmpList("dc:creator")},
+	{id: "copyright", field: func(m *Metadata) **MetadataValue { return &m.Copyright },
+		exif: exifText(ExifTagCopyright), iptc: iptcText(IptcTagApplication2Copyright), xmp: xmpText("dc:rights")},
+	{id: "dateTimeOriginal", field: func(m *Metadata) **MetadataValue { return &m.DateTimeOriginal },
+		exif: exifDate(ExifTagDateTimeOriginal, ExifTagSubsecTimeOriginal, ExifTagOffsetTimeOriginal),
+		iptc: iptcDate(IptcTagApplication2DateCreated, IptcTagApplication2TimeCreated), xmp: xmpText("photoshop:DateCreated")},
+	{id: "dateTimeDigitized", field: func(m *Metadata) **MetadataValue { return &m.DateTimeDigitized },
+		exif: exifDate(ExifTagDateTimeDigitized, ExifTagSubsecTimeDigitized, ExifTagOffsetTimeDigitized),
+		iptc: iptcDate(IptcTagApplication2DigitizationDate, IptcTagApplication2DigitizationTime), xmp: xmpText("xmp:CreateDate")},
+	{id: "modifyDate", field: func(m *Metadata) **MetadataValue { return &m.ModifyDate },
+		exif: exifDate(ExifTagDateTime, ExifTagSubsecTime, ExifTagOffsetTime), xmp: xmpText("xmp:ModifyDate")},
+	{id: "location", field: func(m *Metadata) **MetadataValue { return &m.Location },
+		iptc: iptcText(IptcTagApplication2SubLocation), xmp: xmpText("Iptc4xmpCore:Location")},
+	{id: "city", field: func(m *Metadata) **MetadataValue { return &m.City },
+		iptc: iptcText(IptcTagApplication2City), xmp: xmpText("photoshop:City")},
+	{id: "state", field: func(m *Metadata) **MetadataValue { return &m.State },
+		iptc: iptcText(IptcTagApplication2ProvinceState), xmp: xmpText("photoshop:State")},
+	{id: "country", field: func(m *Metadata) **MetadataValue { return &m.Country },
+		iptc: iptcText(IptcTagApplication2CountryName), xmp: xmpText("photoshop:Country")},
+	{id: "countryCode", field: func(m *Metadata) **MetadataValue { return &m.CountryCode },
+		iptc: iptcText(IptcTagApplication2CountryCode), xmp: xmpText("Iptc4xmpCore:CountryCode")},
+	{id: "gpsLatitude", field: func(m *Metadata) **MetadataValue { return &m.GPSLatitude },
+		exif: exifGPS(ExifGpsTagGPSLatitude, ExifGpsTagGPSLatitudeRef), xmp: xmpGPS("exif:GPSLatitude")},
+	{id: "gpsLongitude", field: func(m *Metadata) **MetadataValue { return &m.GPSLongitude },
+		exif: exifGPS(ExifGpsTagGPSLongitude, ExifGpsTagGPSLongitudeRef), xmp: xmpGPS("exif:GPSLongitude")},
+}
+
+// tMWGSource is a section in the order in which the sections are searched
+type tMWGSource struct {
+	name   string
+	reader tMWGReader
+}
+
+// tIPTCDigester is implemented by the IPTC section, it reports whether the IPTC digest matches
+type tIPTCDigester interface {
+	digest() (hasDigest bool, matches bool)
+}
+
+// Metadata reconciles the descriptive metadata of the EXIF, IPTC and XMP sections following the guidelines
+// of the Metadata Working Group
+func (i Image) Metadata() Metadata {
+	iptcIsNewer := false
+	if digester, ok := i.apps["IPTC"].(tIPTCDigester); ok {
+		hasDigest, matches := digester.digest()
+		iptcIsNewer = hasDigest && !matches
+	}
+
+	m := Metadata{}
+	for _, f := range aMWGFields {
+		sources := []tMWGSource{{MetadataSourceEXIF, f.exif}}
+		if iptcIsNewer {
+			sources = append(sources, tMWGSource{MetadataSourceIPTC, f.iptc})
+		}
+		sources = append(sources, tMWGSource{MetadataSourceXMP, f.xmp}, tMWGSource{MetadataSourceIPTC, f.iptc})
+
+		for _, source := range sources {
+			if source.reader == nil {
+				continue
+			}
+			if value, ok := source.reader(i); ok {
+				*f.field(&m) = &MetadataValue{Value: value, Source: source.name}
+				break
+			}
+		}
+	}
+	return m
+}
+
+// Field returns a field by its ID, e.g. 'description', nil if it is not set
+func (m Metadata) Field(id string) (*MetadataValue, error) {
+	for _, f := range aMWGFields {
+		if strings.EqualFold(f.id, id) {
+			return *f.field(&m), nil
+		}
+	}
+	return nil, &exifError{fmt.Sprintf("MWG field '%s' not found", id)}
+}
+
+// Value returns the value of a field by its ID, e.g. 'description'. With the suffix '/source', e.g.
+// 'description/source', it returns the section the value was taken from.
+func (m Metadata) Value(id string) (interface{}, error) {
+	name := strings.TrimSuffix(id, "/source")
+	value, err := m.Field(name)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, &exifError{fmt.Sprintf("MWG field '%s' is not set", name)}
+	}
+	if name != id {
+		return value.Source, nil
+	}
+	return value.Value, nil
+}
+
+func exifText(tag uint16) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, _ := i.lookup("EXIF", tag)
+		text, ok := value.(string)
+		text = strings.TrimSpace(text)
+		return text, ok && text != ""
+	}
+}
+
+// exifList splits a list of names, like the Artist, at semicolons
+func exifList(tag uint16) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, ok := exifText(tag)(i)
+		if !ok {
+			return nil, false
+		}
+		return splitList(strings.Split(value.(string), ";"))
+	}
+}
+
+var (
+	rEXIFSubsec = regexp.MustCompile(`^[0-9]+$`)
+	rEXIFOffset = regexp.MustCompile(`^[+-][0-9]{2}:[0-9]{2}$`)
+)
+
+// exifDate joins a date with its subseconds and time zone offset
+func exifDate(tag, subsecTag, offsetTag uint16) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, ok := exifText(tag)(i)
+		if !ok {
+			return nil, false
+		}
+		date := []byte(value.(string))
+		if len(date) != 19 || date[4] != ':' || date[7] != ':' || date[10] != ' ' || strings.HasPrefix(string(date), "0000") {
+			return nil, false
+		}
+		date[4], date[7], date[10] = '-', '-', 'T'
+
+		text := string(date)
+		if subsec, ok := exifText(subsecTag)(i); ok && rEXIFSubsec.MatchString(subsec.(string)) {
+			text += "." + subsec.(string)
+		}
+		// a blank offset is '   :  ', trimmed to ':'
+		if offset, ok := exifText(offsetTag)(i); ok && rEXIFOffset.MatchString(offset.(string)) {
+			text += offset.(string)
+		}
+		return text, true
+	}
+}
+
+// exifGPS reads a coordinate of the GPS IFD as signed degrees, the reference ('S' or 'W') gives the sign
+func exifGPS(tag, refTag uint16) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		exif, ok := i.apps["EXIF"].(tRawExif)
+		if !ok {
+			return nil, false
+		}
+		entry, ok := exif.rawTag(tag, cIFDGPS)
+		values := entry.rationals()
+		if !ok || len(values) != 3 {
+			return nil, false
+		}
+		degrees := values[0] + values[1]/60 + values[2]/3600
+		if ref, ok := exif.rawTag(refTag, cIFDGPS); ok && len(ref.data) > 0 && (ref.data[0] == 'S' || ref.data[0] == 'W') {
+			degrees = -degrees
+		}
+		return degrees, true
+	}
+}
+
+func iptcText(tag uint16) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, _ := i.lookup("IPTC", tag)
+		text, ok := value.(string)
+		text = strings.TrimSpace(text)
+		return text, ok && text != ""
+	}
+}
+
+func iptcList(tag uint16) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, _ := i.lookup("IPTC", tag)
+		list, ok := value.([]string)
+		if !ok {
+			return nil, false
+		}
+		return splitList(list)
+	}
+}
+
+// iptcDate joins a date (CCYYMMDD) with its time (HHMMSS±HHMM)
+func iptcDate(tag, timeTag uint16) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, ok := iptcText(tag)(i)
+		if !ok {
+			return nil, false
+		}
+		date := value.(string)
+		if _, err := strconv.Atoi(date); err != nil || len(date) != 8 || strings.HasPrefix(date, "0000") {
+			return nil, false
+		}
+		text := date[:4] + "-" + date[4:6] + "-" + date[6:]
+
+		if value, ok := iptcText(timeTag)(i); ok && len(value.(string)) >= 6 {
+			clock := value.(string)
+			text += "T" + clock[:2] + ":" + clock[2:4] + ":" + clock[4:6]
+			if zone := clock[6:]; len(zone) == 5 {
+				text += zone[:3] + ":" + zone[3:]
+			}
+		}
+		return text, true
+	}
+}
+
+func xmpText(name string) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, _ := i.ReadPropertyValue("XMP", name)
+		switch v := value.(type) {
+		case string:
+			return v, v != ""
+		case []string:
+			// a list where a single text is expected, e.g. dc:rights written as a Bag
+			return strings.Join(v, "; "), len(v) > 0
+		}
+		return nil, false
+	}
+}
+
+func xmpList(name string) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, _ := i.ReadPropertyValue("XMP", name)
+		switch v := value.(type) {
+		case string:
+			return splitList([]string{v})
+		case []string:
+			return splitList(v)
+		}
+		return nil, false
+	}
+}
+
+var rXMPCoordinate = regexp.MustCompile(`^\s*(\d+),(\d+(?:\.\d+)?)(?:,(\d+(?:\.\d+)?))?([NSEW])\s*$`)
+
+// xmpGPS reads a coordinate of the form 'DDD,MM,SSk' or 'DDD,MM.mmk' as signed degrees
+func xmpGPS(name string) tMWGReader {
+	return func(i Image) (interface{}, bool) {
+		value, ok := xmpText(name)(i)
+		if !ok {
+			return nil, false
+		}
+		match := rXMPCoordinate.FindStringSubmatch(value.(string))
+		if match == nil {
+			return nil, false
+		}
+		degrees := 0.0
+		for n, unit := range []float64{1, 60, 3600} {
+			if number, err := strconv.ParseFloat(match[1+n], 64); err == nil {
+				degrees += number / unit
+			}
+		}
+		if match[4] == "S" || match[4] == "W" {
+			degrees = -degrees
+		}
+		return math.Round(degrees*1e9) / 1e9, true
+	}
+}
+
+// splitList trims the items of a list and drops the empty ones, ok is false if none is left
+func splitList(items []string) (interface{}, bool) {
+	list := []string{}
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, len(list) > 0
+}
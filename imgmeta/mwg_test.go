@@ -0,0 +1,96 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"os"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// sampleMWG returns a PSD with IPTC and XMP that disagree, digest is the IPTC digest resource
+func sampleMWG(digest func(iptc []byte) []byte) []byte {
+	iptc := dataset(1, 90, "\x1b%G")
+	iptc = append(iptc, dataset(2, 5, "Die Mauer")...)
+	iptc = append(iptc, dataset(2, 25, "mauer")...)
+	iptc = append(iptc, dataset(2, 25, "berlin")...)
+	iptc = append(iptc, dataset(2, 80, "Jürgen")...)
+	iptc = append(iptc, dataset(2, 55, "20200503")...)
+	iptc = append(iptc, dataset(2, 60, "171036+0200")...)
+	iptc = append(iptc, dataset(2, 90, "Berlin")...)
+	iptc = append(iptc, dataset(2, 221, "unknown dataset")...)
+
+	resources := resource(0x0404, iptc)
+	resources = append(resources, resource(0x0425, digest(iptc))...)
+	return psdFile(1, 3, 30, 20, append(resources, resource(0x0424, []byte(testXMP))...), nil)
+}
+
+var _ = Describe("MWG", func() {
+
+	It("should read the IPTC datasets", func() {
+		image, err := Decode(bytes.NewReader(sampleMWG(func(iptc []byte) []byte { return nil })))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadTagValue("IPTC", IptcTagApplication2ObjectName)).Should(Equal("Die Mauer"))
+		Expect(image.ReadPropertyValue("IPTC", "keywords")).Should(Equal([]string{"mauer", "berlin"}))
+		Expect(image.ReadPropertyValue("IPTC", "creator")).Should(Equal([]string{"Jürgen"}))
+		Expect(image.ReadPropertyValue("IPTC", "DateCreated")).Should(Equal("20200503"))
+
+		latin1 := psdFile(1, 3, 30, 20, resource(0x0404, dataset(2, 90, "K\xf6ln")), nil)
+		image, err = Decode(bytes.NewReader(latin1))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("IPTC", "City")).Should(Equal("Köln"))
+	})
+
+	It("should prefer the XMP if the IPTC digest matches", func() {
+		image, err := Decode(bytes.NewReader(sampleMWG(func(iptc []byte) []byte {
+			sum := md5.Sum(iptc)
+			return sum[:]
+		})))
+		Expect(err).Should(BeNil())
+
+		meta := image.Metadata()
+		Expect(*meta.Title).Should(Equal(MetadataValue{Value: "The Wall", Source: MetadataSourceXMP}))
+		Expect(*meta.Keywords).Should(Equal(MetadataValue{Value: []string{"wall", "test"}, Source: MetadataSourceXMP}))
+		Expect(*meta.Creator).Should(Equal(MetadataValue{Value: []string{"Jürgen"}, Source: MetadataSourceIPTC}))
+		Expect(*meta.DateTimeOriginal).Should(Equal(MetadataValue{Value: "2020-05-03T17:10:36+02:00", Source: MetadataSourceIPTC}))
+		Expect(*meta.City).Should(Equal(MetadataValue{Value: "Berlin", Source: MetadataSourceIPTC}))
+		Expect(meta.Description).Should(BeNil())
+		Expect(meta.GPSLatitude).Should(BeNil())
+	})
+
+	It("should prefer the IPTC if it was changed by another application", func() {
+		image, err := Decode(bytes.NewReader(sampleMWG(func(iptc []byte) []byte {
+			sum := md5.Sum([]byte("an older IPTC"))
+			return sum[:]
+		})))
+		Expect(err).Should(BeNil())
+
+		meta := image.Metadata()
+		Expect(meta.Value("title")).Should(Equal("Die Mauer"))
+		Expect(meta.Value("title/source")).Should(Equal(MetadataSourceIPTC))
+		Expect(meta.Value("keywords")).Should(Equal([]string{"mauer", "berlin"}))
+
+		_, err = meta.Value("description")
+		Expect(err).ShouldNot(BeNil())
+		_, err = meta.Value("unknown")
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should prefer the EXIF of a JPEG", func() {
+		file, err := os.Open(sampleJpeg)
+		Expect(err).Should(BeNil())
+		defer file.Close()
+		image, err := Decode(file)
+		Expect(err).Should(BeNil())
+
+		meta := image.Metadata()
+		Expect(*meta.Description).Should(Equal(MetadataValue{Value: "Daten-Bildbeschreibung", Source: MetadataSourceEXIF}))
+		Expect(*meta.Copyright).Should(Equal(MetadataValue{Value: "Daten-Urheberrechtsvermerk", Source: MetadataSourceEXIF}))
+		Expect(*meta.Creator).Should(Equal(MetadataValue{Value: []string{"Daten-Künstler"}, Source: MetadataSourceEXIF}))
+		Expect(*meta.DateTimeOriginal).Should(Equal(MetadataValue{Value: "2020-05-03T17:10:36", Source: MetadataSourceEXIF}))
+		Expect(meta.Value("keywords")).Should(Equal([]string{"test", "wall"}))
+	})
+
+})
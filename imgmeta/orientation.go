@@ -0,0 +1,145 @@
+package imgmeta
+
+import (
+	"math"
+)
+
+/*
+EXIF Orientation
+
+The pixels of a JPEG are stored as they come from the sensor. If the camera was rotated, it records the
+rotation in the EXIF tag Orientation (0x0112), and the viewer has to transform the image before it is shown:
+
+    [Value]  [transformation]
+    ---------------------------------------
+    1        none
+    2        mirror horizontal
+    3        rotate 180
+    4        mirror vertical
+    5        mirror horizontal and rotate 270 CW
+    6        rotate 90 CW
+    7        mirror horizontal and rotate 90 CW
+    8        rotate 270 CW
+
+For the values 5 to 8 the displayed width and height are swapped relative to the stored ones.
+
+*/
+
+var aOrientationLabels = map[uint16]string{
+	1: "Horizontal (normal)",
+	2: "Mirror horizontal",
+	3: "Rotate 180",
+	4: "Mirror vertical",
+	5: "Mirror horizontal and rotate 270 CW",
+	6: "Rotate 90 CW",
+	7: "Mirror horizontal and rotate 90 CW",
+	8: "Rotate 270 CW",
+}
+
+// tSizer is implemented by sections that know the size of the image, like the SOFn frame header
+type tSizer interface {
+	size() (width, height uint32, ok bool)
+}
+
+// tOrienter is implemented by sections of containers that store the orientation themselves, like irot of HEIF
+type tOrienter interface {
+	orientation() (uint16, bool)
+}
+
+// Orientation returns the EXIF orientation (1-8) of the image, 1 if it is not set or invalid.
+// If the container stores the orientation itself (HEIF), that one is used instead.
+func (i Image) Orientation() uint16 {
+	for _, app := range i.apps {
+		if orienter, ok := app.(tOrienter); ok {
+			if orientation, ok := orienter.orientation(); ok {
+				return orientation
+			}
+		}
+	}
+
+	value, ok := i.lookup("EXIF", ExifTagOrientation)
+	if !ok {
+		return 1
+	}
+	orientation, ok := value.(uint16)
+	if !ok || orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// OrientationLabel returns a human readable description of the EXIF orientation
+func OrientationLabel(orientation uint16) string {
+	return aOrientationLabels[orientation]
+}
+
+// Dimensions returns the stored width and height of the image, read from the image header
+// (e.g. SOFn of a JPEG, IHDR of a PNG). If there is none, the EXIF PixelXDimension and
+// PixelYDimension are used.
+func (i Image) Dimensions() (width, height uint32, err error) {
+	for _, app := range i.apps {
+		if sizer, ok := app.(tSizer); ok {
+			if w, h, ok := sizer.size(); ok && w > 0 && h > 0 {
+				return w, h, nil
+			}
+		}
+	}
+
+	w, okW := i.lookup("EXIF", ExifTagPixelXDimension)
+	h, okH := i.lookup("EXIF", ExifTagPixelYDimension)
+	if okW && okH {
+		width, okW = toUint32(w)
+		height, okH = toUint32(h)
+		if okW && okH && width > 0 && height > 0 {
+			return width, height, nil
+		}
+	}
+	return 0, 0, &exifError{"Image has no dimensions"}
+}
+
+// DisplayDimensions returns width and height as the image is shown, after the EXIF orientation is applied
+func (i Image) DisplayDimensions() (width, height uint32, err error) {
+	width, height, err = i.Dimensions()
+	if err != nil {
+		return
+	}
+	if i.Orientation() >= 5 {
+		width, height = height, width
+	}
+	return
+}
+
+// AspectRatio returns width / height as displayed, rounded to four decimals
+func (i Image) AspectRatio() (float64, error) {
+	width, height, err := i.DisplayDimensions()
+	if err != nil {
+		return 0, err
+	}
+	return math.Round(float64(width)/float64(height)*10000) / 10000, nil
+}
+
+// lookup reads a tag value without logging missing sections
+func (i Image) lookup(appname string, tagID uint16) (interface{}, bool) {
+	app, exists := i.apps[appname]
+	if !exists {
+		return nil, false
+	}
+	value, err := app.ReadValue(tagID)
+	if err != nil || value == nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// toUint32 converts the unsigned integer types of EXIF values
+func toUint32(value interface{}) (uint32, bool) {
+	switch v := value.(type) {
+	case uint8:
+		return uint32(v), true
+	case uint16:
+		return uint32(v), true
+	case uint32:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,69 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// exifOrientationJpeg writes a w x h JPEG with an EXIF APP1 segment holding only the Orientation tag
+func exifOrientationJpeg(w, h int, orientation uint16) string {
+	buf := bytes.Buffer{}
+	Expect(jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil)).Should(Succeed())
+	data := buf.Bytes()
+
+	app1 := append([]byte{0xFF, 0xE1, 0, 0, 'E', 'x', 'i', 'f', 0, 0}, tiffWithOrientation(orientation)...)
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(app1)-2))
+
+	tmp, err := ioutil.TempFile("", "imgindex-*.jpg")
+	Expect(err).Should(BeNil())
+	defer tmp.Close()
+	tmp.Write(data[:2])
+	tmp.Write(app1)
+	tmp.Write(data[2:])
+	return tmp.Name()
+}
+
+var _ = Describe("Orientation", func() {
+
+	It("should report the stored dimensions", func() {
+		image := readJpegFile(sampleJpeg)
+
+		Expect(image.Orientation()).Should(Equal(uint16(1)))
+		width, height, err := image.DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect(width).Should(Equal(uint32(500)))
+		Expect(height).Should(Equal(uint32(333)))
+	})
+
+	It("should swap the dimensions of rotated images", func() {
+		path := exifOrientationJpeg(60, 40, 6)
+		defer os.Remove(path)
+		image := readJpegFile(path)
+
+		Expect(image.Orientation()).Should(Equal(uint16(6)))
+		Expect(OrientationLabel(image.Orientation())).Should(Equal("Rotate 90 CW"))
+		width, height, err := image.DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect(width).Should(Equal(uint32(40)))
+		Expect(height).Should(Equal(uint32(60)))
+		Expect(image.AspectRatio()).Should(Equal(0.6667))
+	})
+
+	It("should not swap mirrored images", func() {
+		path := exifOrientationJpeg(60, 40, 2)
+		defer os.Remove(path)
+
+		width, _, err := readJpegFile(path).DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect(width).Should(Equal(uint32(60)))
+	})
+
+})
@@ -0,0 +1,154 @@
+package imgmeta
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+/*
+Perceptual hashes
+
+Perceptual hashes are computed from the decoded pixels of an image. Other than a cryptographic hash they change only
+a little if the image is resized, re-compressed or slightly edited, so the Hamming distance of two hashes (the number
+of different bits) is a measure for the visual similarity of two images.
+
+dHash (difference hash): the image is scaled down to 9x8 gray pixels, every bit tells whether a pixel is brighter than
+its right neighbour.
+
+pHash (DCT hash): the image is scaled down to 32x32 gray pixels and transformed with a two-dimensional DCT. The 8x8
+lowest frequencies (top left corner of the DCT) are compared to their median, every bit tells whether a frequency is
+above the median.
+
+*/
+
+// DHash returns the 64 bit difference hash of an image
+func DHash(img image.Image) uint64 {
+	gray := grayscale(img, 9, 8)
+
+	hash := uint64(0)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y*9+x] > gray[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// PHash returns the 64 bit DCT based perceptual hash of an image
+func PHash(img image.Image) uint64 {
+	const size = 32
+	gray := grayscale(img, size, size)
+	coeffs := dct2D(gray, size)
+
+	lows := make([]float64, 0, 64)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			lows = append(lows, coeffs[y*size+x])
+		}
+	}
+
+	// The DC coefficient is the average brightness, leave it out for the median of the 63 others
+	sorted := append([]float64{}, lows[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	hash := uint64(0)
+	for _, c := range lows {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of different bits of two hashes
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscale scales an image down to w x h gray values (0-255), every target pixel is the
+// average of the source pixels it covers
+func grayscale(img image.Image, w, h int) []float64 {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	sums := make([]float64, w*h)
+	counts := make([]float64, w*h)
+
+	luma := lumaFunc(img)
+	for y := 0; y < sh; y++ {
+		ty := y * h / sh
+		for x := 0; x < sw; x++ {
+			tx := x * w / sw
+			sums[ty*w+tx] += luma(bounds.Min.X+x, bounds.Min.Y+y)
+			counts[ty*w+tx]++
+		}
+	}
+
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= counts[i]
+		} else if sw > 0 && sh > 0 {
+			// image is smaller than the target, use the nearest pixel
+			sums[i] = luma(bounds.Min.X+(i%w)*sw/w, bounds.Min.Y+(i/w)*sh/h)
+		}
+	}
+	return sums
+}
+
+// lumaFunc returns a fast accessor for the brightness of a pixel
+func lumaFunc(img image.Image) func(x, y int) float64 {
+	switch i := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) float64 {
+			return float64(i.Y[i.YOffset(x, y)])
+		}
+	case *image.Gray:
+		return func(x, y int) float64 {
+			return float64(i.Pix[i.PixOffset(x, y)])
+		}
+	}
+	return func(x, y int) float64 {
+		return float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+	}
+}
+
+// dct2D computes the two-dimensional DCT-II of a size x size matrix
+func dct2D(in []float64, size int) []float64 {
+	cos := make([]float64, size*size)
+	for k := 0; k < size; k++ {
+		for n := 0; n < size; n++ {
+			cos[k*size+n] = math.Cos(math.Pi / float64(size) * (float64(n) + 0.5) * float64(k))
+		}
+	}
+
+	// rows first, then columns
+	rows := make([]float64, size*size)
+	for y := 0; y < size; y++ {
+		for k := 0; k < size; k++ {
+			sum := 0.0
+			for n := 0; n < size; n++ {
+				sum += in[y*size+n] * cos[k*size+n]
+			}
+			rows[y*size+k] = sum
+		}
+	}
+
+	out := make([]float64, size*size)
+	for x := 0; x < size; x++ {
+		for k := 0; k < size; k++ {
+			sum := 0.0
+			for n := 0; n < size; n++ {
+				sum += rows[n*size+x] * cos[k*size+n]
+			}
+			out[k*size+x] = sum
+		}
+	}
+	return out
+}
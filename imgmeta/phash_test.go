@@ -0,0 +1,64 @@
+package imgmeta_test
+
+import (
+	"image"
+	"math/bits"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// noiseImage returns a gray image of pseudo-random pixels, scaled up by factor
+func noiseImage(seed uint32, size int, factor int) *image.Gray {
+	pixels := make([]uint8, size*size)
+	for i := range pixels {
+		seed = seed*1664525 + 1013904223
+		pixels[i] = uint8(seed >> 24)
+	}
+	img := image.NewGray(image.Rect(0, 0, size*factor, size*factor))
+	for y := 0; y < size*factor; y++ {
+		for x := 0; x < size*factor; x++ {
+			img.Pix[img.PixOffset(x, y)] = pixels[(y/factor)*size+x/factor]
+		}
+	}
+	return img
+}
+
+// gradientImage returns a gray image that gets darker from left to right, or brighter if rising
+func gradientImage(rising bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 90, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 90; x++ {
+			value := uint8(255 - x*2)
+			if rising {
+				value = uint8(x * 2)
+			}
+			img.Pix[img.PixOffset(x, y)] = value
+		}
+	}
+	return img
+}
+
+var _ = Describe("Perceptual hashes", func() {
+
+	It("should set a dHash bit for every pixel brighter than its right neighbour", func() {
+		Expect(DHash(gradientImage(false))).Should(Equal(uint64(0xFFFFFFFFFFFFFFFF)))
+		Expect(DHash(gradientImage(true))).Should(Equal(uint64(0)))
+		Expect(HammingDistance(DHash(gradientImage(false)), DHash(gradientImage(true)))).Should(Equal(64))
+	})
+
+	It("should compare the AC coefficients of the pHash to their median", func() {
+		// 31 of the 63 AC coefficients are above the median, the top bit is the DC coefficient
+		hash := PHash(noiseImage(1, 32, 1))
+		Expect(bits.OnesCount64(hash & (1<<63 - 1))).Should(Equal(31))
+	})
+
+	It("should give scaled copies the same hashes and other images distant ones", func() {
+		original, scaled, other := noiseImage(1, 32, 1), noiseImage(1, 32, 4), noiseImage(2, 32, 1)
+		Expect(PHash(scaled)).Should(Equal(PHash(original)))
+		Expect(DHash(noiseImage(1, 72, 4))).Should(Equal(DHash(noiseImage(1, 72, 1))))
+		Expect(HammingDistance(PHash(original), PHash(other))).Should(BeNumerically(">", 16))
+	})
+
+})
@@ -0,0 +1,263 @@
+package imgmeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of a PNG file
+
+A PNG file starts with an 8 byte signature ("\211PNG\r\n\032\n") followed by a sequence of chunks:
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    Length           4 bytes  length of the data (big-endian)
+    Type             4 bytes  chunk type, e.g. "IHDR"
+    Data               ...    chunk data
+    CRC              4 bytes  checksum over type and data
+
+The chunks with metadata are:
+
+    IHDR   width (4), height (4), bit depth (1), colour type (1), compression (1), filter (1), interlace (1)
+    tEXt   keyword, 0, text (Latin-1)
+    zTXt   keyword, 0, compression method (1), zlib compressed text (Latin-1)
+    iTXt   keyword, 0, compression flag (1), compression method (1), language tag, 0, translated keyword, 0,
+           text (UTF-8, zlib compressed if the flag is set). XMP is stored with the keyword "XML:com.adobe.xmp"
+    eXIf   EXIF data, a TIFF structure without the "Exif\000\000" identifier
+    iCCP   profile name, 0, compression method (1), zlib compressed ICC profile
+    sRGB   rendering intent (1)
+
+The image data (IDAT) and chunks larger than cPNGMaxChunkSize are skipped, so are compressed chunks that inflate
+to more than that, reading stops at IEND. A chunk whose length exceeds 2^31-1 (the limit of the PNG specification)
+or the end of the file is an error.
+
+*/
+
+const cPNGSignature = "\x89PNG\r\n\x1a\n"
+
+const (
+	cPNGMaxLength    = 0x7FFFFFFF // largest chunk length allowed by the PNG specification
+	cPNGMaxChunkSize = 16 << 20   // metadata chunks larger than this are skipped
+)
+
+func init() {
+	RegisterFormat("png", cPNGSignature, DecoderFunc(decodePng))
+}
+
+// Tags of the PNG section
+const (
+	PNGImageWidth          uint16 = 0x0001
+	PNGImageHeight         uint16 = 0x0002
+	PNGBitDepth            uint16 = 0x0003
+	PNGColorType           uint16 = 0x0004
+	PNGInterlace           uint16 = 0x0005
+	PNGSRGBRenderingIntent uint16 = 0x0010
+	PNGICCProfileName      uint16 = 0x0011
+	PNGICCProfile          uint16 = 0x0012
+)
+
+var aPNGTagNames = map[string]uint16{
+	"ImageWidth":          PNGImageWidth,
+	"ImageHeight":         PNGImageHeight,
+	"BitDepth":            PNGBitDepth,
+	"ColorType":           PNGColorType,
+	"Interlace":           PNGInterlace,
+	"SRGBRenderingIntent": PNGSRGBRenderingIntent,
+	"ICCProfileName":      PNGICCProfileName,
+	"ICCProfile":          PNGICCProfile,
+}
+
+const cXMPKeyword = "XML:com.adobe.xmp"
+
+// tPNGAPP holds the header and the text chunks of a PNG
+type tPNGAPP struct {
+	tValuesAPP
+	text map[string]string // tEXt, zTXt and iTXt by keyword
+}
+
+// ReadProperty returns a header value by its name (e.g. 'BitDepth') or the text of a keyword (e.g. 'Title')
+func (t tPNGAPP) ReadProperty(name string) (interface{}, error) {
+	if tag, ok := aPNGTagNames[name]; ok {
+		return t.ReadValue(tag)
+	}
+	text, ok := t.text[name]
+	if !ok {
+		return nil, &exifError{fmt.Sprintf("PNG text '%s' not found", name)}
+	}
+	return text, nil
+}
+
+func decodePng(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "png"}
+	png := &tPNGAPP{tValuesAPP: tValuesAPP{name: "PNG", names: aPNGTagNames, values: map[uint16]interface{}{}}, text: map[string]string{}}
+
+	signature := make([]byte, len(cPNGSignature))
+	if _, err = io.ReadFull(r, signature); err != nil || string(signature) != cPNGSignature {
+		return image, &exifError{"Wrong format"}
+	}
+
+	offset, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return image, err
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return image, err
+	}
+	if _, err = r.Seek(offset, io.SeekStart); err != nil {
+		return image, err
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err = io.ReadFull(r, header); err != nil {
+			return image, &exifError{fmt.Sprintf("PNG ended without IEND: %v", err)}
+		}
+		offset += 8
+		length := binary.BigEndian.Uint32(header)
+		chunkType := string(header[4:8])
+		if length > cPNGMaxLength {
+			return image, &exifError{fmt.Sprintf("PNG chunk %s has an invalid length %d", chunkType, length)}
+		}
+		if offset+int64(length)+4 > end {
+			return image, &exifError{fmt.Sprintf("PNG chunk %s is truncated", chunkType)}
+		}
+		offset += int64(length) + 4
+
+		if chunkType == "IDAT" || chunkType == "fdAT" || length > cPNGMaxChunkSize {
+			if chunkType != "IDAT" && chunkType != "fdAT" {
+				log.Warn(fmt.Sprintf("PNG chunk %s is too large (%d bytes) and is skipped", chunkType, length))
+			}
+			// skip the data and the CRC
+			if _, err = r.Seek(offset, io.SeekStart); err != nil {
+				return image, err
+			}
+			continue
+		}
+
+		data := make([]byte, length+4)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return image, &exifError{fmt.Sprintf("PNG chunk %s is truncated", chunkType)}
+		}
+		data = data[:length]
+
+		switch chunkType {
+		case "IHDR":
+			if len(data) < 13 {
+				return image, &exifError{"PNG IHDR is too short"}
+			}
+			png.values[PNGImageWidth] = binary.BigEndian.Uint32(data)
+			png.values[PNGImageHeight] = binary.BigEndian.Uint32(data[4:])
+			png.values[PNGBitDepth] = data[8]
+			png.values[PNGColorType] = data[9]
+			png.values[PNGInterlace] = data[12]
+		case "tEXt":
+			keyword, text := splitNull(data)
+			png.text[keyword] = latin1ToUTF8(text)
+		case "zTXt":
+			keyword, rest := splitNull(data)
+			if len(rest) < 1 {
+				continue
+			}
+			text, err := inflate(rest[1:])
+			if err != nil {
+				log.Warn(fmt.Sprintf("PNG zTXt '%s': %v", keyword, err))
+				continue
+			}
+			png.text[keyword] = latin1ToUTF8(text)
+		case "iTXt":
+			keyword, text, err := readITXt(data)
+			if err != nil {
+				log.Warn(fmt.Sprintf("PNG iTXt '%s': %v", keyword, err))
+				continue
+			}
+			if keyword == cXMPKeyword {
+				xmp, err := newXMPAPP(text, text)
+				if err != nil {
+					log.Warn(err.Error())
+				}
+				image.apps[xmp.Name()] = xmp
+				continue
+			}
+			png.text[keyword] = string(text)
+		case "eXIf":
+			if len(data) < 8 {
+				log.Warn("PNG eXIf chunk is too short")
+				continue
+			}
+			exif := newExifAPP(data)
+			image.apps[exif.Name()] = exif
+		case "iCCP":
+			name, rest := splitNull(data)
+			png.values[PNGICCProfileName] = latin1ToUTF8([]byte(name))
+			if len(rest) > 1 {
+				if profile, err := inflate(rest[1:]); err == nil {
+					png.values[PNGICCProfile] = profile
+				}
+			}
+		case "sRGB":
+			if len(data) > 0 {
+				png.values[PNGSRGBRenderingIntent] = data[0]
+			}
+		case "IEND":
+			image.apps[png.Name()] = png
+			return image, nil
+		}
+	}
+}
+
+// readITXt returns keyword and text of an iTXt chunk
+func readITXt(data []byte) (string, []byte, error) {
+	keyword, rest := splitNull(data)
+	if len(rest) < 2 {
+		return keyword, nil, &exifError{"iTXt chunk is too short"}
+	}
+	compressed := rest[0] == 1
+	_, rest = splitNull(rest[2:]) // language tag
+	_, text := splitNull(rest)    // translated keyword
+	if compressed {
+		inflated, err := inflate(text)
+		return keyword, inflated, err
+	}
+	return keyword, text, nil
+}
+
+// splitNull splits data at the first null byte
+func splitNull(data []byte) (string, []byte) {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return string(data), nil
+	}
+	return string(data[:i]), data[i+1:]
+}
+
+// inflate decompresses the zlib data of a chunk, text and profiles larger than cPNGMaxChunkSize are rejected
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	inflated, err := readAllLimited(reader, cPNGMaxChunkSize+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(inflated) > cPNGMaxChunkSize {
+		return nil, &exifError{fmt.Sprintf("inflated data is larger than %d bytes", cPNGMaxChunkSize)}
+	}
+	return inflated, nil
+}
+
+func latin1ToUTF8(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
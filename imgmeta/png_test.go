@@ -0,0 +1,103 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func samplePng() []byte {
+	buf := bytes.Buffer{}
+	Expect(png.Encode(&buf, image.NewGray(image.Rect(0, 0, 30, 20)))).Should(Succeed())
+	data := buf.Bytes()
+
+	chunks := [][]byte{
+		pngChunk("sRGB", []byte{0}),
+		pngChunk("iCCP", append([]byte("sRGB profile\x00\x00"), deflate([]byte("profile"))...)),
+		pngChunk("tEXt", []byte("Title\x00Gr\xfc\xdfe")),
+		pngChunk("zTXt", append([]byte("Comment\x00\x00"), deflate([]byte("compressed"))...)),
+		pngChunk("iTXt", []byte("Author\x00\x00\x00de\x00Autor\x00Jürgen")),
+		pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), testXMP...)),
+		pngChunk("eXIf", tiffWithOrientation(8)),
+	}
+	out := append([]byte{}, data[:33]...) // signature and IHDR
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[33:]...)
+}
+
+var _ = Describe("PNG", func() {
+
+	It("should read the header, text chunks, EXIF and XMP", func() {
+		image, err := Decode(bytes.NewReader(samplePng()))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("png"))
+
+		Expect(image.ReadTagValue("PNG", PNGImageWidth)).Should(Equal(uint32(30)))
+		Expect(image.ReadTagValue("PNG", PNGBitDepth)).Should(Equal(uint8(8)))
+		Expect(image.ReadPropertyValue("PNG", "SRGBRenderingIntent")).Should(Equal(uint8(0)))
+		Expect(image.ReadPropertyValue("PNG", "ICCProfileName")).Should(Equal("sRGB profile"))
+		Expect(image.ReadPropertyValue("PNG", "Title")).Should(Equal("Grüße"))
+		Expect(image.ReadPropertyValue("PNG", "Comment")).Should(Equal("compressed"))
+		Expect(image.ReadPropertyValue("PNG", "Author")).Should(Equal("Jürgen"))
+
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+		Expect(image.ReadPropertyValue("XMP", "dc:subject")).Should(Equal([]string{"wall", "test"}))
+		Expect(image.ReadPropertyValue("XMP", "xmp:Rating")).Should(Equal("4"))
+
+		Expect(image.Orientation()).Should(Equal(uint16(8)))
+		width, height, err := image.DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{20, 30}))
+	})
+
+	It("should reject truncated chunks and skip oversized ones", func() {
+		data := samplePng()
+		iend := bytes.Index(data, []byte("IEND")) - 4
+
+		// a tEXt chunk that claims more data than the file has
+		truncated := append(append([]byte{}, data[:33]...), pngChunk("tEXt", []byte("Title\x00Text"))[:12]...)
+		_, err := Decode(bytes.NewReader(truncated))
+		Expect(err).ShouldNot(BeNil())
+
+		// a length of 0xFFFFFFFF is neither allocated nor read
+		invalid := append(append([]byte{}, data[:33]...), 0xFF, 0xFF, 0xFF, 0xFF, 't', 'E', 'X', 't')
+		_, err = Decode(bytes.NewReader(append(invalid, data[33:]...)))
+		Expect(err).ShouldNot(BeNil())
+
+		// a text chunk above the limit is skipped, the rest of the PNG is read
+		large := append(append([]byte{}, data[:iend]...), pngChunk("tEXt", append([]byte("Large\x00"), make([]byte, 16<<20)...))...)
+		image, err := Decode(bytes.NewReader(append(large, data[iend:]...)))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("PNG", "Title")).Should(Equal("Grüße"))
+		_, err = image.ReadPropertyValue("PNG", "Large")
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should skip an eXIf chunk that is too short for a TIFF header", func() {
+		data := samplePng()
+		iend := bytes.Index(data, []byte("IEND")) - 4
+		short := append(append([]byte{}, data[:33]...), pngChunk("eXIf", []byte("MM\x00*"))...)
+		image, err := Decode(bytes.NewReader(append(short, data[iend:]...)))
+		Expect(err).Should(BeNil())
+		Expect(image.Orientation()).Should(Equal(uint16(1)))
+		Expect(image.Summary().Width).ShouldNot(BeNil())
+		Expect(image.Metadata().DateTimeOriginal).Should(BeNil())
+	})
+
+	It("should skip compressed text that inflates to more than the chunk limit", func() {
+		data := samplePng()
+		iend := bytes.Index(data, []byte("IEND")) - 4
+		bomb := pngChunk("zTXt", append([]byte("Bomb\x00\x00"), deflate(make([]byte, 16<<20+1))...))
+		image, err := Decode(bytes.NewReader(append(append(append([]byte{}, data[:33]...), bomb...), data[iend:]...)))
+		Expect(err).Should(BeNil())
+		_, err = image.ReadPropertyValue("PNG", "Bomb")
+		Expect(err).ShouldNot(BeNil())
+	})
+
+})
@@ -0,0 +1,226 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Embedded previews
+
+Most RAW files carry JPEG images for cameras and viewers that can not decode the raw data: a small thumbnail,
+often a medium preview and usually a full size JPEG. They are stored as
+
+    TIFF based   JPEGInterchangeFormat/Length of an IFD, or a JPEG compressed strip (CR2, DNG)
+    RW2          JpgFromRaw (0x002E) in IFD0
+    CR3          the first sample of a track and the PRVW uuid box
+
+The largest of them is the preview. The JPEGs usually have no EXIF data of their own, so the orientation and
+the key tags of the RAW file (camera, exposure, dates, lens, GPS) and its XMP packet are written into the preview.
+
+*/
+
+// Preview is a JPEG embedded in another image, usually a RAW file
+type Preview struct {
+	Data   []byte // JPEG file
+	Width  uint32
+	Height uint32
+}
+
+// tByteRange is the position of data in a file
+type tByteRange struct {
+	offset int64
+	length int64
+}
+
+// tPreviewer is implemented by sections that know the positions of embedded JPEGs
+type tPreviewer interface {
+	previewRanges() []tByteRange
+}
+
+const cMaxPreviewSize = 64 << 20
+
+// aPreviewTags are the tags that are copied into a preview, by IFD
+var aPreviewTags = map[uint16][]uint16{
+	cIFDZERO: {
+		ExifTagImageDescription, ExifTagMake, ExifTagModel, ExifTagOrientation, ExifTagSoftware, ExifTagDateTime,
+		ExifTagArtist, ExifTagCopyright,
+	},
+	cIFDEXIF: {
+		ExifTagExposureTime, ExifTagFNumber, ExifTagExposureProgram, ExifTagPhotographicSensitivity,
+		ExifTagDateTimeOriginal, ExifTagDateTimeDigitized, ExifTagSubsecTimeOriginal, ExifTagExposureBiasValue,
+		ExifTagMeteringMode, ExifTagFlash, ExifTagFocalLength, ExifTagFocalLengthIn35mmFilm, ExifTagBodySerialNumber,
+		ExifTagLensSpecification, ExifTagLensMake, ExifTagLensModel,
+	},
+}
+
+// OpenPreview opens the file at path and returns its largest embedded JPEG, see DecodePreview
+func OpenPreview(path string) (Preview, error) {
+	fhnd, err := os.Open(path)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer fhnd.Close()
+
+	return DecodePreview(fhnd)
+}
+
+// DecodePreview returns the largest JPEG embedded in the image in r. The orientation and the key
+// metadata of the image are written into the JPEG.
+func DecodePreview(r io.ReadSeeker) (Preview, error) {
+	image, err := Decode(r)
+	if err != nil {
+		return Preview{}, err
+	}
+	return image.Preview(r)
+}
+
+// Preview returns the largest JPEG embedded in the image, which was decoded from r, see DecodePreview.
+// Unlike DecodePreview, it reads only the embedded JPEGs from r and does not decode the image again.
+func (i Image) Preview(r io.ReadSeeker) (Preview, error) {
+	best := Preview{}
+	for _, app := range i.apps {
+		previewer, ok := app.(tPreviewer)
+		if !ok {
+			continue
+		}
+		for _, rng := range previewer.previewRanges() {
+			data, ok := readJpegRange(r, rng)
+			if !ok {
+				continue
+			}
+			width, height, ok := jpegSize(data)
+			if ok && uint64(width)*uint64(height) > uint64(best.Width)*uint64(best.Height) {
+				best = Preview{Data: data, Width: width, Height: height}
+			}
+		}
+	}
+	if best.Data == nil {
+		return best, &exifError{fmt.Sprintf("%s has no embedded JPEG", i.format)}
+	}
+
+	best.Data = withMetadata(best.Data, i)
+	return best, nil
+}
+
+// readJpegRange reads a byte range, if it starts with a JPEG SOI marker
+func readJpegRange(r io.ReadSeeker, rng tByteRange) ([]byte, bool) {
+	if rng.offset <= 0 || rng.length < 4 || rng.length > cMaxPreviewSize {
+		return nil, false
+	}
+	if _, err := r.Seek(rng.offset, io.SeekStart); err != nil {
+		return nil, false
+	}
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil || binary.BigEndian.Uint16(soi) != cSOI {
+		return nil, false
+	}
+	data := make([]byte, rng.length)
+	copy(data, soi)
+	if _, err := io.ReadFull(r, data[2:]); err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// jpegSize returns the size of a baseline or progressive JPEG, lossless JPEGs (raw data of DNG) are skipped
+func jpegSize(data []byte) (uint32, uint32, bool) {
+	image, err := decodeJpeg(bytes.NewReader(data))
+	if err != nil && len(image.apps) == 0 {
+		return 0, 0, false
+	}
+	if image.HasSection("SOF3") {
+		return 0, 0, false
+	}
+	width, height, err := image.Dimensions()
+	return width, height, err == nil
+}
+
+// withMetadata writes the key EXIF tags and the XMP packet of image into the APP1 segments of jpeg,
+// replacing the ones the JPEG has
+func withMetadata(jpeg []byte, image Image) []byte {
+	segments := [][]byte{}
+
+	if exif, ok := image.apps["EXIF"].(tRawExif); ok {
+		entries := map[uint16][]tExifEntry{}
+		var endian binary.ByteOrder
+		for ifdType, tags := range aPreviewTags {
+			for _, id := range tags {
+				if entry, ok := exif.rawTag(id, ifdType); ok {
+					entries[ifdType] = append(entries[ifdType], entry)
+					endian = entry.endian
+				}
+			}
+		}
+		for id := uint16(0); id <= ExifGpsTagGPSHPositioningError; id++ {
+			if entry, ok := exif.rawTag(id, cIFDGPS); ok {
+				entries[cIFDGPS] = append(entries[cIFDGPS], entry)
+				endian = entry.endian
+			}
+		}
+
+		if endian != nil {
+			editor := &ExifEditor{endian: endian, ifds: entries}
+			tiff, err := editor.Encode()
+			segment, ok := appSegment(cEXIF, append(append([]byte{}, idEXIF...), tiff...))
+			if err != nil || !ok {
+				log.Warn("EXIF data of the preview is too large")
+			} else {
+				segments = append(segments, segment)
+			}
+		}
+	}
+
+	if xmp, ok := image.apps["XMP"].(*tXMPAPP); ok {
+		if segment, ok := appSegment(cEXIF, append(append([]byte{}, idXMP...), xmp.xmp.Packet()...)); ok {
+			segments = append(segments, segment)
+		} else {
+			log.Warn("XMP packet of the preview is too large")
+		}
+	}
+
+	if len(segments) == 0 {
+		return jpeg
+	}
+	out := append([]byte{}, jpeg[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, withoutAPP1(jpeg[2:])...)
+}
+
+// appSegment returns a segment with marker and length, if the payload fits into it
+func appSegment(marker uint16, payload []byte) ([]byte, bool) {
+	if len(payload)+2 > 0xFFFF {
+		return nil, false
+	}
+	segment := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint16(segment, marker)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...), true
+}
+
+// withoutAPP1 removes the APP1 segments of the JPEG data after SOI, everything from SOS on is kept as it is
+func withoutAPP1(data []byte) []byte {
+	out := []byte{}
+	for len(data) >= 4 && data[0] == 0xFF {
+		marker := binary.BigEndian.Uint16(data)
+		if marker == cSOS || marker == cEOI {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[2:])) + 2
+		if length > len(data) {
+			break
+		}
+		if marker != cEXIF {
+			out = append(out, data[:length]...)
+		}
+		data = data[length:]
+	}
+	return append(out, data...)
+}
@@ -0,0 +1,86 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// encodeJpeg returns a gray JPEG of the given size
+func encodeJpeg(width, height int) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.Gray{Y: uint8(x + y)})
+		}
+	}
+	buf := &bytes.Buffer{}
+	jpeg.Encode(buf, img, nil)
+	return buf.Bytes()
+}
+
+// sampleCR2WithPreviews returns a CR2 with a full size JPEG in the strip of IFD0 and a thumbnail in IFD1
+func sampleCR2WithPreviews(full, thumb []byte) []byte {
+	build := func(fullOffset, thumbOffset uint32) []byte {
+		return buildRawTiff(binary.LittleEndian, 42, []byte{'C', 'R', 2, 0, 0, 0, 0, 0}, []testIFD{
+			{tags: map[uint16]interface{}{
+				ExifTagCompression:     []uint16{6},
+				ExifTagStripOffsets:    []uint32{fullOffset},
+				ExifTagStripByteCounts: []uint32{uint32(len(full))},
+				ExifTagOrientation:     []uint16{6},
+				ExifTagMake:            "Canon",
+				0x8769:                 testIFDRef(2),
+			}, next: 1},
+			{tags: map[uint16]interface{}{
+				ExifTagJPEGInterchangeFormat:       []uint32{thumbOffset},
+				ExifTagJPEGInterchangeFormatLength: []uint32{uint32(len(thumb))},
+			}},
+			{tags: map[uint16]interface{}{ExifTagPhotographicSensitivity: []uint16{1600}}},
+		})
+	}
+
+	size := uint32(len(build(0, 0)))
+	data := build(size, size+uint32(len(full)))
+	return append(append(data, full...), thumb...)
+}
+
+var _ = Describe("Preview", func() {
+
+	It("should extract the largest JPEG of a RAW file with its metadata", func() {
+		data := sampleCR2WithPreviews(encodeJpeg(96, 64), encodeJpeg(24, 16))
+		raw, err := Decode(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(raw.IsRaw()).Should(BeTrue())
+
+		preview, err := DecodePreview(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect([]uint32{preview.Width, preview.Height}).Should(Equal([]uint32{96, 64}))
+
+		image, err := Decode(bytes.NewReader(preview.Data))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("jpeg"))
+		Expect(image.Orientation()).Should(Equal(uint16(6)))
+		Expect(image.ReadTagValue("EXIF", ExifTagMake)).Should(Equal("Canon"))
+		Expect(image.ReadTagValue("EXIF", ExifTagPhotographicSensitivity)).Should(Equal(uint16(1600)))
+
+		_, err = jpeg.Decode(bytes.NewReader(preview.Data))
+		Expect(err).Should(BeNil())
+
+		// the decoded RAW file gives the same preview
+		again, err := raw.Preview(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(again).Should(Equal(preview))
+	})
+
+	It("should fail for images without an embedded JPEG", func() {
+		_, err := DecodePreview(bytes.NewReader(sampleDng()))
+		Expect(err).ShouldNot(BeNil())
+	})
+
+})
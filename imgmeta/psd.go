@@ -0,0 +1,209 @@
+package imgmeta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of a Photoshop file (PSD and PSB)
+
+    [Record name]        [size]     [description]
+    ---------------------------------------
+    Signature            4 bytes    "8BPS"
+    Version              2 bytes    1 for PSD, 2 for PSB (large document format)
+    Reserved             6 bytes
+    Channels             2 bytes    number of channels, including alpha channels
+    Height               4 bytes
+    Width                4 bytes
+    Depth                2 bytes    bits per channel: 1, 8, 16 or 32
+    Color mode           2 bytes    see aPSDColorModes
+    Color mode data      4 + n      palette of indexed and duotone images
+    Image resources      4 + n      resource data blocks, the same as in a JPEG APP13 segment (see iptc.go)
+    Layer and mask info  4 + n      8 + n in PSB
+    Image data             ...
+
+All values are big-endian. The layer and mask information starts with the layer info:
+
+    Length               4 bytes    8 bytes in PSB
+    Layer count          2 bytes    a negative count means that the first alpha channel is the merged transparency
+
+The image resources hold the metadata:
+
+    0x0404   IPTC-NAA records
+    0x040C   thumbnail: format (4), width (4), height (4), row bytes (4), size (4), compressed size (4),
+             bits per pixel (2), planes (2), followed by a JFIF file
+    0x040F   ICC profile
+    0x0422   EXIF data, a TIFF structure
+    0x0424   XMP packet
+
+*/
+
+func init() {
+	RegisterFormat("psd", "8BPS\x00\x01", DecoderFunc(decodePsd))
+	RegisterFormat("psb", "8BPS\x00\x02", DecoderFunc(decodePsd))
+}
+
+// Tags of the PSD section
+const (
+	PSDImageWidth    uint16 = 0x0001
+	PSDImageHeight   uint16 = 0x0002
+	PSDChannels      uint16 = 0x0003
+	PSDBitDepth      uint16 = 0x0004
+	PSDColorMode     uint16 = 0x0005
+	PSDColorModeName uint16 = 0x0006
+	PSDLayerCount    uint16 = 0x0007
+	PSDICCProfile    uint16 = 0x0012
+	PSDThumbnail     uint16 = 0x0013
+)
+
+var aPSDTagNames = map[string]uint16{
+	"ImageWidth":    PSDImageWidth,
+	"ImageHeight":   PSDImageHeight,
+	"Channels":      PSDChannels,
+	"BitDepth":      PSDBitDepth,
+	"ColorMode":     PSDColorMode,
+	"ColorModeName": PSDColorModeName,
+	"LayerCount":    PSDLayerCount,
+	"ICCProfile":    PSDICCProfile,
+	"Thumbnail":     PSDThumbnail,
+}
+
+var aPSDColorModes = map[uint16]string{
+	0: "Bitmap",
+	1: "Grayscale",
+	2: "Indexed",
+	3: "RGB",
+	4: "CMYK",
+	7: "Multichannel",
+	8: "Duotone",
+	9: "Lab",
+}
+
+const (
+	cPSDHeaderSize        = 26
+	cPSDMaxResourcesSize  = 64 << 20
+	cPSDThumbnailHeader   = 28
+	cPSDThumbnailJPEG     = 1
+	cPSDLargeDocumentType = 2
+)
+
+// tPSDAPP holds the header values, the layer count, the ICC profile and the thumbnail of a PSD
+type tPSDAPP struct {
+	tValuesAPP
+}
+
+func decodePsd(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "psd"}
+
+	header := make([]byte, cPSDHeaderSize)
+	if _, err = io.ReadFull(r, header); err != nil || string(header[:4]) != "8BPS" {
+		return image, &exifError{"Wrong format"}
+	}
+	large := binary.BigEndian.Uint16(header[4:]) == cPSDLargeDocumentType
+	if large {
+		image.format = "psb"
+	}
+	mode := binary.BigEndian.Uint16(header[24:])
+	psd := &tPSDAPP{tValuesAPP: tValuesAPP{name: "PSD", names: aPSDTagNames, values: map[uint16]interface{}{
+		PSDChannels:    binary.BigEndian.Uint16(header[12:]),
+		PSDImageHeight: binary.BigEndian.Uint32(header[14:]),
+		PSDImageWidth:  binary.BigEndian.Uint32(header[18:]),
+		PSDBitDepth:    binary.BigEndian.Uint16(header[22:]),
+		PSDColorMode:   mode,
+	}}}
+	if name, ok := aPSDColorModes[mode]; ok {
+		psd.values[PSDColorModeName] = name
+	}
+	image.apps[psd.Name()] = psd
+
+	// colour mode data
+	length, err := readPSDLength(r, false)
+	if err != nil {
+		return image, err
+	}
+	if _, err = r.Seek(int64(length), io.SeekCurrent); err != nil {
+		return image, err
+	}
+
+	// image resources
+	if length, err = readPSDLength(r, false); err != nil {
+		return image, err
+	}
+	if length > cPSDMaxResourcesSize {
+		return image, &exifError{fmt.Sprintf("PSD image resources are too large (%d bytes)", length)}
+	}
+	resources := make([]byte, length)
+	if _, err = io.ReadFull(r, resources); err != nil {
+		return image, &exifError{"PSD image resources are truncated"}
+	}
+	psd.readResources(&image, resources)
+
+	// layer and mask information
+	if length, err = readPSDLength(r, large); err != nil || length == 0 {
+		psd.values[PSDLayerCount] = 0
+		return image, nil
+	}
+	if length, err = readPSDLength(r, large); err != nil || length < 2 {
+		psd.values[PSDLayerCount] = 0
+		return image, nil
+	}
+	count := make([]byte, 2)
+	if _, err = io.ReadFull(r, count); err != nil {
+		log.Warn("PSD layer info is truncated")
+		return image, nil
+	}
+	layers := int(int16(binary.BigEndian.Uint16(count)))
+	if layers < 0 {
+		layers = -layers
+	}
+	psd.values[PSDLayerCount] = layers
+	return image, nil
+}
+
+// readResources reads the image resources with metadata into the sections of image
+func (t *tPSDAPP) readResources(image *Image, resources []byte) {
+	blocks := readResources(resources)
+
+	if _, ok := blocks[c8BIMIPTC]; ok {
+		iptc := newIPTCAPP(resources)
+		image.apps[iptc.Name()] = iptc
+	}
+	if tiff, ok := blocks[c8BIMExif]; ok && len(tiff) >= 8 {
+		exif := newExifAPP(tiff)
+		image.apps[exif.Name()] = exif
+	}
+	if packet, ok := blocks[c8BIMXMP]; ok {
+		xmp, err := newXMPAPP(packet, packet)
+		if err != nil {
+			log.Warn(err.Error())
+		}
+		image.apps[xmp.Name()] = xmp
+	}
+	if profile, ok := blocks[c8BIMICCProfile]; ok {
+		t.values[PSDICCProfile] = profile
+	}
+	if thumbnail, ok := blocks[c8BIMThumbnail]; ok && len(thumbnail) > cPSDThumbnailHeader {
+		if binary.BigEndian.Uint32(thumbnail) == cPSDThumbnailJPEG {
+			t.values[PSDThumbnail] = thumbnail[cPSDThumbnailHeader:]
+		}
+	}
+}
+
+// readPSDLength reads the length of a section, 8 bytes long in PSB if large is set
+func readPSDLength(r io.Reader, large bool) (uint64, error) {
+	data := make([]byte, 8)
+	if !large {
+		data = data[:4]
+	}
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, &exifError{"PSD is truncated"}
+	}
+	if large {
+		return binary.BigEndian.Uint64(data), nil
+	}
+	return uint64(binary.BigEndian.Uint32(data)), nil
+}
@@ -0,0 +1,53 @@
+package imgmeta_test
+
+import (
+	"bytes"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// samplePsd returns an 8 bit RGB PSD of 300x200 pixels with three layers and IPTC, EXIF, XMP, ICC and thumbnail resources
+func samplePsd(version uint16) []byte {
+	thumbnail := append(append(u32(1), make([]byte, 24)...), 0xff, 0xd8, 0xff, 0xd9)
+	resources := append(resource(0x03ED, make([]byte, 16)), resource(0x0404, dataset(2, 5, "The Wall"))...)
+	resources = append(resources, resource(0x040C, thumbnail)...)
+	resources = append(resources, resource(0x040F, []byte("icc profile"))...)
+	resources = append(resources, resource(0x0422, tiffWithOrientation(6))...)
+	resources = append(resources, resource(0x0424, []byte(testXMP))...)
+
+	layerInfo := append(u16(0xFFFD), make([]byte, 10)...) // -3 layers
+	return psdFile(version, 4, 300, 200, resources, layerInfo)
+}
+
+var _ = Describe("PSD", func() {
+
+	It("should read the header, the layers and the image resources", func() {
+		image, err := Decode(bytes.NewReader(samplePsd(1)))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("psd"))
+
+		Expect(image.ReadPropertyValue("PSD", "ColorModeName")).Should(Equal("RGB"))
+		Expect(image.ReadPropertyValue("PSD", "BitDepth")).Should(Equal(uint16(8)))
+		Expect(image.ReadPropertyValue("PSD", "Channels")).Should(Equal(uint16(4)))
+		Expect(image.ReadPropertyValue("PSD", "LayerCount")).Should(Equal(3))
+		Expect(image.ReadTagValue("PSD", PSDICCProfile)).Should(Equal([]byte("icc profile")))
+		Expect(image.ReadTagValue("PSD", PSDThumbnail)).Should(Equal([]byte{0xff, 0xd8, 0xff, 0xd9}))
+		Expect(image.HasSection("IPTC")).Should(BeTrue())
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+		Expect(image.Orientation()).Should(Equal(uint16(6)))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{300, 200}))
+	})
+
+	It("should read the 8 byte lengths of a PSB", func() {
+		image, err := Decode(bytes.NewReader(samplePsd(2)))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("psb"))
+		Expect(image.ReadPropertyValue("PSD", "LayerCount")).Should(Equal(3))
+	})
+
+})
@@ -0,0 +1,410 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Camera RAW formats
+
+Most RAW formats are TIFF files (see tiff.go) with some vendor specific quirks:
+
+    [Format]  [header]           [quirks]
+    ---------------------------------------
+    CR2       "II*\000" + "CR\002" IFD0 is a full size JPEG, IFD3 the raw data without a size. The sensor size
+                                 and the cropped image area are stored in SensorInfo (0x00E0) of the Canon MakerNote
+    NEF       "MM\000*"           IFD0 is a thumbnail, the raw data is a SubIFD (CFA, NewSubfileType 0)
+    ARW       "II*\000"           like NEF
+    ORF       "IIRO", "IIRS"     signature is "RO" or "RS" instead of 42, IFD0 holds the raw data
+    RW2       "IIU\000"           signature is 0x55, IFD0 holds the raw data with the sensor size and borders in
+                                 Panasonic tags (0x0002-0x0007) instead of ImageWidth/ImageLength. The EXIF data
+                                 is only stored in the embedded JPEG (JpgFromRaw, 0x002E)
+
+CR3 is based on the ISO base media file format (see bmff.go) with the brand "crx ". The metadata is stored as
+TIFF structures in boxes of a Canon uuid box inside the moov box:
+
+    moov
+      uuid   85c0b687-820f-11e0-8111-f4ce462b6a48
+        CMT1   TIFF with IFD0
+        CMT2   TIFF with the Exif IFD
+        CMT3   TIFF with the Canon MakerNote
+        CMT4   TIFF with the GPS IFD
+      trak   one per image, the sample entry "CRAW" has the size of the image
+    uuid   be7acfcb-97a9-42e8-9c71-999491e3afac, XMP packet
+    uuid   eaf42b5e-1c98-4b88-b9fb-b7dc406e4d16, preview JPEG (PRVW)
+
+*/
+
+const (
+	cPhotometricCFA  = 32803
+	cCanonSensorInfo = 0x00E0
+	cPanasonicWidth  = 0x0002 // SensorWidth, followed by SensorHeight and the top, left, bottom and right border
+	cPanasonicJpeg   = 0x002E // JpgFromRaw
+)
+
+const (
+	idCR3Canon   = "85c0b687820f11e08111f4ce462b6a48"
+	idCR3XMP     = "be7acfcb97a942e89c71999491e3afac"
+	idCR3Preview = "eaf42b5e1c984b88b9fbb7dc406e4d16"
+)
+
+func init() {
+	RegisterFormat("orf", "IIRO", DecoderFunc(decodeTiff))
+	RegisterFormat("orf", "IIRS", DecoderFunc(decodeTiff))
+	RegisterFormat("orf", "MMOR", DecoderFunc(decodeTiff))
+	RegisterFormat("rw2", "IIU\x00", DecoderFunc(decodeTiff))
+	RegisterFormat("cr3", "????ftypcrx ", DecoderFunc(decodeCR3))
+}
+
+// aRawFormats are the formats that are camera RAW files
+var aRawFormats = map[string]bool{"cr2": true, "cr3": true, "nef": true, "arw": true, "orf": true, "rw2": true, "dng": true}
+
+// IsRaw returns true if the image is a camera RAW file, e.g. CR2 or DNG
+func (i Image) IsRaw() bool {
+	return aRawFormats[i.format]
+}
+
+// tiffFormat names a TIFF file with the usual signature, e.g. "dng" or "nef"
+func tiffFormat(data []byte, tiff *tTIFFAPP) string {
+	ifd0 := tiff.ifd(0)
+	if _, ok := ifdValue(ifd0, ExifTagDNGVersion); ok {
+		return "dng"
+	}
+	if len(data) >= 11 && string(data[8:11]) == "CR\x02" {
+		return "cr2"
+	}
+
+	photometric, _ := ifdValue(tiff.ifd(tiff.main), ExifTagPhotometricInterpretation)
+	if photometric != uint16(cPhotometricCFA) {
+		return "tiff"
+	}
+	maker, _ := ifdValue(ifd0, ExifTagMake)
+	vendor, _ := maker.(string)
+	switch {
+	case strings.HasPrefix(strings.ToUpper(vendor), "NIKON"):
+		return "nef"
+	case strings.HasPrefix(strings.ToUpper(vendor), "SONY"):
+		return "arw"
+	}
+	return "tiff"
+}
+
+// applyRawQuirks reads the image and sensor size, and the EXIF data, that RAW formats store in their own way
+func applyRawQuirks(image *Image, tiff *tTIFFAPP) {
+	switch image.format {
+	case "cr2":
+		exifOffset, ok := ifdValue(tiff.ifd(0), cIFDEXIF)
+		if !ok {
+			return
+		}
+		offset, _ := toUint32(exifOffset)
+		exifIFD := tExifIFD{offset: offset, base: 0, appblock: tiff.data, endian: tiff.endian}
+		if !exifIFD.valid() {
+			return
+		}
+		makerNote, found := exifIFD.FindTag(ExifTagMakerNote)
+		if !found {
+			return
+		}
+		canon := tExifIFD{offset: makerNote.valueOrOffset(), base: 0, appblock: tiff.data, endian: tiff.endian}
+		if canon.valid() {
+			tiff.sensorWidth, tiff.sensorHeight, tiff.width, tiff.height = canonSensorInfo(canon)
+		}
+
+	case "rw2":
+		ifd0 := tiff.ifd(0)
+		values := make([]uint32, 6)
+		for i := range values {
+			value, _ := ifdValue(ifd0, cPanasonicWidth+uint16(i))
+			values[i], _ = toUint32(value)
+		}
+		tiff.sensorWidth, tiff.sensorHeight = values[0], values[1]
+		top, left, bottom, right := values[2], values[3], values[4], values[5]
+		if right > left && bottom > top {
+			tiff.width, tiff.height = right-left, bottom-top
+		}
+
+		if _, ok := ifdValue(ifd0, cIFDEXIF); ok {
+			return
+		}
+		value, ok := ifdValue(ifd0, cPanasonicJpeg)
+		jpeg, _ := value.([]byte)
+		if !ok || len(jpeg) == 0 {
+			return
+		}
+		embedded, err := decodeJpeg(bytes.NewReader(jpeg))
+		if err != nil {
+			log.Warn(fmt.Sprintf("RW2 JpgFromRaw: %v", err))
+		}
+		if exif, ok := embedded.apps["EXIF"]; ok {
+			image.apps["EXIF"] = exif
+		}
+	}
+}
+
+// canonSensorInfo reads the sensor size and the cropped image size from SensorInfo of a Canon MakerNote
+func canonSensorInfo(makerNote tExifIFD) (sensorWidth, sensorHeight, width, height uint32) {
+	value, ok := ifdValue(makerNote, cCanonSensorInfo)
+	info, _ := value.([]uint16)
+	if !ok || len(info) < 9 {
+		return
+	}
+	sensorWidth, sensorHeight = uint32(info[1]), uint32(info[2])
+	left, top, right, bottom := uint32(info[5]), uint32(info[6]), uint32(info[7]), uint32(info[8])
+	if right > left && bottom > top {
+		width, height = right-left+1, bottom-top+1
+	}
+	return
+}
+
+// tExifSetAPP joins EXIF structures that are stored separately, like the CMT boxes of CR3.
+// A tag is searched in the structures in the given order.
+type tExifSetAPP []tExifSetMember
+
+// tExifSetMember is a TIFF structure whose IFD0 is an IFD of the type ifdType, e.g. cIFDGPS
+type tExifSetMember struct {
+	ifdType uint16
+	exif    *tEXIFAPP
+}
+
+func (t tExifSetAPP) Name() string {
+	return "EXIF"
+}
+func (t tExifSetAPP) Marker() uint16 {
+	return cEXIF
+}
+func (t tExifSetAPP) Length() uint16 {
+	return 0
+}
+func (t tExifSetAPP) ID(cid []byte) []byte {
+	return t[0].exif.ID(cid)
+}
+func (t tExifSetAPP) HasID(cid []byte) bool {
+	return t[0].exif.HasID(cid)
+}
+
+func (t tExifSetAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
+	for _, member := range t {
+		if value, err := member.exif.ReadValue(tagID2Find); err == nil {
+			return value, nil
+		}
+	}
+	return nil, &exifError{fmt.Sprintf("EXIF tag 0x%X not found", tagID2Find)}
+}
+
+func (t tExifSetAPP) rawTag(tagID uint16, ifdType uint16) (tExifEntry, bool) {
+	for _, member := range t {
+		if ifdType == cIFDANY {
+			if entry, ok := member.exif.rawTag(tagID, cIFDANY); ok {
+				return entry, true
+			}
+		} else if ifdType == member.ifdType {
+			if entry, ok := member.exif.rawTag(tagID, cIFDZERO); ok {
+				return entry, true
+			}
+		}
+	}
+	return tExifEntry{}, false
+}
+
+// Tags of the CR3 section
+const (
+	CR3ImageWidth   uint16 = 0x0001
+	CR3ImageHeight  uint16 = 0x0002
+	CR3SensorWidth  uint16 = 0x0003
+	CR3SensorHeight uint16 = 0x0004
+)
+
+var aCR3TagNames = map[string]uint16{
+	"ImageWidth":   CR3ImageWidth,
+	"ImageHeight":  CR3ImageHeight,
+	"SensorWidth":  CR3SensorWidth,
+	"SensorHeight": CR3SensorHeight,
+}
+
+// tCR3APP holds the image and sensor size of a CR3
+type tCR3APP struct {
+	tValuesAPP
+	previews []tByteRange // PRVW and the first sample of every track, in the file
+}
+
+func (t tCR3APP) previewRanges() []tByteRange {
+	return t.previews
+}
+
+// uuidBox returns the payload of a uuid box after the UUID, if the box has the given UUID (hex encoded)
+func uuidBox(box tBox, uuid string) ([]byte, bool) {
+	if box.boxType != "uuid" || len(box.data) < 16 || hex.EncodeToString(box.data[:16]) != uuid {
+		return nil, false
+	}
+	return box.data[16:], true
+}
+
+// crawSize returns the largest size of the CRAW sample entries of the tracks
+func crawSize(moov []tBox) (width, height uint32) {
+	for _, trak := range moov {
+		if trak.boxType != "trak" {
+			continue
+		}
+		stsd, ok := findBoxPath(readBoxes(trak.data), "mdia", "minf", "stbl", "stsd")
+		if !ok || len(stsd.data) < 8 {
+			continue
+		}
+		for _, entry := range readBoxes(stsd.data[8:]) {
+			// visual sample entry: reserved (6), data reference index (2), pre-defined and reserved (16), width (2), height (2)
+			if entry.boxType != "CRAW" || len(entry.data) < 28 {
+				continue
+			}
+			w := uint32(binary.BigEndian.Uint16(entry.data[24:]))
+			h := uint32(binary.BigEndian.Uint16(entry.data[26:]))
+			if w*h > width*height {
+				width, height = w, h
+			}
+		}
+	}
+	return
+}
+
+// firstSample returns the position of the first sample of a track in the file
+func firstSample(trak tBox) (tByteRange, bool) {
+	stbl, ok := findBoxPath(readBoxes(trak.data), "mdia", "minf", "stbl")
+	if !ok {
+		return tByteRange{}, false
+	}
+	children := readBoxes(stbl.data)
+
+	offset := int64(-1)
+	if co64, ok := findBox(children, "co64"); ok && len(co64.data) >= 16 {
+		offset = int64(binary.BigEndian.Uint64(co64.data[8:]))
+	} else if stco, ok := findBox(children, "stco"); ok && len(stco.data) >= 12 {
+		offset = int64(binary.BigEndian.Uint32(stco.data[8:]))
+	}
+	stsz, ok := findBox(children, "stsz")
+	if offset < 0 || !ok || len(stsz.data) < 12 {
+		return tByteRange{}, false
+	}
+	// version and flags (4), sample size (4, 0 if the sizes differ), sample count (4), sizes (4 each)
+	size := int64(binary.BigEndian.Uint32(stsz.data[4:]))
+	if size == 0 && len(stsz.data) >= 16 {
+		size = int64(binary.BigEndian.Uint32(stsz.data[12:]))
+	}
+	return tByteRange{offset: offset, length: size}, size > 0
+}
+
+// cr3Preview returns the position of the JPEG of a PRVW uuid box: unknown (8), followed by the PRVW box with
+// unknown (6), width (2), height (2), unknown (2), size of the JPEG (4) and the JPEG
+func cr3Preview(box tBox, payload []byte) (tByteRange, bool) {
+	if len(payload) < 8 {
+		return tByteRange{}, false
+	}
+	prvw, ok := findBox(readBoxes(payload[8:]), "PRVW")
+	if !ok || len(prvw.data) < 16 {
+		return tByteRange{}, false
+	}
+	offset := box.offset + 16 + 8 + prvw.offset + 16
+	return tByteRange{offset: offset, length: int64(binary.BigEndian.Uint32(prvw.data[12:]))}, true
+}
+
+func decodeCR3(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "cr3"}
+
+	boxes, err := readTopLevelBoxes(r, map[string]bool{"ftyp": true, "moov": true, "uuid": true}, cHEIFMaxItemSize)
+	if err != nil && len(boxes) == 0 {
+		return image, err
+	}
+	moovBox, ok := findBox(boxes, "moov")
+	if !ok || moovBox.data == nil {
+		return image, &exifError{"CR3 has no moov box"}
+	}
+	moov := readBoxes(moovBox.data)
+
+	cr3 := &tCR3APP{tValuesAPP: tValuesAPP{name: "CR3", names: aCR3TagNames, values: map[uint16]interface{}{}}}
+	for _, box := range moov {
+		payload, ok := uuidBox(box, idCR3Canon)
+		if !ok {
+			continue
+		}
+		cmt := map[string][]byte{}
+		for _, child := range readBoxes(payload) {
+			if strings.HasPrefix(child.boxType, "CMT") && len(child.data) >= 8 {
+				cmt[child.boxType] = child.data
+			}
+		}
+
+		exif := tExifSetAPP{}
+		for _, member := range []struct {
+			name    string
+			ifdType uint16
+		}{{"CMT1", cIFDZERO}, {"CMT2", cIFDEXIF}, {"CMT4", cIFDGPS}} {
+			if tiff, ok := cmt[member.name]; ok {
+				exif = append(exif, tExifSetMember{ifdType: member.ifdType, exif: newExifAPP(tiff)})
+			}
+		}
+		if len(exif) > 0 {
+			image.apps[exif.Name()] = exif
+		}
+
+		if makerNote, ok := cmt["CMT3"]; ok {
+			canon := newTIFFAPP(makerNote, tiffByteOrder(makerNote))
+			if len(canon.ifds) > 0 {
+				sensorWidth, sensorHeight, width, height := canonSensorInfo(canon.ifd(0))
+				if sensorWidth > 0 && sensorHeight > 0 {
+					cr3.values[CR3SensorWidth], cr3.values[CR3SensorHeight] = sensorWidth, sensorHeight
+				}
+				if width > 0 && height > 0 {
+					cr3.values[CR3ImageWidth], cr3.values[CR3ImageHeight] = width, height
+				}
+			}
+		}
+	}
+
+	if _, _, ok := cr3.size(); !ok {
+		if width, height := crawSize(moov); width > 0 && height > 0 {
+			cr3.values[CR3ImageWidth], cr3.values[CR3ImageHeight] = width, height
+		}
+	}
+	if _, ok := cr3.values[CR3SensorWidth]; !ok {
+		if width, height, ok := cr3.size(); ok {
+			cr3.values[CR3SensorWidth], cr3.values[CR3SensorHeight] = width, height
+		}
+	}
+	for _, trak := range moov {
+		if trak.boxType != "trak" {
+			continue
+		}
+		if sample, ok := firstSample(trak); ok {
+			cr3.previews = append(cr3.previews, sample)
+		}
+	}
+	image.apps[cr3.Name()] = cr3
+
+	for _, box := range boxes {
+		if packet, ok := uuidBox(box, idCR3XMP); ok {
+			xmp, err := newXMPAPP(packet, packet)
+			if err != nil {
+				log.Warn(err.Error())
+			}
+			image.apps[xmp.Name()] = xmp
+		} else if payload, ok := uuidBox(box, idCR3Preview); ok {
+			if preview, ok := cr3Preview(box, payload); ok {
+				cr3.previews = append(cr3.previews, preview)
+			}
+		}
+	}
+	return image, nil
+}
+
+// tiffByteOrder returns the byte order of a TIFF structure
+func tiffByteOrder(data []byte) binary.ByteOrder {
+	if len(data) >= 2 && binary.BigEndian.Uint16(data) == cINTEL {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
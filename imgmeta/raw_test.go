@@ -0,0 +1,158 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func uuid(id string, payload ...[]byte) []byte {
+	raw, _ := hex.DecodeString(id)
+	return box("uuid", append([][]byte{raw}, payload...)...)
+}
+
+func sampleCR3() []byte {
+	cmt1 := buildTiff(binary.LittleEndian, []testIFD{{tags: map[uint16]interface{}{ExifTagMake: "Canon", ExifTagModel: "Canon EOS R5"}}})
+	cmt2 := buildTiff(binary.LittleEndian, []testIFD{{tags: map[uint16]interface{}{
+		ExifTagPhotographicSensitivity: []uint16{800},
+		ExifTagDateTimeOriginal:        "2021:06:01 12:00:00",
+	}}})
+	cmt3 := buildTiff(binary.LittleEndian, []testIFD{{tags: map[uint16]interface{}{
+		0x00E0: []uint16{34, 8352, 5586, 1, 1, 156, 112, 8347, 5575, 0, 0, 0, 0, 0, 0, 0, 0},
+	}}})
+	craw := append(make([]byte, 24), u16(8192)...)
+	craw = append(craw, u16(5464)...)
+
+	return append(append(box("ftyp", []byte("crx "), u32(1), []byte("crx isom")),
+		box("moov",
+			uuid("85c0b687820f11e08111f4ce462b6a48",
+				box("CNCV", []byte("CanonCR3_001/00.10.00/00.00.00")),
+				box("CMT1", cmt1), box("CMT2", cmt2), box("CMT3", cmt3)),
+			box("trak", box("mdia", box("minf", box("stbl", box("stsd", []byte{0, 0, 0, 0}, u32(1), box("CRAW", craw)))))),
+		)...),
+		uuid("be7acfcb97a942e89c71999491e3afac", []byte(testXMP))...)
+}
+
+var _ = Describe("Camera RAW", func() {
+
+	It("should read the sensor size of a CR2 from the Canon MakerNote", func() {
+		data := buildRawTiff(binary.LittleEndian, 42, []byte{'C', 'R', 2, 0, 0, 0, 0, 0}, []testIFD{
+			{tags: map[uint16]interface{}{
+				ExifTagImageWidth:  []uint16{5472},
+				ExifTagImageHeight: []uint16{3648},
+				ExifTagMake:        "Canon",
+				0x8769:             testIFDRef(1),
+			}},
+			{tags: map[uint16]interface{}{
+				ExifTagPhotographicSensitivity: []uint16{200},
+				ExifTagMakerNote:               testIFDRef(2),
+			}},
+			{tags: map[uint16]interface{}{
+				0x00E0: []uint16{34, 5568, 3708, 1, 1, 84, 50, 5555, 3697, 0, 0, 0, 0, 0, 0, 0, 0},
+			}},
+		})
+
+		image, err := Decode(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("cr2"))
+		Expect(image.ReadTagValue("EXIF", ExifTagPhotographicSensitivity)).Should(Equal(uint16(200)))
+		Expect(image.ReadPropertyValue("TIFF", "SensorWidth")).Should(Equal(uint32(5568)))
+		Expect(image.ReadPropertyValue("TIFF", "SensorHeight")).Should(Equal(uint32(3708)))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{5472, 3648}))
+	})
+
+	It("should use the raw SubIFD of a NEF", func() {
+		data := buildTiff(binary.BigEndian, []testIFD{
+			{tags: map[uint16]interface{}{
+				ExifTagNewSubfileType: []uint32{1},
+				ExifTagImageWidth:     []uint32{160},
+				ExifTagImageHeight:    []uint32{120},
+				ExifTagMake:           "NIKON CORPORATION",
+				0x8769:                testIFDRef(3),
+			}, subIFDs: []int{1, 2}},
+			{tags: map[uint16]interface{}{ExifTagNewSubfileType: []uint32{1}, ExifTagImageWidth: []uint32{1620}, ExifTagImageHeight: []uint32{1080}}},
+			{tags: map[uint16]interface{}{
+				ExifTagNewSubfileType:            []uint32{0},
+				ExifTagImageWidth:                []uint32{6048},
+				ExifTagImageHeight:               []uint32{4032},
+				ExifTagPhotometricInterpretation: []uint16{32803},
+			}},
+			{tags: map[uint16]interface{}{ExifTagPhotographicSensitivity: []uint16{400}}},
+		})
+
+		image, err := Decode(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("nef"))
+		Expect(image.ReadTagValue("EXIF", ExifTagPhotographicSensitivity)).Should(Equal(uint16(400)))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{6048, 4032}))
+	})
+
+	It("should accept the signature of ORF", func() {
+		data := buildRawTiff(binary.LittleEndian, 0x4F52, nil, []testIFD{
+			{tags: map[uint16]interface{}{ExifTagImageWidth: []uint32{5240}, ExifTagImageHeight: []uint32{3912}, ExifTagMake: "OLYMPUS"}},
+		})
+		Expect(string(data[:4])).Should(Equal("IIRO"))
+
+		image, err := Decode(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("orf"))
+		Expect(image.ReadTagValue("TIFF", ExifTagImageWidth)).Should(Equal(uint32(5240)))
+	})
+
+	It("should read the borders and the embedded EXIF of RW2", func() {
+		tiff := tiffWithOrientation(8)
+		app1 := append([]byte{0xff, 0xe1, 0, byte(len(tiff) + 8)}, append([]byte("Exif\x00\x00"), tiff...)...)
+		jpeg := append(append([]byte{0xff, 0xd8}, app1...), 0xff, 0xd9)
+
+		data := buildRawTiff(binary.LittleEndian, 0x55, nil, []testIFD{
+			{tags: map[uint16]interface{}{
+				0x0002:      []uint16{5216},
+				0x0003:      []uint16{3928},
+				0x0004:      []uint16{4},
+				0x0005:      []uint16{8},
+				0x0006:      []uint16{3900},
+				0x0007:      []uint16{5208},
+				0x002E:      jpeg,
+				ExifTagMake: "Panasonic",
+			}},
+		})
+		Expect(string(data[:4])).Should(Equal("IIU\x00"))
+
+		image, err := Decode(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("rw2"))
+		Expect(image.Orientation()).Should(Equal(uint16(8)))
+		Expect(image.ReadPropertyValue("TIFF", "SensorWidth")).Should(Equal(uint32(5216)))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{5200, 3896}))
+	})
+
+	It("should read the CMT boxes of a CR3", func() {
+		image, err := Decode(bytes.NewReader(sampleCR3()))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("cr3"))
+
+		Expect(image.ReadTagValue("EXIF", ExifTagModel)).Should(Equal("Canon EOS R5"))
+		Expect(image.ReadTagValue("EXIF", ExifTagPhotographicSensitivity)).Should(Equal(uint16(800)))
+		Expect(image.ReadTagValue("EXIF", ExifTagDateTimeOriginal)).Should(Equal("2021:06:01 12:00:00"))
+		Expect(image.ReadPropertyValue("CR3", "SensorWidth")).Should(Equal(uint32(8352)))
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{8192, 5464}))
+	})
+
+})
@@ -12,7 +12,7 @@ type tSOFnAPP struct {
 }
 
 func (t tSOFnAPP) Name() string {
-	return fmt.Sprintf("SOF%01X", t.Marker()&0x0F)
+	return fmt.Sprintf("SOF%d", t.Marker()&0x0F)
 }
 func (t tSOFnAPP) Marker() uint16 {
 	return t.marker
@@ -27,21 +27,28 @@ func (t tSOFnAPP) HasID(cid []byte) bool {
 	return true
 }
 
+// ReadValue reads the frame header, which has the same layout for all SOFn segments
 func (t tSOFnAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
-	if t.Marker()&0x0F == 0 {
-		if tagID2Find == SOF0ImageBPP {
-			return uint32(t.block[SOF0ImageBPP]), nil
-		} else if tagID2Find == SOF0ImageHeight {
-			return uint32(t.endian.Uint16(t.block[SOF0ImageHeight : SOF0ImageHeight+2])), nil
-		} else if tagID2Find == SOF0ImageWidth {
-			return uint32(t.endian.Uint16(t.block[SOF0ImageWidth : SOF0ImageWidth+2])), nil
-		}
+	if tagID2Find == SOF0ImageBPP {
+		return uint32(t.block[SOF0ImageBPP]), nil
+	} else if tagID2Find == SOF0ImageHeight {
+		return uint32(t.endian.Uint16(t.block[SOF0ImageHeight : SOF0ImageHeight+2])), nil
+	} else if tagID2Find == SOF0ImageWidth {
+		return uint32(t.endian.Uint16(t.block[SOF0ImageWidth : SOF0ImageWidth+2])), nil
 	}
 	return int(0), nil
 }
 
+// Frame header fields, offsets in the SOFn block
 const (
 	SOF0ImageBPP    = 0x0004
 	SOF0ImageHeight = 0x0005
 	SOF0ImageWidth  = 0x0007
 )
+
+func (t tSOFnAPP) size() (uint32, uint32, bool) {
+	if len(t.block) < SOF0ImageWidth+2 {
+		return 0, 0, false
+	}
+	return uint32(t.endian.Uint16(t.block[SOF0ImageWidth:])), uint32(t.endian.Uint16(t.block[SOF0ImageHeight:])), true
+}
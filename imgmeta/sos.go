@@ -0,0 +1,80 @@
+package imgmeta
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+Structure of a SOS (Start of Scan) segment
+
+The SOS segment is the last marker segment before the entropy-coded image data. It is followed by the compressed
+data of the scan, which runs up to the next marker that is neither a stuffed zero byte (0xFF00) nor a restart
+marker (RST0-RST7). Progressive JPEGs contain several scans, each one introduced by its own SOS segment and usually
+separated by DHT segments.
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    Marker           2 bytes  0xFFDA
+    Length           2 bytes  length of the header, without the scan data
+    Components       1 byte   number of components in the scan
+    ...                       component selectors, spectral selection, successive approximation
+    ScanData           ...    entropy-coded data
+
+*/
+
+type tSOSAPP struct {
+	endian binary.ByteOrder
+	block  []byte // SOS header block
+	scan   []byte // entropy-coded data of this scan
+}
+
+func (t tSOSAPP) Name() string {
+	return "SOS"
+}
+func (t tSOSAPP) Marker() uint16 {
+	return cSOS
+}
+func (t tSOSAPP) Length() uint16 {
+	return t.endian.Uint16(t.block[2:])
+}
+func (t tSOSAPP) ID(cid []byte) []byte {
+	return []byte{}
+}
+func (t tSOSAPP) HasID(cid []byte) bool {
+	return true
+}
+
+func (t tSOSAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
+	return nil, &exifError{fmt.Sprintf("SOS has no tag 0x%X", tagID2Find)}
+}
+
+func fAPPReadSOS(marker uint16, reader *JpegReader) (a APP, err error) {
+	app := &tSOSAPP{endian: binary.BigEndian}
+	app.block, err = fAPPReadBlock(marker, reader, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entropy-coded data ends at the first marker that is not a stuffed byte or a restart marker
+	start := reader.pos()
+	end := start
+	size := uint64(len(reader.data))
+	for end < size {
+		if reader.data[end] == 0xFF && end+1 < size {
+			next := reader.data[end+1]
+			if next != 0x00 && (next < 0xD0 || next > 0xD7) {
+				break
+			}
+			end += 2
+			continue
+		}
+		end++
+	}
+	if end > size {
+		end = size
+	}
+	app.scan = reader.data[start:end]
+	reader.cursor = end
+	return app, nil
+}
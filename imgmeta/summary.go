@@ -0,0 +1,179 @@
+package imgmeta
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Summary holds the information about a photo that is asked for most often. Values that the image does not
+// have are nil.
+type Summary struct {
+	Make         *string    `json:"make"`
+	Model        *string    `json:"model"`
+	Lens         *string    `json:"lens"`
+	ExposureTime *float64   `json:"exposureTime"` // in seconds
+	FNumber      *float64   `json:"fNumber"`
+	ISO          *uint32    `json:"iso"`
+	FocalLength  *float64   `json:"focalLength"` // in mm
+	CaptureTime  *time.Time `json:"captureTime"` // in UTC if the image has no time zone
+	GPSLatitude  *float64   `json:"gpsLatitude"`
+	GPSLongitude *float64   `json:"gpsLongitude"`
+	GPSAltitude  *float64   `json:"gpsAltitude"` // in meters above sea level
+	Width        *uint32    `json:"width"`       // as displayed, i.e. with the orientation applied
+	Height       *uint32    `json:"height"`
+	Title        *string    `json:"title"`
+	Caption      *string    `json:"caption"`
+	Keywords     []string   `json:"keywords"`
+	Creator      []string   `json:"creator"`
+	Copyright    *string    `json:"copyright"`
+	Rating       *int       `json:"rating"` // -1 (rejected) to 5
+}
+
+// aSummaryDateLayouts are the forms of the dates of Metadata and of videos
+var aSummaryDateLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006:01:02 15:04:05",
+}
+
+// Summary returns camera, exposure, capture time, location, size and the descriptive metadata of the image.
+// The descriptive fields are reconciled by Metadata, videos without them use the values of their movie header.
+func (i Image) Summary() Summary {
+	s := Summary{}
+	meta := i.Metadata()
+
+	s.Make = i.summaryText([]string{"EXIF", "VIDEO"}, []uint16{ExifTagMake, VideoMake})
+	s.Model = i.summaryText([]string{"EXIF", "VIDEO"}, []uint16{ExifTagModel, VideoModel})
+	s.Lens = i.summaryText([]string{"EXIF"}, []uint16{ExifTagLensModel})
+	if s.Lens == nil {
+		for _, name := range []string{"exifEX:LensModel", "aux:Lens"} {
+			if value, ok := xmpText(name)(i); ok && s.Lens == nil {
+				text := value.(string)
+				s.Lens = &text
+			}
+		}
+	}
+
+	s.ExposureTime = i.summaryNumber(ExifTagExposureTime)
+	s.FNumber = i.summaryNumber(ExifTagFNumber)
+	s.FocalLength = i.summaryNumber(ExifTagFocalLength)
+	if value, ok := i.lookup("EXIF", ExifTagPhotographicSensitivity); ok {
+		if list, isList := value.([]uint16); isList && len(list) > 0 {
+			value = list[0]
+		}
+		if iso, ok := toUint32(value); ok {
+			s.ISO = &iso
+		}
+	}
+
+	for _, date := range []*MetadataValue{meta.DateTimeOriginal, i.summaryVideoValue(VideoCreationDate), i.summaryVideoValue(VideoCreateDate)} {
+		if date == nil || s.CaptureTime != nil {
+			continue
+		}
+		text, _ := date.Value.(string)
+		for _, layout := range aSummaryDateLayouts {
+			if captured, err := time.Parse(layout, text); err == nil {
+				s.CaptureTime = &captured
+				break
+			}
+		}
+	}
+
+	for _, coordinate := range []struct {
+		target **float64
+		values []*MetadataValue
+	}{
+		{&s.GPSLatitude, []*MetadataValue{meta.GPSLatitude, i.summaryVideoValue(VideoGPSLatitude)}},
+		{&s.GPSLongitude, []*MetadataValue{meta.GPSLongitude, i.summaryVideoValue(VideoGPSLongitude)}},
+		{&s.GPSAltitude, []*MetadataValue{i.summaryAltitude(), i.summaryVideoValue(VideoGPSAltitude)}},
+	} {
+		for _, value := range coordinate.values {
+			if degrees, ok := value.value().(float64); ok && *coordinate.target == nil {
+				*coordinate.target = &degrees
+			}
+		}
+	}
+
+	if width, height, err := i.DisplayDimensions(); err == nil {
+		s.Width, s.Height = &width, &height
+	}
+
+	if title, ok := meta.Title.value().(string); ok {
+		s.Title = &title
+	}
+	if caption, ok := meta.Description.value().(string); ok {
+		s.Caption = &caption
+	}
+	if copyright, ok := meta.Copyright.value().(string); ok {
+		s.Copyright = &copyright
+	}
+	s.Keywords, _ = meta.Keywords.value().([]string)
+	s.Creator, _ = meta.Creator.value().([]string)
+
+	if value, ok := xmpText("xmp:Rating")(i); ok {
+		if rating, err := strconv.ParseFloat(value.(string), 64); err == nil && rating >= -1 && rating <= 5 {
+			stars := int(rating)
+			s.Rating = &stars
+		}
+	}
+	return s
+}
+
+// value returns the value of a field of Metadata, nil if it is not set
+func (v *MetadataValue) value() interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.Value
+}
+
+// summaryText returns the first text of the tags of the sections that is not empty
+func (i Image) summaryText(sections []string, tags []uint16) *string {
+	for n, section := range sections {
+		value, _ := i.lookup(section, tags[n])
+		if text, ok := value.(string); ok && strings.TrimSpace(text) != "" {
+			text = strings.TrimSpace(text)
+			return &text
+		}
+	}
+	return nil
+}
+
+// summaryNumber returns a rational EXIF tag
+func (i Image) summaryNumber(tag uint16) *float64 {
+	value, _ := i.lookup("EXIF", tag)
+	if number, ok := value.(float64); ok {
+		return &number
+	}
+	return nil
+}
+
+// summaryVideoValue returns a value of the VIDEO section, nil for images
+func (i Image) summaryVideoValue(tag uint16) *MetadataValue {
+	if value, ok := i.lookup("VIDEO", tag); ok {
+		return &MetadataValue{Value: value, Source: "VIDEO"}
+	}
+	return nil
+}
+
+// summaryAltitude reads the altitude of the GPS IFD, the reference 1 means below sea level
+func (i Image) summaryAltitude() *MetadataValue {
+	exif, ok := i.apps["EXIF"].(tRawExif)
+	if !ok {
+		return nil
+	}
+	entry, _ := exif.rawTag(ExifGpsTagGPSAltitude, cIFDGPS)
+	values := entry.rationals()
+	if len(values) != 1 {
+		return nil
+	}
+	if ref, ok := exif.rawTag(ExifGpsTagGPSAltitudeRef, cIFDGPS); ok && len(ref.data) > 0 && ref.data[0] == 1 {
+		values[0] = -values[0]
+	}
+	return &MetadataValue{Value: values[0], Source: MetadataSourceEXIF}
+}
@@ -0,0 +1,114 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"time"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// sampleCameraTiff returns a TIFF with the camera, the exposure and the GPS position of a photo
+func sampleCameraTiff() []byte {
+	return buildTiff(binary.BigEndian, []testIFD{
+		{tags: map[uint16]interface{}{
+			ExifTagMake:  "Canon",
+			ExifTagModel: "Canon EOS R5",
+			0x8769:       testIFDRef(1),
+			0x8825:       testIFDRef(2),
+		}},
+		{tags: map[uint16]interface{}{
+			ExifTagExposureTime:            testRationals{{1, 250}},
+			ExifTagFNumber:                 testRationals{{28, 10}},
+			ExifTagPhotographicSensitivity: []uint16{400},
+			ExifTagFocalLength:             testRationals{{50, 1}},
+			ExifTagLensModel:               "RF24-105mm F4 L IS USM",
+			ExifTagDateTimeOriginal:        "2021:06:01 12:00:00",
+			ExifTagOffsetTimeOriginal:      "+02:00",
+		}},
+		{tags: map[uint16]interface{}{
+			ExifGpsTagGPSLatitudeRef:  "N",
+			ExifGpsTagGPSLatitude:     testRationals{{52, 1}, {31, 1}, {12, 1}},
+			ExifGpsTagGPSLongitudeRef: "W",
+			ExifGpsTagGPSLongitude:    testRationals{{13, 1}, {2460, 100}, {0, 1}},
+			ExifGpsTagGPSAltitudeRef:  []byte{1},
+			ExifGpsTagGPSAltitude:     testRationals{{34, 1}},
+		}},
+	})
+}
+
+var _ = Describe("Summary", func() {
+
+	It("should read the camera, the exposure and the position", func() {
+		image, err := Decode(bytes.NewReader(sampleCameraTiff()))
+		Expect(err).Should(BeNil())
+
+		summary := image.Summary()
+		Expect(*summary.Make).Should(Equal("Canon"))
+		Expect(*summary.Model).Should(Equal("Canon EOS R5"))
+		Expect(*summary.Lens).Should(Equal("RF24-105mm F4 L IS USM"))
+		Expect(*summary.ExposureTime).Should(Equal(0.004))
+		Expect(*summary.FNumber).Should(Equal(2.8))
+		Expect(*summary.ISO).Should(Equal(uint32(400)))
+		Expect(*summary.FocalLength).Should(Equal(50.0))
+		Expect(summary.CaptureTime.Equal(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC))).Should(BeTrue())
+		Expect(*summary.GPSLatitude).Should(BeNumerically("~", 52.52, 1e-9))
+		Expect(*summary.GPSLongitude).Should(BeNumerically("~", -13.41, 1e-9))
+		Expect(*summary.GPSAltitude).Should(Equal(-34.0))
+
+		// missing values are nil
+		Expect(summary.Width).Should(BeNil())
+		Expect(summary.Title).Should(BeNil())
+		Expect(summary.Keywords).Should(BeNil())
+		Expect(summary.Rating).Should(BeNil())
+	})
+
+	It("should ignore a blank time zone offset", func() {
+		image, err := Decode(bytes.NewReader(buildTiff(binary.BigEndian, []testIFD{
+			{tags: map[uint16]interface{}{0x8769: testIFDRef(1)}},
+			{tags: map[uint16]interface{}{
+				ExifTagDateTimeOriginal:   "2020:05:03 17:10:36",
+				ExifTagSubsecTimeOriginal: "25",
+				ExifTagOffsetTimeOriginal: "   :  ",
+			}},
+		})))
+		Expect(err).Should(BeNil())
+		Expect(image.Metadata().DateTimeOriginal.Value).Should(Equal("2020-05-03T17:10:36.25"))
+		Expect(*image.Summary().CaptureTime).Should(Equal(time.Date(2020, 5, 3, 17, 10, 36, 250000000, time.UTC)))
+	})
+
+	It("should read the descriptive metadata of a JPEG", func() {
+		file, err := os.Open(sampleJpeg)
+		Expect(err).Should(BeNil())
+		defer file.Close()
+		image, err := Decode(file)
+		Expect(err).Should(BeNil())
+
+		summary := image.Summary()
+		Expect(*summary.Title).Should(Equal("Titel - The Wall"))
+		Expect(*summary.Caption).Should(Equal("Daten-Bildbeschreibung"))
+		Expect(summary.Keywords).Should(Equal([]string{"test", "wall"}))
+		Expect(summary.Creator).Should(Equal([]string{"Daten-Künstler"}))
+		Expect(*summary.Copyright).Should(Equal("Daten-Urheberrechtsvermerk"))
+		Expect(*summary.Rating).Should(Equal(3))
+		Expect([]uint32{*summary.Width, *summary.Height}).Should(Equal([]uint32{500, 333}))
+		Expect(summary.ExposureTime).Should(BeNil())
+	})
+
+	It("should use the movie header of videos", func() {
+		image, err := Decode(bytes.NewReader(sampleVideo("qt  ")))
+		Expect(err).Should(BeNil())
+
+		summary := image.Summary()
+		Expect(*summary.Make).Should(Equal("Apple"))
+		Expect(*summary.Model).Should(Equal("iPhone 12"))
+		Expect(*summary.CaptureTime).Should(Equal(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)))
+		Expect(*summary.GPSLatitude).Should(BeNumerically("~", 37.3318, 1e-9))
+		Expect(*summary.GPSAltitude).Should(Equal(11.0))
+		Expect([]uint32{*summary.Width, *summary.Height}).Should(Equal([]uint32{1080, 1920}))
+	})
+
+})
@@ -0,0 +1,247 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of an SVG file
+
+An SVG file is an XML document with the root element svg (namespace "http://www.w3.org/2000/svg"):
+
+    <svg xmlns="http://www.w3.org/2000/svg" width="210mm" height="297mm" viewBox="0 0 210 297"
+         xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:dc="http://purl.org/dc/elements/1.1/">
+      <title>The Wall</title>                            title of the document
+      <desc>A wall in Berlin</desc>                      description of the document
+      <metadata>                                         RDF, e.g. Dublin Core or Creative Commons
+        <rdf:RDF>
+          <cc:Work rdf:about=""><dc:title>The Wall</dc:title></cc:Work>
+        </rdf:RDF>
+      </metadata>
+      ...
+    </svg>
+
+The size is given by width and height, with an optional unit (px, in, cm, mm, pt, pc at 96 dpi), or by the
+viewBox (min-x, min-y, width, height) if they are missing or relative (%, em).
+
+The metadata element is read as an XMP packet (see xmp.go), with the namespaces declared by the svg element.
+The title and desc elements are used as dc:title and dc:description, if the RDF has none.
+
+*/
+
+func init() {
+	for _, magic := range []string{"<svg", "<?xml", "<!DOCTYPE svg", "<!--", "\xEF\xBB\xBF<"} {
+		RegisterFormat("svg", magic, DecoderFunc(decodeSvg))
+	}
+}
+
+// Tags of the SVG section
+const (
+	SVGImageWidth  uint16 = 0x0001 // in pixels
+	SVGImageHeight uint16 = 0x0002 // in pixels
+	SVGWidth       uint16 = 0x0003 // width attribute, e.g. "210mm"
+	SVGHeight      uint16 = 0x0004 // height attribute
+	SVGViewBox     uint16 = 0x0005
+	SVGTitle       uint16 = 0x0006
+	SVGDescription uint16 = 0x0007
+)
+
+var aSVGTagNames = map[string]uint16{
+	"ImageWidth":  SVGImageWidth,
+	"ImageHeight": SVGImageHeight,
+	"Width":       SVGWidth,
+	"Height":      SVGHeight,
+	"ViewBox":     SVGViewBox,
+	"Title":       SVGTitle,
+	"Description": SVGDescription,
+}
+
+// aSVGUnits are the sizes of the absolute units in pixels
+var aSVGUnits = map[string]float64{"": 1, "px": 1, "in": 96, "cm": 96 / 2.54, "mm": 96 / 25.4, "pt": 96.0 / 72, "pc": 16}
+
+var rSVGLength = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+(?:[eE][+-]?[0-9]+)?)\s*([a-z%]*)\s*$`)
+
+const cSVGMaxSize = 16 << 20
+
+// tSVGAPP holds the size, the title and the description of an SVG
+type tSVGAPP struct {
+	tValuesAPP
+}
+
+func decodeSvg(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "svg"}
+
+	data, err := readAllLimited(r, cSVGMaxSize)
+	if err != nil {
+		return image, err
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	// the root element has to be svg, other XML documents are no SVG
+	var root xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return image, ErrUnknownFormat
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root = start
+			break
+		}
+	}
+	if root.Name.Local != "svg" {
+		return image, ErrUnknownFormat
+	}
+
+	svg := &tSVGAPP{tValuesAPP: tValuesAPP{name: "SVG", names: aSVGTagNames, values: map[uint16]interface{}{}}}
+	image.apps[svg.Name()] = svg
+	namespaces := []xml.Attr{}
+	for _, attr := range root.Attr {
+		switch {
+		case attr.Name.Space == "xmlns":
+			namespaces = append(namespaces, attr)
+		case attr.Name.Local == "width":
+			svg.values[SVGWidth] = attr.Value
+		case attr.Name.Local == "height":
+			svg.values[SVGHeight] = attr.Value
+		case attr.Name.Local == "viewBox":
+			svg.values[SVGViewBox] = attr.Value
+		}
+	}
+	svg.readSize()
+
+	var metadata []byte
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "title", "desc":
+			var text string
+			if err := decoder.DecodeElement(&text, &start); err != nil {
+				return image, &exifError{fmt.Sprintf("Invalid SVG %s: %v", start.Name.Local, err)}
+			}
+			tag := SVGTitle
+			if start.Name.Local == "desc" {
+				tag = SVGDescription
+			}
+			if _, ok := svg.values[tag]; !ok {
+				svg.values[tag] = strings.TrimSpace(text)
+			}
+		case "metadata":
+			begin := decoder.InputOffset()
+			if err := decoder.Skip(); err != nil {
+				return image, &exifError{fmt.Sprintf("Invalid SVG metadata: %v", err)}
+			}
+			content := data[begin:decoder.InputOffset()]
+			if end := bytes.LastIndex(content, []byte("</")); end >= 0 && metadata == nil {
+				for _, attr := range start.Attr {
+					if attr.Name.Space == "xmlns" {
+						namespaces = append(namespaces, attr)
+					}
+				}
+				metadata = content[:end]
+			}
+		default:
+			if err := decoder.Skip(); err != nil {
+				return image, nil
+			}
+		}
+	}
+
+	svg.readMetadata(&image, metadata, namespaces)
+	return image, nil
+}
+
+// readSize computes the size in pixels from width and height, or from the viewBox
+func (t *tSVGAPP) readSize() {
+	viewBox := []float64{}
+	if value, ok := t.values[SVGViewBox].(string); ok {
+		for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+			number, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				break
+			}
+			viewBox = append(viewBox, number)
+		}
+	}
+
+	for i, tags := range [][2]uint16{{SVGWidth, SVGImageWidth}, {SVGHeight, SVGImageHeight}} {
+		size, ok := 0.0, false
+		if value, isSet := t.values[tags[0]].(string); isSet {
+			size, ok = svgLength(value)
+		}
+		if !ok && len(viewBox) == 4 {
+			size, ok = viewBox[2+i], true
+		}
+		if ok && size >= 0 && size < math.MaxUint32 {
+			t.values[tags[1]] = uint32(math.Round(size))
+		}
+	}
+}
+
+// readMetadata reads the RDF of the metadata element as XMP, the title and the description of the SVG
+// are used if the RDF has none
+func (t *tSVGAPP) readMetadata(image *Image, metadata []byte, namespaces []xml.Attr) {
+	xmp := XMP{properties: map[string]interface{}{}}
+	if metadata != nil {
+		packet := bytes.Buffer{}
+		packet.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/"`)
+		for _, attr := range namespaces {
+			fmt.Fprintf(&packet, ` xmlns:%s="`, attr.Name.Local)
+			xml.EscapeText(&packet, []byte(attr.Value))
+			packet.WriteString(`"`)
+		}
+		packet.WriteString(">")
+		packet.Write(metadata)
+		packet.WriteString("</x:xmpmeta>")
+
+		var err error
+		if xmp, err = ParseXMP(packet.Bytes()); err != nil {
+			log.Warn(err.Error())
+			return
+		}
+	}
+
+	for tag, name := range map[uint16]string{SVGTitle: "dc:title", SVGDescription: "dc:description"} {
+		if value, ok := t.values[tag].(string); ok && value != "" {
+			if _, found := xmp.properties[name]; !found {
+				xmp.properties[name] = value
+			}
+		}
+	}
+	if len(xmp.properties) > 0 {
+		image.apps["XMP"] = &tXMPAPP{endian: binary.BigEndian, block: xmp.packet, xmp: xmp}
+	}
+}
+
+// svgLength converts a length with an absolute unit to pixels
+func svgLength(value string) (float64, bool) {
+	match := rSVGLength.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+	unit, ok := aSVGUnits[match[2]]
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	return number * unit, err == nil
+}
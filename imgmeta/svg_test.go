@@ -0,0 +1,69 @@
+package imgmeta_test
+
+import (
+	"bytes"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testSVG is an Inkscape-like SVG with Creative Commons metadata, the namespaces are declared by the svg element
+const testSVG = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Created with Inkscape -->
+<svg xmlns="http://www.w3.org/2000/svg" width="210mm" height="297mm" viewBox="0 0 210 297"
+     xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:dc="http://purl.org/dc/elements/1.1/"
+     xmlns:cc="http://creativecommons.org/ns#">
+  <title>Wall drawing</title>
+  <desc>A wall in Berlin</desc>
+  <metadata>
+    <rdf:RDF>
+      <cc:Work rdf:about="">
+        <dc:format>image/svg+xml</dc:format>
+        <dc:title>The Wall</dc:title>
+        <dc:creator><cc:Agent><dc:title>Jane</dc:title></cc:Agent></dc:creator>
+        <cc:license rdf:resource="http://creativecommons.org/licenses/by/4.0/"/>
+      </cc:Work>
+    </rdf:RDF>
+  </metadata>
+  <g><title>Layer 1</title><rect width="10" height="10"/></g>
+</svg>
+`
+
+var _ = Describe("SVG", func() {
+
+	It("should read the size, the title and the RDF metadata", func() {
+		image, err := Decode(bytes.NewReader([]byte(testSVG)))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("svg"))
+
+		Expect(image.ReadPropertyValue("SVG", "Width")).Should(Equal("210mm"))
+		Expect(image.ReadPropertyValue("SVG", "ViewBox")).Should(Equal("0 0 210 297"))
+		Expect(image.ReadPropertyValue("SVG", "Title")).Should(Equal("Wall drawing"))
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+		Expect(image.ReadPropertyValue("XMP", "dc:description")).Should(Equal("A wall in Berlin"))
+		Expect(image.ReadPropertyValue("XMP", "cc:license")).Should(Equal("http://creativecommons.org/licenses/by/4.0/"))
+		Expect(image.ReadPropertyValue("XMP", "dc:creator/dc:title")).Should(Equal("Jane"))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{794, 1123}))
+	})
+
+	It("should use the viewBox and the title without metadata", func() {
+		svg := `<svg xmlns="http://www.w3.org/2000/svg" width="100%" viewBox="0,0,640,480"><title>Logo</title></svg>`
+		image, err := Decode(bytes.NewReader([]byte(svg)))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("Logo"))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{640, 480}))
+	})
+
+	It("should not accept other XML documents", func() {
+		_, err := Decode(bytes.NewReader([]byte(`<?xml version="1.0"?><html></html>`)))
+		Expect(err).Should(Equal(ErrUnknownFormat))
+	})
+
+})
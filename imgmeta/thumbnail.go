@@ -0,0 +1,125 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// Thumbnail is a small copy of an image, used to compute placeholders
+type Thumbnail struct {
+	*image.NRGBA
+}
+
+// NewThumbnail scales an image down so that its longer side is at most size pixels.
+// Every thumbnail pixel is the average of the image pixels it covers.
+func NewThumbnail(img image.Image, size int) Thumbnail {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	w, h := sw, sh
+	if sw >= sh && sw > size {
+		w, h = size, sh*size/sw
+	} else if sh > sw && sh > size {
+		w, h = sw*size/sh, size
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	sums := make([][4]uint64, w*h)
+	rgb := rgbFunc(img)
+	for y := 0; y < sh; y++ {
+		ty := y * h / sh
+		for x := 0; x < sw; x++ {
+			tx := x * w / sw
+			r, g, b := rgb(bounds.Min.X+x, bounds.Min.Y+y)
+			s := &sums[ty*w+tx]
+			s[0] += uint64(r)
+			s[1] += uint64(g)
+			s[2] += uint64(b)
+			s[3]++
+		}
+	}
+
+	thumb := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i, s := range sums {
+		if s[3] == 0 {
+			continue
+		}
+		thumb.Pix[i*4] = uint8(s[0] / s[3])
+		thumb.Pix[i*4+1] = uint8(s[1] / s[3])
+		thumb.Pix[i*4+2] = uint8(s[2] / s[3])
+		thumb.Pix[i*4+3] = 0xFF
+	}
+	return Thumbnail{thumb}
+}
+
+// DominantColor returns the most frequent colour of the thumbnail as '#rrggbb'.
+// Colours are grouped in buckets of 4 bit per channel, the result is the average of the largest bucket.
+func (t Thumbnail) DominantColor() string {
+	type tBucket struct {
+		r, g, b, n int
+	}
+	buckets := map[int]*tBucket{}
+	for i := 0; i+3 < len(t.Pix); i += 4 {
+		r, g, b := int(t.Pix[i]), int(t.Pix[i+1]), int(t.Pix[i+2])
+		key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &tBucket{}
+			buckets[key] = bucket
+		}
+		bucket.r += r
+		bucket.g += g
+		bucket.b += b
+		bucket.n++
+	}
+
+	bestKey := -1
+	for key, bucket := range buckets {
+		if bestKey < 0 || bucket.n > buckets[bestKey].n || (bucket.n == buckets[bestKey].n && key < bestKey) {
+			bestKey = key
+		}
+	}
+	if bestKey < 0 {
+		return ""
+	}
+	best := buckets[bestKey]
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.n, best.g/best.n, best.b/best.n)
+}
+
+// DataURI returns the thumbnail as a base64 encoded PNG data URI, to be inlined in HTML.
+// For a few pixels PNG is a lot smaller than JPEG, which always carries its Huffman tables.
+func (t Thumbnail) DataURI() (string, error) {
+	buf := bytes.Buffer{}
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, t.NRGBA); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// rgbFunc returns a fast accessor for the 8 bit colour of a pixel
+func rgbFunc(img image.Image) func(x, y int) (uint8, uint8, uint8) {
+	switch i := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) (uint8, uint8, uint8) {
+			return color.YCbCrToRGB(i.Y[i.YOffset(x, y)], i.Cb[i.COffset(x, y)], i.Cr[i.COffset(x, y)])
+		}
+	case *image.Gray:
+		return func(x, y int) (uint8, uint8, uint8) {
+			v := i.Pix[i.PixOffset(x, y)]
+			return v, v, v
+		}
+	}
+	return func(x, y int) (uint8, uint8, uint8) {
+		c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		return c.R, c.G, c.B
+	}
+}
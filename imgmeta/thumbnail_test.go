@@ -0,0 +1,56 @@
+package imgmeta_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func solidImage(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: c}, image.ZP, draw.Src)
+	return img
+}
+
+var _ = Describe("Thumbnail", func() {
+
+	It("should keep the aspect ratio", func() {
+		thumb := NewThumbnail(solidImage(400, 100, color.White), 32)
+		Expect(thumb.Bounds().Dx()).Should(Equal(32))
+		Expect(thumb.Bounds().Dy()).Should(Equal(8))
+	})
+
+	It("should compute a BlurHash", func() {
+		thumb := NewThumbnail(solidImage(64, 64, color.RGBA{0xFF, 0, 0, 0xFF}), 32)
+
+		hash, err := thumb.BlurHash(1, 1)
+		Expect(err).Should(BeNil())
+		Expect(hash).Should(Equal("00TI:j"))
+
+		hash, err = thumb.BlurHash(4, 3)
+		Expect(err).Should(BeNil())
+		Expect(hash).Should(HaveLen(6 + 2*11))
+
+		_, err = thumb.BlurHash(10, 3)
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should find the dominant colour", func() {
+		img := image.NewRGBA(image.Rect(0, 0, 30, 30))
+		draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{0x10, 0x80, 0x20, 0xFF}}, image.ZP, draw.Src)
+		draw.Draw(img, image.Rect(0, 0, 10, 10), &image.Uniform{C: color.White}, image.ZP, draw.Src)
+
+		Expect(NewThumbnail(img, 30).DominantColor()).Should(Equal("#108020"))
+	})
+
+	It("should encode a data URI", func() {
+		uri, err := NewThumbnail(solidImage(64, 48, color.Black), 16).DataURI()
+		Expect(err).Should(BeNil())
+		Expect(uri).Should(HavePrefix("data:image/png;base64,"))
+	})
+
+})
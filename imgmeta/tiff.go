@@ -0,0 +1,351 @@
+package imgmeta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of a TIFF file
+
+A TIFF file is the same structure as the TIFF header and IFDs of an EXIF APP1 segment, without the "Exif\000\000"
+identifier. All offsets are relative to the start of the file:
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    Endianness       2 bytes   'II' (little-endian) or 'MM' (big-endian)
+    Signature        2 bytes   a fixed value = 42
+    IFD0_Pointer     4 bytes   offset of the first IFD
+    IFD0                ...    first page
+    IFD0@SubIFDs        ...    further images of the page (optional, tag 0x014A)
+    IFD0@SubIFD         ...    Exif private tags (optional, as in EXIF)
+    IFD0@GPS            ...    GPS IFD (optional, as in EXIF)
+    IFD1                ...    second page (optional, linked by the next_link of IFD0)
+    ...
+
+Each IFD describes one image. Its NewSubfileType (0x00FE) tells whether the image is a reduced resolution
+version of another one (bit 0), a page of a multi-page document (bit 1) or a transparency mask (bit 2).
+
+A DNG file is a TIFF file with a DNGVersion tag (0xC612) in IFD0. IFD0 usually holds a small preview, the
+raw sensor data is stored in a SubIFD with NewSubfileType 0. The dimensions of a TIFF are the ones of the
+largest IFD that is not a reduced resolution image. Most camera RAW formats are TIFF files as well, see raw.go.
+
+*/
+
+const (
+	cTIFFSignature       = 42
+	cTIFFXMLPacket       = 0x02BC // XMP packet, BYTE or UNDEFINED
+	cSubfileTypeReduced  = 0x0001
+	cTIFFMaxSubIFDLevels = 4
+	cCompressionOldJPEG  = 6
+	cCompressionJPEG     = 7
+)
+
+// aTIFFSignatures maps the signature after the byte order to the format, some RAW formats use their own
+var aTIFFSignatures = map[uint16]string{
+	cTIFFSignature: "tiff",
+	0x4F52:         "orf", // "IIRO" or "MMOR"
+	0x5352:         "orf", // "IIRS"
+	0x0055:         "rw2", // "IIU\000"
+}
+
+func init() {
+	RegisterFormat("tiff", "II*\x00", DecoderFunc(decodeTiff))
+	RegisterFormat("tiff", "MM\x00*", DecoderFunc(decodeTiff))
+}
+
+// tTIFFIFD is one image of a TIFF file
+type tTIFFIFD struct {
+	offset      uint32 // offset of the IFD from the start of the file
+	page        int    // index of the page in the IFD chain
+	level       int    // 0 for a page, 1 for its SubIFDs, ...
+	subfileType uint32
+	width       uint32
+	height      uint32
+}
+
+// tTIFFAPP holds all IFDs of a TIFF file, pages and SubIFDs
+type tTIFFAPP struct {
+	endian binary.ByteOrder
+	data   []byte
+	ifds   []tTIFFIFD // in the order they were found, pages are followed by their SubIFDs
+	main   int        // index of the full-resolution IFD in ifds
+	pages  int
+
+	width        uint32 // size of the image of RAW files, if it is not the size of an IFD
+	height       uint32
+	sensorWidth  uint32 // full size of the sensor of RAW files, including masked areas
+	sensorHeight uint32
+}
+
+func (t tTIFFAPP) Name() string {
+	return "TIFF"
+}
+func (t tTIFFAPP) Marker() uint16 {
+	return 0
+}
+func (t tTIFFAPP) Length() uint16 {
+	return 0
+}
+func (t tTIFFAPP) ID(cid []byte) []byte {
+	return []byte{}
+}
+func (t tTIFFAPP) HasID(cid []byte) bool {
+	return true
+}
+
+func (t tTIFFAPP) ifd(index int) tExifIFD {
+	return tExifIFD{offset: t.ifds[index].offset, base: 0, appblock: t.data, endian: t.endian}
+}
+
+// ReadValue reads a tag of the full-resolution IFD. If it has no such tag, the other IFDs are searched in
+// file order, so tags of IFD0 (e.g. DNGVersion) are found as well. DNGVersion and DNGBackwardVersion are
+// returned as a dotted string like "1.4.0.0".
+func (t tTIFFAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
+	log.Debug(fmt.Sprintf("Read value of tag:0x%X in APP:TIFF\n", tagID2Find))
+
+	if len(t.ifds) == 0 {
+		return nil, &exifError{"TIFF has no IFD"}
+	}
+	order := []int{t.main}
+	for i := range t.ifds {
+		if i != t.main {
+			order = append(order, i)
+		}
+	}
+
+	for _, i := range order {
+		ifd := t.ifd(i)
+		tag, found := ifd.FindTag(tagID2Find)
+		if !found {
+			continue
+		}
+		value, err := ifd.ReadValue(tag)
+		if err != nil {
+			return nil, err
+		}
+		if version, ok := value.([]uint8); ok && (tagID2Find == ExifTagDNGVersion || tagID2Find == ExifTagDNGBackwardVersion) {
+			parts := make([]string, len(version))
+			for j, v := range version {
+				parts[j] = fmt.Sprintf("%d", v)
+			}
+			return strings.Join(parts, "."), nil
+		}
+		return value, nil
+	}
+	return nil, &exifError{fmt.Sprintf("TIFF tag 0x%X not found", tagID2Find)}
+}
+
+// ReadProperty reads a tag by its EXIF name (e.g. 'UniqueCameraModel'), 'PageCount' is the number of pages
+// and 'IFDCount' the number of all IFDs including the SubIFDs. 'SensorWidth' and 'SensorHeight' are the
+// full size of the sensor of RAW files, or the image size if it is not known.
+func (t tTIFFAPP) ReadProperty(name string) (interface{}, error) {
+	switch name {
+	case "PageCount":
+		return t.pages, nil
+	case "IFDCount":
+		return len(t.ifds), nil
+	case "SensorWidth", "SensorHeight":
+		width, height, ok := t.size()
+		if t.sensorWidth > 0 && t.sensorHeight > 0 {
+			width, height, ok = t.sensorWidth, t.sensorHeight, true
+		}
+		if !ok {
+			return nil, &exifError{"TIFF has no image size"}
+		}
+		if name == "SensorWidth" {
+			return width, nil
+		}
+		return height, nil
+	}
+	for id, descr := range aExifTagDescr {
+		if descr.name == name && descr.tag == cIFDZERO {
+			return t.ReadValue(id)
+		}
+	}
+	return nil, &exifError{fmt.Sprintf("TIFF tag '%s' not found", name)}
+}
+
+func (t tTIFFAPP) size() (uint32, uint32, bool) {
+	if t.width > 0 && t.height > 0 {
+		return t.width, t.height, true
+	}
+	if len(t.ifds) == 0 {
+		return 0, 0, false
+	}
+	main := t.ifds[t.main]
+	return main.width, main.height, main.width > 0 && main.height > 0
+}
+
+// previewRanges returns the JPEG images of all IFDs, given by JPEGInterchangeFormat or by a single
+// JPEG compressed strip, and the JpgFromRaw of RW2
+func (t tTIFFAPP) previewRanges() []tByteRange {
+	ranges := []tByteRange{}
+	for i := range t.ifds {
+		ifd := t.ifd(i)
+		offset, okO := ifdValue(ifd, ExifTagJPEGInterchangeFormat)
+		length, okL := ifdValue(ifd, ExifTagJPEGInterchangeFormatLength)
+		if okO && okL {
+			o, _ := toUint32(offset)
+			l, _ := toUint32(length)
+			ranges = append(ranges, tByteRange{offset: int64(o), length: int64(l)})
+			continue
+		}
+
+		compression, _ := ifdValue(ifd, ExifTagCompression)
+		if compression != uint16(cCompressionOldJPEG) && compression != uint16(cCompressionJPEG) {
+			continue
+		}
+		offset, okO = ifdValue(ifd, ExifTagStripOffsets)
+		length, okL = ifdValue(ifd, ExifTagStripByteCounts)
+		o, okO2 := toUint32(offset)
+		l, okL2 := toUint32(length)
+		if okO && okL && okO2 && okL2 {
+			ranges = append(ranges, tByteRange{offset: int64(o), length: int64(l)})
+		}
+	}
+
+	if len(t.ifds) > 0 {
+		if tag, found := t.ifd(0).FindTag(cPanasonicJpeg); found && tag.TypeID()&^cARRAY == cUNDEFINED {
+			ranges = append(ranges, tByteRange{offset: int64(tag.valueOrOffset()), length: int64(tag.countOrComponents())})
+		}
+	}
+	return ranges
+}
+
+// newTIFFAPP walks the IFD chain of a TIFF structure and the SubIFDs of every page
+func newTIFFAPP(data []byte, endian binary.ByteOrder) *tTIFFAPP {
+	t := &tTIFFAPP{endian: endian, data: data}
+	visited := map[uint32]bool{}
+
+	offset := endian.Uint32(data[4:])
+	for offset != 0 && !visited[offset] {
+		ifd := t.addIFD(offset, t.pages, 0, visited)
+		if ifd == nil {
+			break
+		}
+		t.pages++
+		offset = ifd.next()
+	}
+
+	t.main = fullResolution(t.ifds)
+	return t
+}
+
+// addIFD records the IFD at offset and its SubIFDs, it returns nil if the IFD is out of range
+func (t *tTIFFAPP) addIFD(offset uint32, page, level int, visited map[uint32]bool) *tExifIFD {
+	ifd := tExifIFD{offset: offset, base: 0, appblock: t.data, endian: t.endian}
+	if visited[offset] || !ifd.valid() {
+		log.Warn(fmt.Sprintf("TIFF IFD at offset %d is invalid", offset))
+		return nil
+	}
+	visited[offset] = true
+
+	entry := tTIFFIFD{offset: offset, page: page, level: level}
+	if value, ok := ifdValue(ifd, ExifTagNewSubfileType); ok {
+		entry.subfileType, _ = toUint32(value)
+	}
+	if value, ok := ifdValue(ifd, ExifTagImageWidth); ok {
+		entry.width, _ = toUint32(value)
+	}
+	if value, ok := ifdValue(ifd, ExifTagImageHeight); ok {
+		entry.height, _ = toUint32(value)
+	}
+	t.ifds = append(t.ifds, entry)
+
+	if level >= cTIFFMaxSubIFDLevels {
+		return &ifd
+	}
+	if value, ok := ifdValue(ifd, ExifTagSubIFDs); ok {
+		offsets, _ := value.([]uint32)
+		if single, ok := value.(uint32); ok {
+			offsets = []uint32{single}
+		}
+		for _, subOffset := range offsets {
+			t.addIFD(subOffset, page, level+1, visited)
+		}
+	}
+	return &ifd
+}
+
+// ifdValue reads a tag of a single IFD
+func ifdValue(ifd tExifIFD, id uint16) (interface{}, bool) {
+	tag, found := ifd.FindTag(id)
+	if !found {
+		return nil, false
+	}
+	value, err := ifd.ReadValue(tag)
+	return value, err == nil
+}
+
+// fullResolution returns the index of the largest IFD that is not a reduced resolution image,
+// or of the largest IFD if all of them are reduced
+func fullResolution(ifds []tTIFFIFD) int {
+	best, bestArea := -1, uint64(0)
+	for i, ifd := range ifds {
+		area := uint64(ifd.width) * uint64(ifd.height)
+		if ifd.subfileType&cSubfileTypeReduced == 0 && (best < 0 || area > bestArea) {
+			best, bestArea = i, area
+		}
+	}
+	if best >= 0 {
+		return best
+	}
+
+	best, bestArea = 0, 0
+	for i, ifd := range ifds {
+		if area := uint64(ifd.width) * uint64(ifd.height); area > bestArea {
+			best, bestArea = i, area
+		}
+	}
+	return best
+}
+
+func decodeTiff(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return image, err
+	}
+	if len(data) < 8 {
+		return image, &exifError{"Wrong format"}
+	}
+	endian := tiffByteOrder(data)
+	format, ok := aTIFFSignatures[endian.Uint16(data[2:])]
+	if !ok {
+		return image, &exifError{"Wrong format"}
+	}
+
+	tiff := newTIFFAPP(data, endian)
+	if len(tiff.ifds) == 0 {
+		return image, &exifError{"TIFF has no valid IFD"}
+	}
+	image.apps[tiff.Name()] = tiff
+
+	exif := newExifAPP(data)
+	image.apps[exif.Name()] = exif
+
+	ifd0 := tiff.ifd(0)
+	if value, ok := ifdValue(ifd0, cTIFFXMLPacket); ok {
+		if packet, ok := value.([]byte); ok {
+			xmp, err := newXMPAPP(packet, packet)
+			if err != nil {
+				log.Warn(err.Error())
+			}
+			image.apps[xmp.Name()] = xmp
+		}
+	}
+
+	image.format = format
+	if format == "tiff" {
+		image.format = tiffFormat(data, tiff)
+	}
+	applyRawQuirks(&image, tiff)
+	return image, nil
+}
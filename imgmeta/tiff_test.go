@@ -0,0 +1,204 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testIFD describes an IFD of a generated TIFF, tags map to []uint16, []uint32, string, []byte, testRationals
+// or testIFDRef values
+type testIFD struct {
+	tags    map[uint16]interface{}
+	next    int   // index of the next IFD in the chain, 0 for none
+	subIFDs []int // indices of the SubIFDs
+}
+
+// testIFDRef is a LONG tag value with the offset of another IFD, e.g. of the Exif IFD
+type testIFDRef int
+
+// testRationals is a RATIONAL tag value of numerator/denominator pairs
+type testRationals [][2]uint32
+
+// encodeTag returns type, count and data of a tag value
+func encodeTag(endian binary.ByteOrder, value interface{}, offsets []uint32) (uint16, uint32, []byte) {
+	switch v := value.(type) {
+	case testIFDRef:
+		data := make([]byte, 4)
+		endian.PutUint32(data, offsets[v])
+		return 4, 1, data
+	case []uint16:
+		data := make([]byte, 2*len(v))
+		for i, x := range v {
+			endian.PutUint16(data[2*i:], x)
+		}
+		return 3, uint32(len(v)), data
+	case []uint32:
+		data := make([]byte, 4*len(v))
+		for i, x := range v {
+			endian.PutUint32(data[4*i:], x)
+		}
+		return 4, uint32(len(v)), data
+	case testRationals:
+		data := make([]byte, 8*len(v))
+		for i, x := range v {
+			endian.PutUint32(data[8*i:], x[0])
+			endian.PutUint32(data[8*i+4:], x[1])
+		}
+		return 5, uint32(len(v)), data
+	case string:
+		return 2, uint32(len(v) + 1), append([]byte(v), 0)
+	case []byte:
+		return 1, uint32(len(v)), v
+	}
+	panic("unsupported tag value")
+}
+
+// buildTiff lays out the IFDs one after another, each followed by its data, IFD 0 is the first page
+func buildTiff(endian binary.ByteOrder, ifds []testIFD) []byte {
+	return buildRawTiff(endian, 42, nil, ifds)
+}
+
+// buildRawTiff builds a TIFF with another signature and extra header bytes before the first IFD
+func buildRawTiff(endian binary.ByteOrder, signature uint16, extra []byte, ifds []testIFD) []byte {
+	offsets := make([]uint32, len(ifds))
+	offset := uint32(8 + len(extra))
+	for i, ifd := range ifds {
+		offsets[i] = offset
+		if len(ifd.subIFDs) > 0 {
+			ifd.tags[ExifTagSubIFDs] = make([]uint32, len(ifd.subIFDs))
+		}
+		offset += 2 + 12*uint32(len(ifd.tags)) + 4
+		for _, value := range ifd.tags {
+			if _, _, data := encodeTag(endian, value, offsets); len(data) > 4 {
+				offset += uint32(len(data)+1) &^ 1
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if endian == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(buf, endian, signature)
+	binary.Write(buf, endian, offsets[0])
+	buf.Write(extra)
+
+	for i, ifd := range ifds {
+		subIFDs := []uint32{}
+		for _, sub := range ifd.subIFDs {
+			subIFDs = append(subIFDs, offsets[sub])
+		}
+		if len(subIFDs) > 0 {
+			ifd.tags[ExifTagSubIFDs] = subIFDs
+		}
+
+		ids := []int{}
+		for id := range ifd.tags {
+			ids = append(ids, int(id))
+		}
+		sort.Ints(ids)
+
+		dataOffset := offsets[i] + 2 + 12*uint32(len(ids)) + 4
+		values := []byte{}
+		binary.Write(buf, endian, uint16(len(ids)))
+		for _, id := range ids {
+			typ, count, data := encodeTag(endian, ifd.tags[uint16(id)], offsets)
+			binary.Write(buf, endian, uint16(id))
+			binary.Write(buf, endian, typ)
+			binary.Write(buf, endian, count)
+			if len(data) <= 4 {
+				buf.Write(append(data, make([]byte, 4-len(data))...))
+				continue
+			}
+			binary.Write(buf, endian, dataOffset+uint32(len(values)))
+			values = append(values, data...)
+			if len(values)%2 == 1 {
+				values = append(values, 0)
+			}
+		}
+		next := uint32(0)
+		if ifd.next > 0 {
+			next = offsets[ifd.next]
+		}
+		binary.Write(buf, endian, next)
+		buf.Write(values)
+	}
+	return buf.Bytes()
+}
+
+func sampleDng() []byte {
+	return buildTiff(binary.LittleEndian, []testIFD{
+		{tags: map[uint16]interface{}{
+			ExifTagNewSubfileType:    []uint32{1},
+			ExifTagImageWidth:        []uint16{256},
+			ExifTagImageHeight:       []uint16{171},
+			ExifTagMake:              "Leica",
+			ExifTagOrientation:       []uint16{6},
+			ExifTagDNGVersion:        []byte{1, 4, 0, 0},
+			ExifTagUniqueCameraModel: "Leica Q2",
+			0x02BC:                   []byte(testXMP),
+		}, subIFDs: []int{1, 2}},
+		{tags: map[uint16]interface{}{
+			ExifTagNewSubfileType: []uint32{0},
+			ExifTagImageWidth:     []uint32{6000},
+			ExifTagImageHeight:    []uint32{4000},
+			ExifTagBitsPerSample:  []uint16{16},
+		}},
+		{tags: map[uint16]interface{}{
+			ExifTagNewSubfileType: []uint32{1},
+			ExifTagImageWidth:     []uint32{1024},
+			ExifTagImageHeight:    []uint32{683},
+		}},
+	})
+}
+
+var _ = Describe("TIFF", func() {
+
+	It("should read a multi-page TIFF", func() {
+		data := buildTiff(binary.BigEndian, []testIFD{
+			{tags: map[uint16]interface{}{ExifTagImageWidth: []uint16{640}, ExifTagImageHeight: []uint16{480}, ExifTagMake: "Scanner"}, next: 1},
+			{tags: map[uint16]interface{}{ExifTagImageWidth: []uint16{1280}, ExifTagImageHeight: []uint16{960}}, next: 2},
+			{tags: map[uint16]interface{}{ExifTagNewSubfileType: []uint32{1}, ExifTagImageWidth: []uint16{2560}, ExifTagImageHeight: []uint16{1920}}},
+		})
+		image, err := Decode(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("tiff"))
+		Expect(image.ReadPropertyValue("TIFF", "PageCount")).Should(Equal(3))
+		Expect(image.ReadTagValue("EXIF", ExifTagMake)).Should(Equal("Scanner"))
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{1280, 960}))
+	})
+
+	It("should read DNG tags and use the full-resolution SubIFD", func() {
+		image, err := Decode(bytes.NewReader(sampleDng()))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("dng"))
+
+		Expect(image.ReadPropertyValue("TIFF", "DNGVersion")).Should(Equal("1.4.0.0"))
+		Expect(image.ReadPropertyValue("TIFF", "UniqueCameraModel")).Should(Equal("Leica Q2"))
+		Expect(image.ReadPropertyValue("TIFF", "IFDCount")).Should(Equal(3))
+		Expect(image.ReadTagValue("TIFF", ExifTagBitsPerSample)).Should(Equal(uint16(16)))
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+
+		width, height, err := image.DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{4000, 6000}))
+	})
+
+	It("should not fail on broken IFD offsets", func() {
+		data := sampleDng()
+		binary.LittleEndian.PutUint32(data[4:], uint32(len(data)+100))
+		_, err := Decode(bytes.NewReader(data))
+		Expect(err).ShouldNot(BeNil())
+	})
+
+})
@@ -0,0 +1,403 @@
+package imgmeta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of an MP4 or QuickTime (MOV) file
+
+MP4 and MOV are based on the ISO base media file format (see bmff.go). The metadata is stored in the movie box:
+
+    ftyp   major brand, e.g. "isom", "mp42" or "qt  " (old QuickTime files have no ftyp box)
+    moov
+      mvhd   full box: creation time (4/8), modification time (4/8), time scale (4), duration (4/8), times and
+             durations are 8 bytes long in version 1. Times are seconds since 1904-01-01 00:00:00 UTC
+      trak   one per track
+        tkhd   full box: creation and modification time (4/8 each), track ID (4), reserved (4), duration (4/8),
+               reserved (8), layer (2), alternate group (2), volume (2), reserved (2), matrix (9*4),
+               width (4), height (4), the sizes are 16.16 fixed point numbers
+        mdia
+          hdlr   full box: pre-defined (4), handler type (4), "vide" for video and "soun" for audio tracks
+          minf
+            stbl
+              stsd   full box: entry count (4), sample entries, the type of the first one is the codec
+      udta   user data, QuickTime keys like "\251xyz" (location), "\251mak" (make) and "\251mod" (model):
+             size (2), language (2), text
+      meta   QuickTime metadata (a full box in MP4, a plain box in MOV):
+        hdlr   handler "mdta"
+        keys   full box: entry count (4), entries of size (4), namespace "mdta" (4) and the key name
+        ilst   one box per value, its type is the 1-based index into keys, holding a data box:
+               type (4, 1 for UTF-8), locale (4), value
+
+The keys read from meta are com.apple.quicktime.make, .model, .software, .creationdate and
+.location.ISO6709, and com.android.manufacturer, .model and .version. Locations are ISO 6709 strings like
+"+37.3318-122.0312+011.000/".
+
+The rotation is taken from the matrix of the first video track, it is the clockwise rotation for display.
+
+*/
+
+func init() {
+	for _, brand := range []string{"isom", "iso2", "iso4", "iso5", "iso6", "mp41", "mp42", "avc1", "M4V ", "3gp4", "3gp5", "3gp6", "3g2a", "MSNV", "dash"} {
+		RegisterFormat("mp4", "????ftyp"+brand, DecoderFunc(decodeVideo))
+	}
+	RegisterFormat("mov", "????ftypqt  ", DecoderFunc(decodeVideo))
+	for _, boxType := range []string{"moov", "mdat", "wide", "free", "skip"} {
+		RegisterFormat("mov", "????"+boxType, DecoderFunc(decodeVideo))
+	}
+}
+
+// Tags of the VIDEO section
+const (
+	VideoImageWidth   uint16 = 0x0001
+	VideoImageHeight  uint16 = 0x0002
+	VideoRotation     uint16 = 0x0003
+	VideoDuration     uint16 = 0x0004 // in seconds
+	VideoCreateDate   uint16 = 0x0005 // of mvhd, "YYYY:MM:DD HH:MM:SS" in UTC
+	VideoCodec        uint16 = 0x0006
+	VideoAudioCodec   uint16 = 0x0007
+	VideoMajorBrand   uint16 = 0x0008
+	VideoMake         uint16 = 0x0010
+	VideoModel        uint16 = 0x0011
+	VideoSoftware     uint16 = 0x0012
+	VideoCreationDate uint16 = 0x0013 // com.apple.quicktime.creationdate, with time zone
+	VideoLocation     uint16 = 0x0020 // ISO 6709 string
+	VideoGPSLatitude  uint16 = 0x0021
+	VideoGPSLongitude uint16 = 0x0022
+	VideoGPSAltitude  uint16 = 0x0023
+)
+
+var aVideoTagNames = map[string]uint16{
+	"ImageWidth":   VideoImageWidth,
+	"ImageHeight":  VideoImageHeight,
+	"Rotation":     VideoRotation,
+	"Duration":     VideoDuration,
+	"CreateDate":   VideoCreateDate,
+	"Codec":        VideoCodec,
+	"AudioCodec":   VideoAudioCodec,
+	"MajorBrand":   VideoMajorBrand,
+	"Make":         VideoMake,
+	"Model":        VideoModel,
+	"Software":     VideoSoftware,
+	"CreationDate": VideoCreationDate,
+	"Location":     VideoLocation,
+	"GPSLatitude":  VideoGPSLatitude,
+	"GPSLongitude": VideoGPSLongitude,
+	"GPSAltitude":  VideoGPSAltitude,
+}
+
+// aVideoKeys maps the keys of the QuickTime metadata and the user data to tags
+var aVideoKeys = map[string]uint16{
+	"com.apple.quicktime.make":             VideoMake,
+	"com.apple.quicktime.model":            VideoModel,
+	"com.apple.quicktime.software":         VideoSoftware,
+	"com.apple.quicktime.creationdate":     VideoCreationDate,
+	"com.apple.quicktime.location.ISO6709": VideoLocation,
+	"com.android.manufacturer":             VideoMake,
+	"com.android.model":                    VideoModel,
+	"com.android.version":                  VideoSoftware,
+	"\xa9mak":                              VideoMake,
+	"\xa9mod":                              VideoModel,
+	"\xa9swr":                              VideoSoftware,
+	"\xa9xyz":                              VideoLocation,
+}
+
+// aVideoRotationOrientation maps the clockwise rotation of the track matrix to the EXIF orientation
+var aVideoRotationOrientation = map[uint16]uint16{0: 1, 90: 6, 180: 3, 270: 8}
+
+// aVideoFormats are the formats that are videos
+var aVideoFormats = map[string]bool{"mp4": true, "mov": true}
+
+const (
+	cVideoMaxMoovSize = 64 << 20
+	cVideoEpochOffset = 2082844800 // seconds from 1904-01-01 to 1970-01-01
+	cVideoUTF8        = 1
+)
+
+var rISO6709 = regexp.MustCompile(`^([+-][0-9]+(?:\.[0-9]+)?)([+-][0-9]+(?:\.[0-9]+)?)([+-][0-9]+(?:\.[0-9]+)?)?`)
+
+// tVideoAPP holds the movie and track headers and the metadata keys of a video
+type tVideoAPP struct {
+	tValuesAPP
+}
+
+func (t tVideoAPP) orientation() (uint16, bool) {
+	rotation, ok := t.values[VideoRotation].(uint16)
+	if !ok {
+		return 0, false
+	}
+	orientation, ok := aVideoRotationOrientation[rotation]
+	return orientation, ok
+}
+
+// MediaType returns "video" for videos like MP4 and MOV, and "image" for all other formats
+func (i Image) MediaType() string {
+	if aVideoFormats[i.format] {
+		return "video"
+	}
+	return "image"
+}
+
+func decodeVideo(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "mov"}
+
+	boxes, err := readTopLevelBoxes(r, map[string]bool{"ftyp": true, "moov": true}, cVideoMaxMoovSize)
+	if err != nil && len(boxes) == 0 {
+		return image, err
+	}
+	video := &tVideoAPP{tValuesAPP: tValuesAPP{name: "VIDEO", names: aVideoTagNames, values: map[uint16]interface{}{}}}
+	image.apps[video.Name()] = video
+
+	if ftyp, ok := findBox(boxes, "ftyp"); ok {
+		major, _ := readFtyp(ftyp)
+		video.values[VideoMajorBrand] = major
+		if major != "qt  " {
+			image.format = "mp4"
+		}
+	}
+
+	moov, ok := findBox(boxes, "moov")
+	if !ok || moov.data == nil {
+		return image, &exifError{"Video has no moov box"}
+	}
+	for _, box := range readBoxes(moov.data) {
+		switch box.boxType {
+		case "mvhd":
+			video.readMvhd(box)
+		case "trak":
+			video.readTrak(box)
+		case "udta":
+			for _, item := range readBoxes(box.data) {
+				if tag, ok := aVideoKeys[item.boxType]; ok && video.values[tag] == nil {
+					video.setKey(tag, userDataText(item.data))
+				}
+			}
+		case "meta":
+			video.readMeta(box)
+		}
+	}
+
+	if location, ok := video.values[VideoLocation].(string); ok {
+		video.readLocation(location)
+	}
+	return image, nil
+}
+
+// readMvhd reads the creation time and the duration of the movie
+func (t *tVideoAPP) readMvhd(box tBox) {
+	reader := &tBoxReader{data: box.data}
+	version, _ := reader.fullBox()
+	var created, duration uint64
+	var scale uint32
+	if version == 1 {
+		created = reader.u64()
+		reader.u64()
+		scale = reader.u32()
+		duration = reader.u64()
+	} else {
+		created = uint64(reader.u32())
+		reader.u32()
+		scale = reader.u32()
+		duration = uint64(reader.u32())
+	}
+	if reader.failed {
+		log.Warn("Video mvhd box is truncated")
+		return
+	}
+	if created > cVideoEpochOffset {
+		t.values[VideoCreateDate] = time.Unix(int64(created-cVideoEpochOffset), 0).UTC().Format("2006:01:02 15:04:05")
+	}
+	if scale > 0 {
+		t.values[VideoDuration] = float64(duration) / float64(scale)
+	}
+}
+
+// readTrak reads size, rotation and codec of the first video track and the codec of the first audio track
+func (t *tVideoAPP) readTrak(trak tBox) {
+	children := readBoxes(trak.data)
+	handler := ""
+	if hdlr, ok := findBoxPath(children, "mdia", "hdlr"); ok && len(hdlr.data) >= 12 {
+		handler = string(hdlr.data[8:12])
+	}
+	codec := ""
+	if stsd, ok := findBoxPath(children, "mdia", "minf", "stbl", "stsd"); ok && len(stsd.data) >= 16 {
+		codec = string(stsd.data[12:16])
+	}
+
+	switch handler {
+	case "vide":
+		if _, ok := t.values[VideoCodec]; ok {
+			return
+		}
+		if codec != "" {
+			t.values[VideoCodec] = codec
+		}
+		if tkhd, ok := findBox(children, "tkhd"); ok {
+			t.readTkhd(tkhd)
+		}
+	case "soun":
+		if _, ok := t.values[VideoAudioCodec]; !ok && codec != "" {
+			t.values[VideoAudioCodec] = codec
+		}
+	}
+}
+
+// readTkhd reads the size and the rotation of a track
+func (t *tVideoAPP) readTkhd(box tBox) {
+	reader := &tBoxReader{data: box.data}
+	version, _ := reader.fullBox()
+	if version == 1 {
+		reader.next(8 + 8 + 4 + 4 + 8)
+	} else {
+		reader.next(4 + 4 + 4 + 4 + 4)
+	}
+	reader.next(8 + 2 + 2 + 2 + 2)
+	matrix := make([]int32, 9)
+	for i := range matrix {
+		matrix[i] = int32(reader.u32())
+	}
+	width := reader.u32() >> 16
+	height := reader.u32() >> 16
+	if reader.failed {
+		log.Warn("Video tkhd box is truncated")
+		return
+	}
+
+	t.values[VideoImageWidth] = width
+	t.values[VideoImageHeight] = height
+	a, b := matrix[0], matrix[1]
+	switch {
+	case a == 0 && b > 0:
+		t.values[VideoRotation] = uint16(90)
+	case a < 0 && b == 0:
+		t.values[VideoRotation] = uint16(180)
+	case a == 0 && b < 0:
+		t.values[VideoRotation] = uint16(270)
+	default:
+		t.values[VideoRotation] = uint16(0)
+	}
+}
+
+// readMeta reads the values of the QuickTime metadata by their keys
+func (t *tVideoAPP) readMeta(meta tBox) {
+	children := readBoxes(meta.data)
+	if _, ok := findBox(children, "hdlr"); !ok && len(meta.data) > 4 {
+		children = readBoxes(meta.data[4:]) // full box in MP4
+	}
+	keysBox, okK := findBox(children, "keys")
+	ilst, okI := findBox(children, "ilst")
+	if !okK || !okI {
+		return
+	}
+
+	keys := []string{}
+	reader := &tBoxReader{data: keysBox.data}
+	reader.fullBox()
+	count := reader.u32()
+	for i := uint32(0); i < count && !reader.failed; i++ {
+		size := reader.u32()
+		if size < 8 || uint64(size) > uint64(len(keysBox.data)) {
+			log.Warn(fmt.Sprintf("Video metadata key %d has an invalid size of %d bytes", i+1, size))
+			break
+		}
+		reader.fourCC() // namespace
+		keys = append(keys, string(reader.next(int(size)-8)))
+	}
+
+	for _, item := range readBoxes(ilst.data) {
+		index := int(binary.BigEndian.Uint32([]byte(item.boxType)))
+		if index < 1 || index > len(keys) {
+			continue
+		}
+		tag, ok := aVideoKeys[keys[index-1]]
+		if !ok {
+			continue
+		}
+		data, ok := findBox(readBoxes(item.data), "data")
+		if !ok || len(data.data) < 8 || binary.BigEndian.Uint32(data.data)&0xffffff != cVideoUTF8 {
+			continue
+		}
+		t.setKey(tag, string(data.data[8:]))
+	}
+}
+
+// setKey sets a value of the metadata, the QuickTime metadata takes precedence over the user data
+func (t *tVideoAPP) setKey(tag uint16, value string) {
+	value = strings.TrimRight(value, "\x00")
+	if value != "" {
+		t.values[tag] = value
+	}
+}
+
+// readLocation reads latitude, longitude and altitude of an ISO 6709 string
+func (t *tVideoAPP) readLocation(location string) {
+	match := rISO6709.FindStringSubmatch(location)
+	if match == nil {
+		log.Warn(fmt.Sprintf("Video location '%s' is invalid", location))
+		return
+	}
+	latitude, okLat := iso6709Degrees(match[1], 2)
+	longitude, okLon := iso6709Degrees(match[2], 3)
+	if !okLat || !okLon {
+		return
+	}
+	t.values[VideoGPSLatitude] = latitude
+	t.values[VideoGPSLongitude] = longitude
+	if match[3] != "" {
+		if altitude, err := strconv.ParseFloat(match[3], 64); err == nil {
+			t.values[VideoGPSAltitude] = altitude
+		}
+	}
+}
+
+// iso6709Degrees converts a coordinate of ISO 6709 to decimal degrees. The integer part has degreeDigits
+// digits (±DD.D), or additional digits for minutes (±DDMM.M) and seconds (±DDMMSS.S).
+func iso6709Degrees(value string, degreeDigits int) (float64, bool) {
+	integer := len(value) - 1
+	if dot := strings.IndexByte(value, '.'); dot >= 0 {
+		integer = dot - 1
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	sign := 1.0
+	if number < 0 {
+		sign, number = -1, -number
+	}
+
+	switch integer - degreeDigits {
+	case 0:
+		return sign * number, true
+	case 2:
+		degrees := float64(int(number / 100))
+		return sign * (degrees + (number-degrees*100)/60), true
+	case 4:
+		degrees := float64(int(number / 10000))
+		minutes := float64(int((number - degrees*10000) / 100))
+		seconds := number - degrees*10000 - minutes*100
+		return sign * (degrees + minutes/60 + seconds/3600), true
+	}
+	return 0, false
+}
+
+// userDataText returns the text of a QuickTime user data item
+func userDataText(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	size := int(binary.BigEndian.Uint16(data))
+	if 4+size > len(data) {
+		size = len(data) - 4
+	}
+	return string(data[4 : 4+size])
+}
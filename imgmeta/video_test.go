@@ -0,0 +1,118 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// trak returns a track with a handler, a codec and a tkhd box with the given matrix
+func trak(handler, codec string, width, height uint32, a, b, c, d int32) []byte {
+	tkhd := append(make([]byte, 4+20+16), u32(uint32(a))...)
+	tkhd = append(tkhd, u32(uint32(b))...)
+	tkhd = append(tkhd, u32(0)...)
+	tkhd = append(tkhd, u32(uint32(c))...)
+	tkhd = append(tkhd, u32(uint32(d))...)
+	tkhd = append(tkhd, make([]byte, 12)...)
+	tkhd = append(tkhd, u32(0x40000000)...)
+	tkhd = append(tkhd, u32(width<<16)...)
+	tkhd = append(tkhd, u32(height<<16)...)
+
+	return box("trak", box("tkhd", tkhd), box("mdia",
+		box("hdlr", u32(0), u32(0), []byte(handler)),
+		box("minf", box("stbl", box("stsd", u32(0), u32(1), box(codec, make([]byte, 8)))))))
+}
+
+// mdtaKeys returns the keys and the ilst box of QuickTime metadata
+func mdtaKeys(values ...string) ([]byte, []byte) {
+	keys := append(u32(0), u32(uint32(len(values)/2))...)
+	items := [][]byte{}
+	for i := 0; i < len(values); i += 2 {
+		keys = append(append(keys, u32(uint32(8+len(values[i])))...), "mdta"+values[i]...)
+		items = append(items, box(string(u32(uint32(i/2+1))), box("data", u32(1), u32(0), []byte(values[i+1]))))
+	}
+	return box("keys", keys), box("ilst", items...)
+}
+
+// sampleVideo returns an iPhone-like MOV recorded in portrait orientation, 12.5 seconds long
+func sampleVideo(brand string) []byte {
+	mvhd := append(u32(0), u32(2082844800+1622548800)...) // 2021-06-01 12:00:00 UTC
+	mvhd = append(mvhd, u32(0)...)
+	mvhd = append(mvhd, u32(600)...)
+	mvhd = append(mvhd, u32(7500)...)
+
+	location := "+48.8584+002.2945/"
+	udta := box("udta", box("\xa9xyz", u16(uint16(len(location))), u16(0x15c7), []byte(location)))
+	keys, ilst := mdtaKeys(
+		"com.apple.quicktime.make", "Apple",
+		"com.apple.quicktime.model", "iPhone 12",
+		"com.apple.quicktime.location.ISO6709", "+37.3318-122.0312+011.000/",
+	)
+	meta := box("meta", box("hdlr", u32(0), u32(0), []byte("mdta")), keys, ilst)
+
+	return append(append(box("ftyp", []byte(brand), u32(0), []byte(brand)), box("mdat", make([]byte, 32))...),
+		box("moov",
+			box("mvhd", mvhd),
+			trak("vide", "hvc1", 1920, 1080, 0, 0x10000, -0x10000, 0),
+			trak("soun", "mp4a", 0, 0, 0x10000, 0, 0, 0x10000),
+			udta, meta)...)
+}
+
+var _ = Describe("Video", func() {
+
+	It("should read the movie header, the tracks and the metadata keys of a MOV", func() {
+		image, err := Decode(bytes.NewReader(sampleVideo("qt  ")))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("mov"))
+		Expect(image.MediaType()).Should(Equal("video"))
+
+		Expect(image.ReadPropertyValue("VIDEO", "CreateDate")).Should(Equal("2021:06:01 12:00:00"))
+		Expect(image.ReadPropertyValue("VIDEO", "Duration")).Should(Equal(12.5))
+		Expect(image.ReadPropertyValue("VIDEO", "Codec")).Should(Equal("hvc1"))
+		Expect(image.ReadPropertyValue("VIDEO", "AudioCodec")).Should(Equal("mp4a"))
+		Expect(image.ReadPropertyValue("VIDEO", "Rotation")).Should(Equal(uint16(90)))
+		Expect(image.ReadPropertyValue("VIDEO", "Make")).Should(Equal("Apple"))
+		Expect(image.ReadPropertyValue("VIDEO", "Model")).Should(Equal("iPhone 12"))
+		Expect(image.ReadPropertyValue("VIDEO", "GPSLatitude")).Should(BeNumerically("~", 37.3318, 1e-9))
+		Expect(image.ReadPropertyValue("VIDEO", "GPSLongitude")).Should(BeNumerically("~", -122.0312, 1e-9))
+		Expect(image.ReadPropertyValue("VIDEO", "GPSAltitude")).Should(Equal(11.0))
+
+		width, height, err := image.DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{1080, 1920}))
+	})
+
+	It("should read the location of the user data of an MP4", func() {
+		data := append(box("ftyp", []byte("mp42"), u32(0)), box("moov",
+			trak("vide", "avc1", 640, 480, 0x10000, 0, 0, 0x10000),
+			box("udta", box("\xa9xyz", u16(18), u16(0), []byte("+4851.50+00217.70/"))))...)
+
+		image, err := Decode(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("mp4"))
+		Expect(image.Orientation()).Should(Equal(uint16(1)))
+		Expect(image.ReadPropertyValue("VIDEO", "GPSLatitude")).Should(BeNumerically("~", 48.858333, 1e-6))
+		Expect(image.ReadPropertyValue("VIDEO", "GPSLongitude")).Should(BeNumerically("~", 2.295, 1e-6))
+	})
+
+	It("should stop reading metadata keys with an invalid size", func() {
+		keys, ilst := mdtaKeys("com.apple.quicktime.make", "Apple", "com.apple.quicktime.model", "iPhone 12")
+		for _, size := range []uint32{4, 0xFFFFFFF0} {
+			// the size of the second key
+			data := append([]byte{}, keys...)
+			binary.BigEndian.PutUint32(data[8+8+8+len("com.apple.quicktime.make"):], size)
+			data = append(box("ftyp", []byte("qt  "), u32(0)), box("moov",
+				box("meta", box("hdlr", u32(0), u32(0), []byte("mdta")), data, ilst))...)
+
+			image, err := Decode(bytes.NewReader(data))
+			Expect(err).Should(BeNil())
+			Expect(image.ReadPropertyValue("VIDEO", "Make")).Should(Equal("Apple"))
+			_, err = image.ReadPropertyValue("VIDEO", "Model")
+			Expect(err).ShouldNot(BeNil())
+		}
+	})
+
+})
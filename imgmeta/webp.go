@@ -0,0 +1,230 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Structure of a WebP file
+
+A WebP file is a RIFF container. It starts with a 12 byte header followed by a sequence of chunks:
+
+    [Record name]    [size]   [description]
+    ---------------------------------------
+    RIFF             4 bytes  "RIFF"
+    File size        4 bytes  size of the rest of the file (little-endian)
+    WEBP             4 bytes  "WEBP"
+    Chunks             ...
+
+    Chunk FourCC     4 bytes  chunk type, e.g. "VP8 "
+    Chunk size       4 bytes  size of the payload (little-endian)
+    Payload            ...    padded with a zero byte to an even size
+
+A simple file has exactly one chunk with the bitstream:
+
+    VP8    lossy, 3 byte frame tag, start code 0x9d 0x01 0x2a, 14 bit width and height (little-endian)
+    VP8L   lossless, signature 0x2f, 14 bit width-1, 14 bit height-1, 1 bit alpha, 3 bit version
+
+An extended file starts with a VP8X chunk:
+
+    VP8X   flags (1): ICC (0x20), alpha (0x10), EXIF (0x08), XMP (0x04), animation (0x02),
+           reserved (3), canvas width-1 (3), canvas height-1 (3)
+    ICCP   ICC profile
+    ANIM   background colour (4), loop count (2)
+    ANMF   one frame of an animation
+    ALPH   alpha channel of a lossy image
+    EXIF   EXIF data, a TIFF structure (some writers keep the "Exif\000\000" identifier)
+    XMP    XMP packet
+
+The bitstreams are skipped, only their headers are read. Metadata chunks larger than cWebPMaxChunkSize or beyond
+the end of the RIFF container are skipped.
+
+*/
+
+func init() {
+	RegisterFormat("webp", "RIFF????WEBP", DecoderFunc(decodeWebp))
+}
+
+// Tags of the WebP section
+const (
+	WebPImageWidth  uint16 = 0x0001
+	WebPImageHeight uint16 = 0x0002
+	WebPLossless    uint16 = 0x0003
+	WebPAlpha       uint16 = 0x0004
+	WebPAnimation   uint16 = 0x0005
+	WebPFrameCount  uint16 = 0x0006
+	WebPLoopCount   uint16 = 0x0007
+	WebPICCProfile  uint16 = 0x0012
+)
+
+var aWebPTagNames = map[string]uint16{
+	"ImageWidth":  WebPImageWidth,
+	"ImageHeight": WebPImageHeight,
+	"Lossless":    WebPLossless,
+	"Alpha":       WebPAlpha,
+	"Animation":   WebPAnimation,
+	"FrameCount":  WebPFrameCount,
+	"LoopCount":   WebPLoopCount,
+	"ICCProfile":  WebPICCProfile,
+}
+
+const (
+	cWebPFlagAnimation = 0x02
+	cWebPFlagAlpha     = 0x10
+	cWebPHeaderSize    = 30       // enough for the VP8X, VP8 and VP8L headers
+	cWebPMaxChunkSize  = 16 << 20 // metadata chunks larger than this are skipped
+)
+
+// tWebPAPP holds the header values of a WebP
+type tWebPAPP struct {
+	tValuesAPP
+}
+
+func decodeWebp(r io.ReadSeeker) (image Image, err error) {
+	image = Image{apps: map[string]APP{}, format: "webp"}
+	webp := &tWebPAPP{tValuesAPP: tValuesAPP{name: "WEBP", names: aWebPTagNames, values: map[uint16]interface{}{
+		WebPLossless:  false,
+		WebPAlpha:     false,
+		WebPAnimation: false,
+	}}}
+
+	header := make([]byte, 12)
+	if _, err = io.ReadFull(r, header); err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WEBP" {
+		return image, &exifError{"Wrong format"}
+	}
+	end := int64(binary.LittleEndian.Uint32(header[4:])) + 8
+
+	extended := false
+	frames := uint32(0)
+	position := int64(12)
+	for position+8 <= end {
+		if _, err = io.ReadFull(r, header[:8]); err != nil {
+			break
+		}
+		chunkType := string(header[:4])
+		length := int64(binary.LittleEndian.Uint32(header[4:]))
+		next := position + 8 + length + length&1
+		position = next
+
+		switch chunkType {
+		case "VP8X", "VP8 ", "VP8L", "ALPH", "ANMF":
+			data := make([]byte, cWebPHeaderSize)
+			n, _ := io.ReadFull(r, data[:minInt64(length, cWebPHeaderSize)])
+			webp.readHeader(chunkType, data[:n], extended)
+			if chunkType == "VP8X" {
+				extended = true
+			} else if chunkType == "ANMF" {
+				frames++
+			}
+		case "ANIM", "ICCP", "EXIF", "XMP ":
+			if length > cWebPMaxChunkSize || next-length&1 > end {
+				log.Warn(fmt.Sprintf("WebP chunk %s is too large (%d bytes) and is skipped", chunkType, length))
+				break
+			}
+			data, err := readAllLimited(r, length)
+			if err != nil || int64(len(data)) < length {
+				return image, &exifError{fmt.Sprintf("WebP chunk %s is truncated", chunkType)}
+			}
+			webp.readMeta(&image, chunkType, data)
+		}
+
+		if _, err = r.Seek(next, io.SeekStart); err != nil {
+			return image, err
+		}
+	}
+
+	if frames > 0 {
+		webp.values[WebPFrameCount] = frames
+	}
+	if _, _, ok := webp.size(); !ok {
+		return image, &exifError{"WebP has no image header"}
+	}
+	image.apps[webp.Name()] = webp
+	return image, nil
+}
+
+// readHeader reads the size and flags of the VP8X, VP8 and VP8L headers, the canvas of a VP8X
+// takes precedence over the size of the bitstream
+func (t *tWebPAPP) readHeader(chunkType string, data []byte, extended bool) {
+	switch chunkType {
+	case "VP8X":
+		if len(data) < 10 {
+			return
+		}
+		t.values[WebPAnimation] = data[0]&cWebPFlagAnimation != 0
+		t.values[WebPAlpha] = data[0]&cWebPFlagAlpha != 0
+		t.values[WebPImageWidth] = uint24(data[4:]) + 1
+		t.values[WebPImageHeight] = uint24(data[7:]) + 1
+	case "VP8 ":
+		if len(data) < 10 || !bytes.Equal(data[3:6], []byte{0x9d, 0x01, 0x2a}) {
+			log.Warn("WebP VP8 header is invalid")
+			return
+		}
+		if !extended {
+			t.values[WebPImageWidth] = uint32(binary.LittleEndian.Uint16(data[6:]) & 0x3fff)
+			t.values[WebPImageHeight] = uint32(binary.LittleEndian.Uint16(data[8:]) & 0x3fff)
+		}
+	case "VP8L":
+		if len(data) < 5 || data[0] != 0x2f {
+			log.Warn("WebP VP8L header is invalid")
+			return
+		}
+		t.values[WebPLossless] = true
+		if !extended {
+			bits := binary.LittleEndian.Uint32(data[1:])
+			t.values[WebPImageWidth] = bits&0x3fff + 1
+			t.values[WebPImageHeight] = (bits>>14)&0x3fff + 1
+			t.values[WebPAlpha] = (bits>>28)&1 == 1
+		}
+	case "ALPH":
+		t.values[WebPAlpha] = true
+	case "ANMF":
+		// frame position (6), size (6), duration (3), flags (1), followed by the frame bitstream
+		if len(data) >= 24 && string(data[16:20]) == "VP8L" {
+			t.values[WebPLossless] = true
+		}
+	}
+}
+
+// readMeta reads the chunks with metadata into the sections of image
+func (t *tWebPAPP) readMeta(image *Image, chunkType string, data []byte) {
+	switch chunkType {
+	case "ANIM":
+		if len(data) >= 6 {
+			t.values[WebPLoopCount] = binary.LittleEndian.Uint16(data[4:])
+		}
+	case "ICCP":
+		t.values[WebPICCProfile] = data
+	case "EXIF":
+		data = bytes.TrimPrefix(data, idEXIF)
+		if len(data) < 8 {
+			log.Warn("WebP EXIF chunk is too short")
+			return
+		}
+		exif := newExifAPP(data)
+		image.apps[exif.Name()] = exif
+	case "XMP ":
+		xmp, err := newXMPAPP(data, data)
+		if err != nil {
+			log.Warn(err.Error())
+		}
+		image.apps[xmp.Name()] = xmp
+	}
+}
+
+// uint24 reads a 24 bit little-endian value
+func uint24(data []byte) uint32 {
+	return uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,98 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func webpFile(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return riffChunk("RIFF", body)
+}
+
+// vp8lHeader returns the header of a lossless bitstream
+func vp8lHeader(width, height uint32, alpha bool) []byte {
+	bits := (width - 1) | (height-1)<<14
+	if alpha {
+		bits |= 1 << 28
+	}
+	header := []byte{0x2f, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(header[1:], bits)
+	return header
+}
+
+var _ = Describe("WebP", func() {
+
+	It("should read a lossy WebP", func() {
+		vp8 := []byte{0x50, 0x2a, 0x00, 0x9d, 0x01, 0x2a, 0x90, 0x01, 0x2c, 0x01, 0xff, 0xff}
+		image, err := Decode(bytes.NewReader(webpFile(riffChunk("VP8 ", vp8))))
+		Expect(err).Should(BeNil())
+		Expect(image.Format()).Should(Equal("webp"))
+		Expect(image.ReadPropertyValue("WEBP", "Lossless")).Should(BeFalse())
+
+		width, height, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{400, 300}))
+	})
+
+	It("should read a lossless WebP with alpha", func() {
+		image, err := Decode(bytes.NewReader(webpFile(riffChunk("VP8L", vp8lHeader(100, 50, true)))))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("WEBP", "Lossless")).Should(BeTrue())
+		Expect(image.ReadPropertyValue("WEBP", "Alpha")).Should(BeTrue())
+		Expect(image.ReadTagValue("WEBP", WebPImageWidth)).Should(Equal(uint32(100)))
+		Expect(image.ReadTagValue("WEBP", WebPImageHeight)).Should(Equal(uint32(50)))
+	})
+
+	It("should read an extended WebP with animation, EXIF and XMP", func() {
+		vp8x := []byte{0x1e, 0, 0, 0, 0x7f, 0x02, 0x00, 0xdf, 0x01, 0x00} // 640x480
+		frame := append(make([]byte, 16), riffChunk("VP8L", vp8lHeader(640, 480, true))...)
+		data := webpFile(
+			riffChunk("VP8X", vp8x),
+			riffChunk("ANIM", []byte{0, 0, 0, 0, 3, 0}),
+			riffChunk("ANMF", frame),
+			riffChunk("ANMF", frame),
+			riffChunk("EXIF", append([]byte("Exif\x00\x00"), tiffWithOrientation(6)...)),
+			riffChunk("XMP ", []byte(testXMP)),
+		)
+
+		image, err := Decode(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("WEBP", "Animation")).Should(BeTrue())
+		Expect(image.ReadPropertyValue("WEBP", "Alpha")).Should(BeTrue())
+		Expect(image.ReadPropertyValue("WEBP", "Lossless")).Should(BeTrue())
+		Expect(image.ReadPropertyValue("WEBP", "FrameCount")).Should(Equal(uint32(2)))
+		Expect(image.ReadPropertyValue("WEBP", "LoopCount")).Should(Equal(uint16(3)))
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("The Wall"))
+
+		Expect(image.Orientation()).Should(Equal(uint16(6)))
+		width, height, err := image.DisplayDimensions()
+		Expect(err).Should(BeNil())
+		Expect([]uint32{width, height}).Should(Equal([]uint32{480, 640}))
+	})
+
+	It("should skip metadata chunks beyond the RIFF container or above the limit", func() {
+		// an EXIF chunk that claims 4 GB, but the RIFF container ends after its header
+		huge := []byte{'E', 'X', 'I', 'F', 0xF0, 0xFF, 0xFF, 0xFF}
+		image, err := Decode(bytes.NewReader(webpFile(riffChunk("VP8L", vp8lHeader(100, 50, false)), huge)))
+		Expect(err).Should(BeNil())
+		Expect(image.HasSection("EXIF")).Should(BeFalse())
+		width, _, err := image.Dimensions()
+		Expect(err).Should(BeNil())
+		Expect(width).Should(Equal(uint32(100)))
+
+		// an XMP chunk above the limit inside the container
+		large := riffChunk("XMP ", make([]byte, 16<<20+2))
+		image, err = Decode(bytes.NewReader(webpFile(riffChunk("VP8L", vp8lHeader(100, 50, false)), large)))
+		Expect(err).Should(BeNil())
+		Expect(image.HasSection("XMP")).Should(BeFalse())
+	})
+
+})
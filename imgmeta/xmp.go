@@ -0,0 +1,420 @@
+package imgmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+XMP (Extensible Metadata Platform)
+
+XMP packets are RDF/XML documents. Every property belongs to a namespace and is written either as an attribute
+of a rdf:Description or as a child element. Values can be simple text, arrays or structures:
+
+    <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+        xmp:Rating="3">                                    simple value as attribute
+      <dc:creator><rdf:Seq><rdf:li>Jane</rdf:li></rdf:Seq></dc:creator>            ordered array
+      <dc:subject><rdf:Bag><rdf:li>wall</rdf:li></rdf:Bag></dc:subject>            unordered array
+      <dc:title><rdf:Alt><rdf:li xml:lang="x-default">The Wall</rdf:li></rdf:Alt></dc:title>   language alternatives
+      <Iptc4xmpCore:CreatorContactInfo rdf:parseType="Resource">                   structure
+        <Iptc4xmpCore:CiEmailWork>jane@example.com</Iptc4xmpCore:CiEmailWork>
+      </Iptc4xmpCore:CreatorContactInfo>
+    </rdf:Description>
+
+The properties are flattened into a map with the well known prefix of their namespace ('dc:subject'). Arrays
+(Bag, Seq) become []string, language alternatives the 'x-default' (or first) text, and the fields of structures
+are joined with a slash ('Iptc4xmpCore:CreatorContactInfo/Iptc4xmpCore:CiEmailWork'). Typed nodes like
+<cc:Work rdf:about=""> (common in the RDF metadata of SVG files) are read like a rdf:Description.
+
+In JPEG files XMP is stored in an APP1 segment with the identifier "http://ns.adobe.com/xap/1.0/\000". Packets that
+do not fit into it are split, the properties of the extended XMP (see xmpwrite.go) are added to the ones of the
+standard packet.
+
+*/
+
+const (
+	nsRDF     = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsXML     = "http://www.w3.org/XML/1998/namespace"
+	nsXMPNote = "http://ns.adobe.com/xmp/note/"
+)
+
+// cXMPMaxExtendedSize is the largest extended XMP that is read
+const cXMPMaxExtendedSize = 16 << 20
+
+// aXMPNamespaces maps namespace URIs to their usual prefix
+var aXMPNamespaces = map[string]string{
+	"http://purl.org/dc/elements/1.1/":                     "dc",
+	"http://ns.adobe.com/xap/1.0/":                         "xmp",
+	"http://ns.adobe.com/xap/1.0/rights/":                  "xmpRights",
+	"http://ns.adobe.com/xap/1.0/mm/":                      "xmpMM",
+	"http://ns.adobe.com/xap/1.0/sType/ResourceEvent#":     "stEvt",
+	"http://ns.adobe.com/xap/1.0/sType/ResourceRef#":       "stRef",
+	"http://ns.adobe.com/photoshop/1.0/":                   "photoshop",
+	"http://ns.adobe.com/tiff/1.0/":                        "tiff",
+	"http://ns.adobe.com/exif/1.0/":                        "exif",
+	"http://cipa.jp/exif/1.0/":                             "exifEX",
+	"http://ns.adobe.com/exif/1.0/aux/":                    "aux",
+	"http://ns.adobe.com/camera-raw-settings/1.0/":         "crs",
+	"http://ns.adobe.com/lightroom/1.0/":                   "lr",
+	"http://ns.adobe.com/xmp/1.0/DynamicMedia/":            "xmpDM",
+	"http://ns.adobe.com/pdf/1.3/":                         "pdf",
+	"http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/":          "Iptc4xmpCore",
+	"http://iptc.org/std/Iptc4xmpExt/2008-02-29/":          "Iptc4xmpExt",
+	"http://ns.useplus.org/ldf/xmp/1.0/":                   "plus",
+	"http://creativecommons.org/ns#":                       "cc",
+	"http://purl.org/dc/terms/":                            "dcterms",
+	"http://ns.google.com/photos/1.0/panorama/":            "GPano",
+	"http://www.metadataworkinggroup.com/schemas/regions/": "mwg-rs",
+	"http://ns.microsoft.com/photo/1.0/":                   "MicrosoftPhoto",
+	nsXMPNote:                                              "xmpNote",
+	nsRDF:                                                  "rdf",
+	nsXML:                                                  "xml",
+}
+
+// XMP holds the properties of an XMP packet, keyed by 'prefix:name'
+type XMP struct {
+	packet     []byte
+	properties map[string]interface{}
+}
+
+// ParseXMP reads the properties of an XMP packet
+func ParseXMP(packet []byte) (XMP, error) {
+	x := XMP{packet: packet, properties: map[string]interface{}{}}
+	p := tXMPParser{xmp: &x, prefixes: map[string]string{}}
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return x, &exifError{fmt.Sprintf("Invalid XMP packet: %v", err)}
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			p.declare(start)
+			if start.Name.Space == nsRDF && start.Name.Local == "RDF" {
+				if err := p.readNodes(decoder); err != nil {
+					return x, err
+				}
+			} else if start.Name.Space == nsRDF && start.Name.Local == "Description" {
+				if err := p.readDescription(decoder, start, ""); err != nil {
+					return x, err
+				}
+			}
+		}
+	}
+	return x, nil
+}
+
+// Packet returns the raw XMP packet
+func (x XMP) Packet() []byte {
+	return x.packet
+}
+
+// Get returns the value of a property like 'dc:title'
+func (x XMP) Get(name string) (interface{}, bool) {
+	value, ok := x.properties[name]
+	return value, ok
+}
+
+// Properties returns all properties of the packet
+func (x XMP) Properties() map[string]interface{} {
+	return x.properties
+}
+
+type tXMPParser struct {
+	xmp      *XMP
+	prefixes map[string]string // namespace URI -> prefix as declared in the packet
+}
+
+// declare remembers the namespace prefixes declared by an element
+func (p *tXMPParser) declare(start xml.StartElement) {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" {
+			if _, ok := p.prefixes[attr.Value]; !ok {
+				p.prefixes[attr.Value] = attr.Name.Local
+			}
+		}
+	}
+}
+
+// name returns 'prefix:local' for a namespaced name
+func (p *tXMPParser) name(n xml.Name) string {
+	prefix, ok := aXMPNamespaces[n.Space]
+	if !ok {
+		prefix, ok = p.prefixes[n.Space]
+	}
+	if !ok {
+		prefix = n.Space
+	}
+	return prefix + ":" + n.Local
+}
+
+func isRDFSyntaxAttr(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" || attr.Name.Space == nsRDF || attr.Name.Space == nsXML
+}
+
+// readNodes reads the node elements of rdf:RDF up to its end element. Typed nodes like cc:Work are
+// read like a rdf:Description.
+func (p *tXMPParser) readNodes(decoder *xml.Decoder) error {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return &exifError{fmt.Sprintf("Invalid XMP packet: %v", err)}
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			p.declare(t)
+			if err := p.readDescription(decoder, t, ""); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// readDescription reads the properties of a rdf:Description (or a structure) up to its end element
+func (p *tXMPParser) readDescription(decoder *xml.Decoder, start xml.StartElement, path string) error {
+	for _, attr := range start.Attr {
+		if !isRDFSyntaxAttr(attr) {
+			p.xmp.properties[path+p.name(attr.Name)] = attr.Value
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return &exifError{fmt.Sprintf("Invalid XMP packet: %v", err)}
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			p.declare(t)
+			if err := p.readProperty(decoder, t, path+p.name(t.Name)); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// readProperty reads a property element: simple text, array, language alternative or structure
+func (p *tXMPParser) readProperty(decoder *xml.Decoder, start xml.StartElement, name string) error {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == nsRDF && attr.Name.Local == "parseType" && attr.Value == "Resource" {
+			return p.readDescription(decoder, xml.StartElement{}, name+"/")
+		}
+		if attr.Name.Space == nsRDF && attr.Name.Local == "resource" {
+			p.xmp.properties[name] = attr.Value
+		}
+	}
+	// Qualifiers written as attributes of the property (e.g. a structure in short form)
+	for _, attr := range start.Attr {
+		if !isRDFSyntaxAttr(attr) {
+			p.xmp.properties[name+"/"+p.name(attr.Name)] = attr.Value
+		}
+	}
+
+	text := strings.Builder{}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return &exifError{fmt.Sprintf("Invalid XMP packet: %v", err)}
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			p.declare(t)
+			var err error
+			switch {
+			case t.Name.Space == nsRDF && (t.Name.Local == "Bag" || t.Name.Local == "Seq"):
+				var items []string
+				items, err = p.readArray(decoder)
+				p.xmp.properties[name] = items
+			case t.Name.Space == nsRDF && t.Name.Local == "Alt":
+				var value string
+				value, err = p.readAlternative(decoder)
+				p.xmp.properties[name] = value
+			case t.Name.Space != nsRDF || t.Name.Local == "Description":
+				// a structure, as rdf:Description or as typed node like cc:Agent
+				err = p.readDescription(decoder, t, name+"/")
+			default:
+				err = decoder.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if _, ok := p.xmp.properties[name]; !ok {
+				if value := strings.TrimSpace(text.String()); value != "" {
+					p.xmp.properties[name] = value
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// readArray reads the rdf:li items of a Bag or Seq up to its end element
+func (p *tXMPParser) readArray(decoder *xml.Decoder) ([]string, error) {
+	items := []string{}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return items, &exifError{fmt.Sprintf("Invalid XMP packet: %v", err)}
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var item string
+			if err := decoder.DecodeElement(&item, &t); err != nil {
+				return items, err
+			}
+			items = append(items, strings.TrimSpace(item))
+		case xml.EndElement:
+			return items, nil
+		}
+	}
+}
+
+// readAlternative reads a language alternative and returns the 'x-default' or the first text
+func (p *tXMPParser) readAlternative(decoder *xml.Decoder) (string, error) {
+	value, hasDefault := "", false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return value, &exifError{fmt.Sprintf("Invalid XMP packet: %v", err)}
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var item string
+			if err := decoder.DecodeElement(&item, &t); err != nil {
+				return value, err
+			}
+			isDefault := false
+			for _, attr := range t.Attr {
+				if attr.Name.Space == nsXML && attr.Name.Local == "lang" && attr.Value == "x-default" {
+					isDefault = true
+				}
+			}
+			if isDefault {
+				value, hasDefault = strings.TrimSpace(item), true
+			} else if !hasDefault && value == "" {
+				value = strings.TrimSpace(item)
+			}
+		case xml.EndElement:
+			return value, nil
+		}
+	}
+}
+
+// tXMPAPP is the XMP section of an image
+type tXMPAPP struct {
+	endian binary.ByteOrder
+	block  []byte // full APP block, or the bare packet for other formats
+	xmp    XMP
+}
+
+func (t tXMPAPP) Name() string {
+	return "XMP"
+}
+func (t tXMPAPP) Marker() uint16 {
+	return cEXIF
+}
+func (t tXMPAPP) Length() uint16 {
+	if len(t.block) > 0xFFFF {
+		return 0xFFFF
+	}
+	return uint16(len(t.block))
+}
+func (t tXMPAPP) ID(cid []byte) []byte {
+	return []byte{}
+}
+func (t tXMPAPP) HasID(cid []byte) bool {
+	return true
+}
+
+func (t tXMPAPP) ReadValue(tagID2Find uint16) (interface{}, error) {
+	return nil, &exifError{"XMP properties are read by name"}
+}
+
+// ReadProperty returns the value of a property like 'dc:title'
+func (t tXMPAPP) ReadProperty(name string) (interface{}, error) {
+	value, ok := t.xmp.Get(name)
+	if !ok {
+		return nil, &exifError{fmt.Sprintf("XMP property '%s' not found", name)}
+	}
+	return value, nil
+}
+
+// newXMPAPP parses an XMP packet into a section
+func newXMPAPP(block []byte, packet []byte) (*tXMPAPP, error) {
+	xmp, err := ParseXMP(packet)
+	return &tXMPAPP{endian: binary.BigEndian, block: block, xmp: xmp}, err
+}
+
+// addExtended adds the properties of the extended XMP the packet refers to, portions are the payloads of the
+// extension segments behind their identifier
+func (t *tXMPAPP) addExtended(portions [][]byte) {
+	guid, ok := t.xmp.Get("xmpNote:HasExtendedXMP")
+	if !ok {
+		return
+	}
+	text, _ := guid.(string)
+	extended, ok := assembleExtendedXMP(portions, text)
+	if !ok {
+		log.Warn(fmt.Sprintf("Extended XMP %s is incomplete", text))
+		return
+	}
+	x, err := ParseXMP(extended)
+	if err != nil {
+		log.Warn(err.Error())
+		return
+	}
+	for name, value := range x.properties {
+		if _, ok := t.xmp.properties[name]; !ok {
+			t.xmp.properties[name] = value
+		}
+	}
+}
+
+// assembleExtendedXMP joins the portions of the extended XMP with the GUID, every portion starts with the GUID,
+// the full length and its offset. All portions must carry the same length, which must not exceed
+// cXMPMaxExtendedSize and must be filled by the portions.
+func assembleExtendedXMP(portions [][]byte, guid string) ([]byte, bool) {
+	matching := [][]byte{}
+	length, size := uint32(0), 0
+	for _, portion := range portions {
+		if len(portion) < 40 || string(portion[:32]) != guid {
+			continue
+		}
+		if len(matching) > 0 && binary.BigEndian.Uint32(portion[32:]) != length {
+			return nil, false
+		}
+		length = binary.BigEndian.Uint32(portion[32:])
+		size += len(portion) - 40
+		matching = append(matching, portion)
+	}
+	if len(matching) == 0 || length > cXMPMaxExtendedSize || size < int(length) {
+		return nil, false
+	}
+
+	extended := make([]byte, length)
+	received := 0
+	for _, portion := range matching {
+		offset := binary.BigEndian.Uint32(portion[36:])
+		if uint64(offset)+uint64(len(portion)-40) > uint64(len(extended)) {
+			return nil, false
+		}
+		received += copy(extended[offset:], portion[40:])
+	}
+	return extended, received == len(extended)
+}
@@ -0,0 +1,54 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("XMP", func() {
+
+	It("should read the XMP APP1 segment of a JPEG", func() {
+		image := readJpegFile(sampleJpeg)
+
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("JK-The-Wall von GraphicConverter"))
+		Expect(image.ReadPropertyValue("XMP", "dc:subject")).Should(Equal([]string{"jk", "test", "wall"}))
+		Expect(image.ReadPropertyValue("XMP", "photoshop:DateCreated")).Should(Equal("2020-05-03"))
+	})
+
+	It("should flatten structures and keep unknown prefixes", func() {
+		xmp, err := ParseXMP([]byte(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:Iptc4xmpCore="http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/" xmlns:my="http://example.com/my/">
+<Iptc4xmpCore:CreatorContactInfo rdf:parseType="Resource"><Iptc4xmpCore:CiEmailWork>jane@example.com</Iptc4xmpCore:CiEmailWork></Iptc4xmpCore:CreatorContactInfo>
+<my:Label>custom</my:Label>
+</rdf:Description></rdf:RDF>`))
+		Expect(err).Should(BeNil())
+
+		Expect(xmp.Properties()).Should(HaveKeyWithValue("Iptc4xmpCore:CreatorContactInfo/Iptc4xmpCore:CiEmailWork", "jane@example.com"))
+		Expect(xmp.Properties()).Should(HaveKeyWithValue("my:Label", "custom"))
+	})
+
+	It("should keep reading a JPEG with a broken XMP packet", func() {
+		data, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(data))
+		Expect(err).Should(BeNil())
+		xmpID := []byte("http://ns.adobe.com/xap/1.0/\x00")
+		Expect(writer.Replace(xmpID, Segment{Marker: MarkerAPP0 + 1, Payload: append(xmpID, testXMP[:100]...)})).Should(Succeed())
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+
+		image, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(image.HasSection("XMP")).Should(BeTrue())
+		_, err = image.ReadPropertyValue("XMP", "dc:title")
+		Expect(err).ShouldNot(BeNil())
+		Expect(image.ReadTagValue("EXIF", ExifTagModel)).Should(Equal("Kamera-Modell"))
+		Expect(image.ReadPropertyValue("IPTC", "Keywords")).Should(Equal([]string{"test", "wall"}))
+	})
+
+})
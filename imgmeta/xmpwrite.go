@@ -0,0 +1,579 @@
+package imgmeta
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Writing XMP
+
+An XMPEditor changes the properties of an XMP packet (see xmp.go) in place: the elements and attributes of the
+changed properties are removed from every rdf:Description, the new values are added to the first one. Everything
+else, including namespaces the editor does not know, is kept byte for byte.
+
+A JPEG stores the packet in one APP1 segment. If it does not fit, the largest properties are moved into an
+extended packet, which is split into as many APP1 segments as needed:
+
+    [Record name]    [size]    [description]
+    ---------------------------------------
+    StandardXMP        ...     "http://ns.adobe.com/xap/1.0/\000" and the packet, with xmpNote:HasExtendedXMP
+    ExtendedXMP        ...     one segment per portion of the extended packet:
+                                   Signature  35 bytes  "http://ns.adobe.com/xmp/extension/\000"
+                                   GUID       32 bytes  MD5 of the extended packet in upper case hex
+                                   Length      4 bytes  length of the extended packet
+                                   Offset      4 bytes  offset of the portion in the extended packet
+                                   Portion       ...
+
+Other formats get a sidecar, an XMP file next to the image with the same name ('IMG_0001.xmp' for 'IMG_0001.CR2').
+
+*/
+
+const (
+	cMaxXMPSize    = 0xFFFF - 2 - 29              // packet in one APP1 segment, behind the length and the ID
+	cMaxXMPPortion = 0xFFFF - 2 - 35 - 32 - 4 - 4 // portion of the extended packet in one APP1 segment
+	cXMPFileMode   = 0644                         // permissions of new sidecars
+)
+
+// aXMPArrays are the array types of properties, other []string values are written as rdf:Bag
+var aXMPArrays = map[string]string{
+	"dc:title":                         "Alt",
+	"dc:description":                   "Alt",
+	"dc:rights":                        "Alt",
+	"xmpRights:UsageTerms":             "Alt",
+	"dc:creator":                       "Seq",
+	"dc:subject":                       "Bag",
+	"photoshop:SupplementalCategories": "Bag",
+	"lr:hierarchicalSubject":           "Bag",
+}
+
+// rXMPAttribute matches a namespaced attribute of a start tag
+var rXMPAttribute = regexp.MustCompile(`\s+([A-Za-z_][\w.\-]*):([A-Za-z_][\w.\-]*)\s*=\s*("[^"]*"|'[^']*')`)
+
+// rXMPElementName matches the name of a start tag
+var rXMPElementName = regexp.MustCompile(`^<([^\s/>]+)`)
+
+// newXMPPacket returns an XMP packet without properties, with or without the xpacket wrapper of embedded XMP
+func newXMPPacket(wrapper bool) []byte {
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="` + nsRDF + `">
+  <rdf:Description rdf:about="">
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+`
+	if wrapper {
+		packet = "<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n" + packet + "<?xpacket end=\"w\"?>"
+	}
+	return []byte(packet)
+}
+
+// XMPEditor changes the properties of an XMP packet
+type XMPEditor struct {
+	packet     []byte
+	namespaces map[string]string      // prefix -> namespace URI, as declared in the packet
+	changes    map[string]interface{} // new values by 'prefix:name', nil deletes a property
+}
+
+// NewXMPEditor returns an editor for a packet, an empty packet starts a new one
+func NewXMPEditor(packet []byte) (*XMPEditor, error) {
+	if len(bytes.TrimSpace(packet)) == 0 {
+		packet = newXMPPacket(true)
+	}
+	layout, err := scanXMP(packet)
+	if err != nil {
+		return nil, err
+	}
+	return &XMPEditor{packet: packet, namespaces: layout.namespaces, changes: map[string]interface{}{}}, nil
+}
+
+// namespace returns the URI of a prefix, the well known prefixes (see aXMPNamespaces) come first
+func (e *XMPEditor) namespace(prefix string) (string, bool) {
+	for uri, known := range aXMPNamespaces {
+		if known == prefix {
+			return uri, true
+		}
+	}
+	uri, ok := e.namespaces[prefix]
+	return uri, ok
+}
+
+// Set changes a property like 'dc:title'. Values are strings, []string for arrays and int for numbers like
+// 'xmp:Rating'. Language alternatives (e.g. 'dc:title') take a string, written as 'x-default'.
+func (e *XMPEditor) Set(name string, value interface{}) error {
+	parts := strings.SplitN(name, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return &exifError{fmt.Sprintf("XMP property '%s' has no prefix", name)}
+	}
+	if _, ok := e.namespace(parts[0]); !ok {
+		return &exifError{fmt.Sprintf("XMP prefix '%s' is unknown", parts[0])}
+	}
+	switch v := value.(type) {
+	case string:
+	case []string:
+		if aXMPArrays[name] == "Alt" {
+			return &exifError{fmt.Sprintf("XMP property '%s' is a language alternative", name)}
+		}
+	case int:
+		value = strconv.Itoa(v)
+	default:
+		return &exifError{fmt.Sprintf("XMP property '%s' can not be written as %T", name, value)}
+	}
+	e.changes[name] = value
+	return nil
+}
+
+// Delete removes a property like 'dc:title'
+func (e *XMPEditor) Delete(name string) {
+	e.changes[name] = nil
+}
+
+// Encode returns the packet with the changed properties
+func (e *XMPEditor) Encode() ([]byte, error) {
+	layout, err := scanXMP(e.packet)
+	if err != nil {
+		return nil, err
+	}
+	edits := []tXMPEdit{}
+	for _, property := range layout.properties {
+		if _, changed := e.changes[property.name]; changed {
+			edits = append(edits, tXMPEdit{start: property.start, end: property.end})
+		}
+	}
+
+	node := layout.nodes[0]
+	scope := map[string]string{}
+	for prefix, uri := range node.scope {
+		scope[prefix] = uri
+	}
+	rdf := scopePrefix(scope, nsRDF)
+	names := []string{}
+	for name, value := range e.changes {
+		if value != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	declarations, properties := &strings.Builder{}, &strings.Builder{}
+	for _, name := range names {
+		parts := strings.SplitN(name, ":", 2)
+		uri, _ := e.namespace(parts[0])
+		prefix := scopePrefix(scope, uri)
+		if prefix == "" {
+			if other, ok := scope[parts[0]]; ok {
+				return nil, &exifError{fmt.Sprintf("XMP prefix '%s' is bound to %s", parts[0], other)}
+			}
+			prefix, scope[parts[0]] = parts[0], uri
+			fmt.Fprintf(declarations, ` xmlns:%s="%s"`, prefix, uri)
+		}
+		writeXMPProperty(properties, prefix+":"+parts[1], rdf, aXMPArrays[name], e.changes[name])
+	}
+
+	if node.close < 0 {
+		// an empty node gets an end tag
+		element := rXMPElementName.FindSubmatch(e.packet[node.start:node.end])[1]
+		text := declarations.String() + ">" + properties.String() + "\n  </" + string(element) + ">"
+		edits = append(edits, tXMPEdit{start: node.end - 2, end: node.end, text: text})
+	} else {
+		// the properties follow the last content of the node
+		last := node.close
+		for last > node.end && strings.ContainsRune(" \t\r\n", rune(e.packet[last-1])) {
+			last--
+		}
+		edits = append(edits, tXMPEdit{start: node.end - 1, end: node.end - 1, text: declarations.String()})
+		edits = append(edits, tXMPEdit{start: last, end: last, text: properties.String()})
+	}
+
+	packet := applyXMPEdits(e.packet, edits)
+	if _, err := ParseXMP(packet); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// scopePrefix returns the prefix of a namespace URI in the scope, "" if it is not declared
+func scopePrefix(scope map[string]string, uri string) string {
+	prefixes := []string{}
+	for prefix, declared := range scope {
+		if declared == uri {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+	if len(prefixes) == 0 {
+		return ""
+	}
+	return prefixes[0]
+}
+
+// writeXMPProperty writes a property element, rdf is the prefix of the RDF namespace
+func writeXMPProperty(out *strings.Builder, name string, rdf string, array string, value interface{}) {
+	items, isList := value.([]string)
+	if !isList && array != "" && array != "Alt" {
+		items, isList = []string{value.(string)}, true
+	}
+	switch {
+	case isList:
+		if array == "" {
+			array = "Bag"
+		}
+		fmt.Fprintf(out, "\n   <%s>\n    <%s:%s>", name, rdf, array)
+		for _, item := range items {
+			fmt.Fprintf(out, "\n     <%s:li>%s</%s:li>", rdf, xmlText(item), rdf)
+		}
+		fmt.Fprintf(out, "\n    </%s:%s>\n   </%s>", rdf, array, name)
+	case array == "Alt":
+		fmt.Fprintf(out, "\n   <%s>\n    <%s:Alt>\n     <%s:li xml:lang=\"x-default\">%s</%s:li>\n    </%s:Alt>\n   </%s>",
+			name, rdf, rdf, xmlText(value.(string)), rdf, rdf, name)
+	default:
+		fmt.Fprintf(out, "\n   <%s>%s</%s>", name, xmlText(value.(string)), name)
+	}
+}
+
+// xmlText escapes text for XML
+func xmlText(text string) string {
+	buf := &bytes.Buffer{}
+	xml.EscapeText(buf, []byte(text))
+	return buf.String()
+}
+
+// tXMPEdit replaces a byte range of a packet
+type tXMPEdit struct {
+	start, end int
+	text       string
+}
+
+// applyXMPEdits returns a copy of the packet with the edits, which must not overlap
+func applyXMPEdits(packet []byte, edits []tXMPEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	out := append([]byte{}, packet...)
+	for _, edit := range edits {
+		out = append(out[:edit.start], append([]byte(edit.text), out[edit.end:]...)...)
+	}
+	return out
+}
+
+// tXMPSpan is a property of a packet
+type tXMPSpan struct {
+	name       string // 'prefix:name' as read by ParseXMP
+	start, end int    // byte range, with the white space in front of it
+}
+
+// tXMPNode is a node element of rdf:RDF, usually a rdf:Description
+type tXMPNode struct {
+	start, end int               // byte range of the start tag
+	close      int               // start of the end tag, -1 for an empty element
+	closeEnd   int               // end of the element
+	scope      map[string]string // prefix -> namespace URI, declared by the node and its ancestors
+}
+
+// tXMPLayout locates the parts of a packet an XMPEditor changes
+type tXMPLayout struct {
+	nodes      []tXMPNode
+	properties []tXMPSpan        // elements and attributes of the nodes
+	namespaces map[string]string // prefix -> namespace URI of all declarations, the first one counts
+	rootScope  map[string]string // prefix -> namespace URI, declared by rdf:RDF and its ancestors
+	rdfEnd     int               // start of the end tag of rdf:RDF
+}
+
+// scanXMP locates the nodes and properties of a packet
+func scanXMP(packet []byte) (tXMPLayout, error) {
+	layout := tXMPLayout{namespaces: map[string]string{}, rdfEnd: -1}
+	p := tXMPParser{prefixes: map[string]string{}}
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+
+	scopes := []map[string]string{{"xml": nsXML}}
+	depth, rdfDepth := 0, -1
+	var property tXMPSpan
+	for layout.rdfEnd < 0 {
+		start := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return layout, &exifError{fmt.Sprintf("Invalid XMP packet: %v", err)}
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			p.declare(t)
+			scope := map[string]string{}
+			for prefix, uri := range scopes[len(scopes)-1] {
+				scope[prefix] = uri
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					scope[attr.Name.Local] = attr.Value
+					if _, ok := layout.namespaces[attr.Name.Local]; !ok {
+						layout.namespaces[attr.Name.Local] = attr.Value
+					}
+				}
+			}
+			scopes = append(scopes, scope)
+			depth++
+			end := int(decoder.InputOffset())
+
+			switch {
+			case rdfDepth < 0 && t.Name.Space == nsRDF && t.Name.Local == "RDF":
+				rdfDepth, layout.rootScope = depth, scope
+			case rdfDepth > 0 && depth == rdfDepth+1:
+				layout.nodes = append(layout.nodes, tXMPNode{start: start, end: end, close: -1, closeEnd: end, scope: scope})
+				for _, m := range rXMPAttribute.FindAllSubmatchIndex(packet[start:end], -1) {
+					prefix, local := string(packet[start+m[2]:start+m[3]]), string(packet[start+m[4]:start+m[5]])
+					uri, ok := scope[prefix]
+					if !ok || prefix == "xmlns" || uri == nsRDF || uri == nsXML {
+						continue
+					}
+					name := p.name(xml.Name{Space: uri, Local: local})
+					layout.properties = append(layout.properties, tXMPSpan{name: name, start: start + m[0], end: start + m[1]})
+				}
+			case rdfDepth > 0 && depth == rdfDepth+2:
+				property = tXMPSpan{name: p.name(t.Name), start: start}
+				for property.start > 0 && strings.ContainsRune(" \t\r\n", rune(packet[property.start-1])) {
+					property.start--
+				}
+			}
+
+		case xml.EndElement:
+			end := int(decoder.InputOffset())
+			switch {
+			case rdfDepth > 0 && depth == rdfDepth+2:
+				property.end = end
+				layout.properties = append(layout.properties, property)
+			case rdfDepth > 0 && depth == rdfDepth+1:
+				node := &layout.nodes[len(layout.nodes)-1]
+				if !bytes.HasSuffix(packet[node.start:node.end], []byte("/>")) {
+					node.close, node.closeEnd = start, end
+				}
+			case depth == rdfDepth:
+				layout.rdfEnd = start
+			}
+			scopes = scopes[:len(scopes)-1]
+			depth--
+		}
+	}
+
+	if len(layout.nodes) == 0 {
+		return layout, &exifError{"XMP packet has no rdf:Description"}
+	}
+	return layout, nil
+}
+
+// splitXMP moves the largest properties of a packet into an extended packet, until the rest fits into an
+// APP1 segment. It returns the standard packet, the extended one and its GUID.
+func splitXMP(packet []byte) ([]byte, []byte, string, error) {
+	layout, err := scanXMP(packet)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	spans := []tXMPSpan{}
+	for _, span := range layout.properties {
+		if !strings.HasPrefix(strings.TrimSpace(string(packet[span.start:span.end])), "<") {
+			continue // attributes are small
+		}
+		spans = append(spans, span)
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].end-spans[i].start > spans[j].end-spans[j].start })
+
+	// room for xmpNote:HasExtendedXMP and its namespace
+	size := len(packet) + 128
+	moved := []tXMPSpan{}
+	for _, span := range spans {
+		if size <= cMaxXMPSize {
+			break
+		}
+		moved = append(moved, span)
+		size -= span.end - span.start
+	}
+	if size > cMaxXMPSize {
+		return nil, nil, "", &exifError{"XMP packet is too large, even with extended XMP"}
+	}
+	sort.Slice(moved, func(i, j int) bool { return moved[i].start < moved[j].start })
+
+	extended := &strings.Builder{}
+	extended.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n <rdf:RDF xmlns:rdf=\"" + nsRDF + "\">\n  <rdf:Description rdf:about=\"\"")
+	prefixes := []string{}
+	for prefix := range layout.namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		if prefix != "x" && prefix != "rdf" {
+			fmt.Fprintf(extended, " xmlns:%s=\"%s\"", prefix, layout.namespaces[prefix])
+		}
+	}
+	extended.WriteString(">")
+	edits := []tXMPEdit{}
+	for _, span := range moved {
+		extended.Write(packet[span.start:span.end])
+		edits = append(edits, tXMPEdit{start: span.start, end: span.end})
+	}
+	extended.WriteString("\n  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	guid := fmt.Sprintf("%X", md5.Sum([]byte(extended.String())))
+
+	node := layout.nodes[0]
+	note := scopePrefix(node.scope, nsXMPNote)
+	text := ""
+	if note == "" {
+		note = "xmpNote"
+		text = ` xmlns:xmpNote="` + nsXMPNote + `"`
+	}
+	text += fmt.Sprintf(` %s:HasExtendedXMP="%s"`, note, guid)
+	tagEnd := node.end - 1
+	if node.close < 0 {
+		tagEnd = node.end - 2
+	}
+	edits = append(edits, tXMPEdit{start: tagEnd, end: tagEnd, text: text})
+	return applyXMPEdits(packet, edits), []byte(extended.String()), guid, nil
+}
+
+// mergeXMP adds the nodes of an extended packet to the standard one, with the namespaces they depend on
+func mergeXMP(standard []byte, extended []byte) ([]byte, error) {
+	layout, err := scanXMP(standard)
+	if err != nil {
+		return nil, err
+	}
+	if layout.rdfEnd < 0 {
+		return nil, &exifError{"XMP packet has no end of rdf:RDF"}
+	}
+	ext, err := scanXMP(extended)
+	if err != nil {
+		return nil, err
+	}
+
+	text := &strings.Builder{}
+	for _, node := range ext.nodes {
+		tag := string(extended[node.start:node.end])
+		declarations := ""
+		for prefix, uri := range ext.rootScope {
+			if prefix != "xml" && !strings.Contains(tag, "xmlns:"+prefix+"=") {
+				declarations += fmt.Sprintf(` xmlns:%s="%s"`, prefix, uri)
+			}
+		}
+		name := rXMPElementName.FindString(tag)
+		text.WriteString("\n  " + name + declarations + tag[len(name):])
+		text.Write(extended[node.end:node.closeEnd])
+	}
+	text.WriteString("\n ")
+	return applyXMPEdits(standard, []tXMPEdit{{start: layout.rdfEnd, end: layout.rdfEnd, text: text.String()}}), nil
+}
+
+// XMP returns an editor for the XMP of the JPEG, its extended XMP is merged into it. The editor starts a new
+// packet if the JPEG has none.
+func (w *JpegWriter) XMP() (*XMPEditor, error) {
+	index := w.Find(cEXIF, idXMP)
+	if index < 0 {
+		return NewXMPEditor(nil)
+	}
+	packet := w.Segments[index].Payload[len(idXMP):]
+	x, err := ParseXMP(packet)
+	if err != nil {
+		return nil, err
+	}
+	if guid, ok := x.Get("xmpNote:HasExtendedXMP"); ok {
+		portions := [][]byte{}
+		for _, segment := range w.Segments {
+			if segment.Marker == cEXIF && segment.HasID(idXMPExt) {
+				portions = append(portions, segment.Payload[len(idXMPExt):])
+			}
+		}
+		text, _ := guid.(string)
+		if extended, ok := assembleExtendedXMP(portions, text); ok {
+			if packet, err = mergeXMP(packet, extended); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	editor, err := NewXMPEditor(packet)
+	if err != nil {
+		return nil, err
+	}
+	editor.Delete("xmpNote:HasExtendedXMP")
+	return editor, nil
+}
+
+// SetXMP replaces the XMP of the JPEG by the packet of the editor. A packet that does not fit into one APP1
+// segment is split into the standard and the extended XMP.
+func (w *JpegWriter) SetXMP(e *XMPEditor) error {
+	packet, err := e.Encode()
+	if err != nil {
+		return err
+	}
+	var extended []byte
+	guid := ""
+	if len(packet) > cMaxXMPSize {
+		if packet, extended, guid, err = splitXMP(packet); err != nil {
+			return err
+		}
+	}
+
+	segments := []Segment{{Marker: cEXIF, Payload: append(append([]byte{}, idXMP...), packet...)}}
+	for offset := 0; offset < len(extended); offset += cMaxXMPPortion {
+		end := offset + cMaxXMPPortion
+		if end > len(extended) {
+			end = len(extended)
+		}
+		header := make([]byte, 8)
+		binary.BigEndian.PutUint32(header, uint32(len(extended)))
+		binary.BigEndian.PutUint32(header[4:], uint32(offset))
+		payload := append(append(append(append([]byte{}, idXMPExt...), guid...), header...), extended[offset:end]...)
+		segments = append(segments, Segment{Marker: cEXIF, Payload: payload})
+	}
+
+	if _, err := w.Delete(cEXIF, idXMPExt); err != nil {
+		return err
+	}
+	if err := w.Replace(idXMP, segments[0]); err != nil {
+		return err
+	}
+	index := w.Find(cEXIF, idXMP) + 1
+	w.Segments = append(w.Segments[:index], append(segments[1:], w.Segments[index:]...)...)
+	return nil
+}
+
+// XMPSidecar returns the path of the XMP sidecar of an image, 'IMG_0001.xmp' for 'IMG_0001.CR2'
+func XMPSidecar(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".xmp"
+}
+
+// OpenXMPSidecar returns an editor for the sidecar of the image at path, it starts a new one if there is none
+func OpenXMPSidecar(path string) (*XMPEditor, error) {
+	packet, err := ioutil.ReadFile(XMPSidecar(path))
+	if os.IsNotExist(err) {
+		return NewXMPEditor(newXMPPacket(false))
+	} else if err != nil {
+		return nil, err
+	}
+	return NewXMPEditor(packet)
+}
+
+// WriteXMPSidecar writes the packet of the editor to the sidecar of the image at path, through a temporary file
+func WriteXMPSidecar(path string, e *XMPEditor) error {
+	packet, err := e.Encode()
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(cXMPFileMode)
+	if info, err := os.Stat(XMPSidecar(path)); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return replaceFile(XMPSidecar(path), mode, time.Time{}, func(out io.Writer) error {
+		_, err := out.Write(packet)
+		return err
+	})
+}
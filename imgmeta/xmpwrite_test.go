@@ -0,0 +1,172 @@
+package imgmeta_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/kuetemeier/imgindex/imgmeta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// customXMP has a property of a namespace the editor does not know
+const customXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="4">
+<dc:title><rdf:Alt><rdf:li xml:lang="de">Die Mauer</rdf:li><rdf:li xml:lang="x-default">The Wall</rdf:li></rdf:Alt></dc:title>
+<dc:subject><rdf:Bag><rdf:li>wall</rdf:li><rdf:li>test</rdf:li></rdf:Bag></dc:subject>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:my="http://example.com/my/1.0/"><my:Album rdf:parseType="Resource"><my:Name>Berlin</my:Name></my:Album></rdf:Description>
+</rdf:RDF></x:xmpmeta>`
+
+var _ = Describe("XMP writing", func() {
+
+	It("should update a packet and keep unknown namespaces", func() {
+		editor, err := NewXMPEditor([]byte(customXMP))
+		Expect(err).Should(BeNil())
+		Expect(editor.Set("dc:title", "Die Mauer & <Berlin>")).Should(Succeed())
+		Expect(editor.Set("dc:subject", []string{"wall", "berlin"})).Should(Succeed())
+		Expect(editor.Set("dc:creator", "Jane")).Should(Succeed())
+		Expect(editor.Set("xmp:Rating", 5)).Should(Succeed())
+		Expect(editor.Set("xmpRights:Marked", "True")).Should(Succeed())
+		Expect(editor.Set("my:Owner", "Jane")).Should(Succeed())
+		editor.Delete("dc:description")
+
+		packet, err := editor.Encode()
+		Expect(err).Should(BeNil())
+		Expect(string(packet)).Should(ContainSubstring(`<my:Album rdf:parseType="Resource"><my:Name>Berlin</my:Name></my:Album>`))
+		Expect(string(packet)).ShouldNot(ContainSubstring("Die Mauer</rdf:li>"))
+
+		xmp, err := ParseXMP(packet)
+		Expect(err).Should(BeNil())
+		Expect(xmp.Properties()["dc:title"]).Should(Equal("Die Mauer & <Berlin>"))
+		Expect(xmp.Properties()["dc:subject"]).Should(Equal([]string{"wall", "berlin"}))
+		Expect(xmp.Properties()["dc:creator"]).Should(Equal([]string{"Jane"}))
+		Expect(xmp.Properties()["xmp:Rating"]).Should(Equal("5"))
+		Expect(xmp.Properties()["xmpRights:Marked"]).Should(Equal("True"))
+		Expect(xmp.Properties()["my:Owner"]).Should(Equal("Jane"))
+		Expect(xmp.Properties()["my:Album/my:Name"]).Should(Equal("Berlin"))
+	})
+
+	It("should create a packet and reject what it can not write", func() {
+		editor, err := NewXMPEditor(nil)
+		Expect(err).Should(BeNil())
+		Expect(editor.Set("dc:rights", "CC BY 4.0")).Should(Succeed())
+		Expect(editor.Set("dc:title", []string{"one", "two"})).ShouldNot(Succeed())
+		Expect(editor.Set("unknown:Title", "x")).ShouldNot(Succeed())
+		Expect(editor.Set("Title", "x")).ShouldNot(Succeed())
+		Expect(editor.Set("xmp:Rating", 4.5)).ShouldNot(Succeed())
+
+		packet, err := editor.Encode()
+		Expect(err).Should(BeNil())
+		Expect(string(packet)).Should(HavePrefix("<?xpacket begin="))
+		xmp, err := ParseXMP(packet)
+		Expect(err).Should(BeNil())
+		Expect(xmp.Properties()).Should(Equal(map[string]interface{}{"dc:rights": "CC BY 4.0"}))
+
+		_, err = NewXMPEditor([]byte("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"></x:xmpmeta>"))
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("should write large packets to a JPEG as extended XMP", func() {
+		original, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		editor, err := writer.XMP()
+		Expect(err).Should(BeNil())
+		description := strings.TrimSpace(strings.Repeat("A long description. ", 5000))
+		Expect(editor.Set("dc:description", description)).Should(Succeed())
+		Expect(writer.SetXMP(editor)).Should(Succeed())
+
+		extensions := 0
+		for _, segment := range writer.Segments {
+			if segment.HasID([]byte("http://ns.adobe.com/xmp/extension/\x00")) {
+				extensions++
+			}
+		}
+		Expect(extensions).Should(Equal(2))
+
+		out := &bytes.Buffer{}
+		_, err = writer.WriteTo(out)
+		Expect(err).Should(BeNil())
+		image, err := Decode(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		Expect(image.ReadPropertyValue("XMP", "dc:description")).Should(Equal(description))
+		Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("JK-The-Wall von GraphicConverter"))
+
+		// the extended XMP is merged for editing, and dropped when the packet fits again
+		writer, err = NewJpegWriter(bytes.NewReader(out.Bytes()))
+		Expect(err).Should(BeNil())
+		editor, err = writer.XMP()
+		Expect(err).Should(BeNil())
+		packet, err := editor.Encode()
+		Expect(err).Should(BeNil())
+		Expect(string(packet)).Should(ContainSubstring(description))
+		Expect(string(packet)).ShouldNot(ContainSubstring("HasExtendedXMP"))
+		editor.Delete("dc:description")
+		Expect(writer.SetXMP(editor)).Should(Succeed())
+		Expect(writer.Find(MarkerAPP0+1, []byte("http://ns.adobe.com/xmp/extension/\x00"))).Should(Equal(-1))
+	})
+
+	It("should ignore extended XMP with an invalid length", func() {
+		original, err := ioutil.ReadFile(sampleJpeg)
+		Expect(err).Should(BeNil())
+		writer, err := NewJpegWriter(bytes.NewReader(original))
+		Expect(err).Should(BeNil())
+		editor, err := writer.XMP()
+		Expect(err).Should(BeNil())
+		Expect(editor.Set("dc:description", strings.Repeat("A long description. ", 5000))).Should(Succeed())
+		Expect(writer.SetXMP(editor)).Should(Succeed())
+		first := writer.Find(MarkerAPP0+1, []byte("http://ns.adobe.com/xmp/extension/\x00"))
+		Expect(first).ShouldNot(Equal(-1))
+
+		// the length behind the signature and the GUID, once too large, once only in the first portion
+		for _, length := range [][]byte{{0xFF, 0xFF, 0xFF, 0xFF}, {0x00, 0x00, 0xFF, 0xFF}} {
+			tampered, err := NewJpegWriter(bytes.NewReader(original))
+			Expect(err).Should(BeNil())
+			tampered.Segments = make([]Segment, len(writer.Segments))
+			copy(tampered.Segments, writer.Segments)
+			payload := append([]byte{}, writer.Segments[first].Payload...)
+			copy(payload[35+32:], length)
+			tampered.Segments[first].Payload = payload
+
+			out := &bytes.Buffer{}
+			_, err = tampered.WriteTo(out)
+			Expect(err).Should(BeNil())
+			image, err := Decode(bytes.NewReader(out.Bytes()))
+			Expect(err).Should(BeNil())
+			Expect(image.ReadPropertyValue("XMP", "dc:title")).Should(Equal("JK-The-Wall von GraphicConverter"))
+			_, err = image.ReadPropertyValue("XMP", "dc:description")
+			Expect(err).ShouldNot(BeNil())
+		}
+	})
+
+	It("should write sidecars", func() {
+		dir, err := ioutil.TempDir("", "xmpwrite")
+		Expect(err).Should(BeNil())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "IMG_0001.CR2")
+		Expect(XMPSidecar(path)).Should(Equal(filepath.Join(dir, "IMG_0001.xmp")))
+
+		editor, err := OpenXMPSidecar(path)
+		Expect(err).Should(BeNil())
+		Expect(editor.Set("dc:title", "The Wall")).Should(Succeed())
+		Expect(WriteXMPSidecar(path, editor)).Should(Succeed())
+
+		editor, err = OpenXMPSidecar(path)
+		Expect(err).Should(BeNil())
+		Expect(editor.Set("xmp:Rating", 3)).Should(Succeed())
+		Expect(WriteXMPSidecar(path, editor)).Should(Succeed())
+
+		packet, err := ioutil.ReadFile(XMPSidecar(path))
+		Expect(err).Should(BeNil())
+		Expect(string(packet)).Should(HavePrefix("<x:xmpmeta"))
+		xmp, err := ParseXMP(packet)
+		Expect(err).Should(BeNil())
+		Expect(xmp.Properties()).Should(Equal(map[string]interface{}{"dc:title": "The Wall", "xmp:Rating": "3"}))
+	})
+
+})
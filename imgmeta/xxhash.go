@@ -0,0 +1,133 @@
+package imgmeta
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+/*
+XXH64 is a fast non-cryptographic hash algorithm by Yann Collet. It is used as the fast mode of the content hash,
+where the integrity of the scan data matters but an attacker does not.
+
+The state consists of four accumulators, each one consuming 8 bytes of every 32 byte stripe. The remaining bytes
+are mixed in at the end. See https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md for the specification.
+*/
+
+var (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+type tXXHash64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	mem            [32]byte
+	n              int // number of bytes in mem
+}
+
+// newXXHash64 returns a new XXH64 hash with seed 0
+func newXXHash64() hash.Hash64 {
+	d := &tXXHash64{}
+	d.Reset()
+	return d
+}
+
+func (d *tXXHash64) Reset() {
+	d.v1 = xxPrime1 + xxPrime2
+	d.v2 = xxPrime2
+	d.v3 = 0
+	d.v4 = -xxPrime1
+	d.total = 0
+	d.n = 0
+}
+
+func (d *tXXHash64) Size() int      { return 8 }
+func (d *tXXHash64) BlockSize() int { return 32 }
+
+func (d *tXXHash64) Write(p []byte) (n int, err error) {
+	n = len(p)
+	d.total += uint64(n)
+
+	if d.n+len(p) < 32 {
+		d.n += copy(d.mem[d.n:], p)
+		return
+	}
+
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], p)
+		d.stripe(d.mem[:])
+		p = p[c:]
+		d.n = 0
+	}
+
+	for ; len(p) >= 32; p = p[32:] {
+		d.stripe(p)
+	}
+
+	d.n = copy(d.mem[:], p)
+	return
+}
+
+func (d *tXXHash64) stripe(b []byte) {
+	d.v1 = xxRound(d.v1, binary.LittleEndian.Uint64(b[0:8]))
+	d.v2 = xxRound(d.v2, binary.LittleEndian.Uint64(b[8:16]))
+	d.v3 = xxRound(d.v3, binary.LittleEndian.Uint64(b[16:24]))
+	d.v4 = xxRound(d.v4, binary.LittleEndian.Uint64(b[24:32]))
+}
+
+func (d *tXXHash64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v1, 1) + bits.RotateLeft64(d.v2, 7) + bits.RotateLeft64(d.v3, 12) + bits.RotateLeft64(d.v4, 18)
+		h = xxMergeRound(h, d.v1)
+		h = xxMergeRound(h, d.v2)
+		h = xxMergeRound(h, d.v3)
+		h = xxMergeRound(h, d.v4)
+	} else {
+		h = d.v3 + xxPrime5
+	}
+	h += d.total
+
+	b := d.mem[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (d *tXXHash64) Sum(in []byte) []byte {
+	s := d.Sum64()
+	return append(in, byte(s>>56), byte(s>>48), byte(s>>40), byte(s>>32), byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	val = xxRound(0, val)
+	acc ^= val
+	return acc*xxPrime1 + xxPrime4
+}